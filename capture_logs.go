@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ConnectLogEntry is one log4j record emitted by the Connect worker. Stack traces
+// and other continuation lines are kept in Raw together with the header line.
+type ConnectLogEntry struct {
+	Timestamp time.Time
+	Level     string
+	Connector string
+	Task      string
+	Message   string
+	Logger    string
+	Raw       string
+}
+
+// LogFilter selects the entries to keep; zero values match everything
+type LogFilter struct {
+	Connector string
+	MinLevel  string
+	Grep      *regexp.Regexp
+}
+
+// LogCaptureOptions controls how `klaunch logs` collects the Connect output
+type LogCaptureOptions struct {
+	Filter LogFilter
+	Since  string
+	Follow bool
+	Output string
+}
+
+// layout of %d in the compose CONNECT_LOG4J_APPENDER_STDOUT_LAYOUT_CONVERSIONPATTERN
+const connectLogTimeLayout = "2006-01-02 15:04:05,000"
+
+// matches "[%d] %p %X{connector.context}%m (%c:%L)"; the context renders as "[name|task-0] " when set
+var connectLogLineRegex = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2},\d{3})\] (TRACE|DEBUG|INFO|WARN|ERROR|FATAL) (?:\[([^|\]]+)\|([^\]]+)\] )?(.*?)(?: \(([^()\s]+)\))?$`)
+
+var logLevelOrder = map[string]int{
+	"TRACE": 0,
+	"DEBUG": 1,
+	"INFO":  2,
+	"WARN":  3,
+	"ERROR": 4,
+	"FATAL": 5,
+}
+
+// parse_connect_log_line parses a header line; it returns false for continuation lines
+func parse_connect_log_line(line string) (*ConnectLogEntry, bool) {
+	match := connectLogLineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+
+	// the containers log in UTC; merge_logs reads the same timestamps as UTC
+	timestamp, err := time.ParseInLocation(connectLogTimeLayout, match[1], time.UTC)
+	if err != nil {
+		return nil, false
+	}
+
+	return &ConnectLogEntry{
+		Timestamp: timestamp,
+		Level:     match[2],
+		Connector: match[3],
+		Task:      match[4],
+		Message:   match[5],
+		Logger:    match[6],
+		Raw:       line,
+	}, true
+}
+
+func (f LogFilter) matches(entry *ConnectLogEntry) bool {
+	if f.MinLevel != "" && logLevelOrder[entry.Level] < logLevelOrder[strings.ToUpper(f.MinLevel)] {
+		return false
+	}
+	if f.Connector != "" {
+		// Worker threads log about a connector without setting the context
+		if entry.Connector != f.Connector && !(entry.Connector == "" && strings.Contains(entry.Message, f.Connector)) {
+			return false
+		}
+	}
+	if f.Grep != nil && !f.Grep.MatchString(entry.Raw) {
+		return false
+	}
+	return true
+}
+
+func validate_log_level(level string) error {
+	if level == "" {
+		return nil
+	}
+	if _, ok := logLevelOrder[strings.ToUpper(level)]; !ok {
+		return fmt.Errorf("unknown log level %q (use TRACE, DEBUG, INFO, WARN, ERROR or FATAL)", level)
+	}
+	return nil
+}
+
+// filter_connect_logs groups lines into entries and writes the ones matching the filter to out.
+// Lines that appear before the first header are treated as their own entry.
+func filter_connect_logs(in io.Reader, out io.Writer, filter LogFilter) (int, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	written := 0
+	var pending *ConnectLogEntry
+	flush := func() error {
+		if pending == nil || !filter.matches(pending) {
+			return nil
+		}
+		written++
+		_, err := fmt.Fprintln(out, redact_text(pending.Raw))
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if entry, ok := parse_connect_log_line(line); ok {
+			if err := flush(); err != nil {
+				return written, err
+			}
+			pending = entry
+			continue
+		}
+		if pending == nil {
+			pending = &ConnectLogEntry{Message: line, Raw: line}
+			continue
+		}
+		pending.Raw += "\n" + line
+	}
+	if err := scanner.Err(); err != nil {
+		return written, err
+	}
+	return written, flush()
+}
+
+func docker_logs_args(container, since string, follow bool) []string {
+	args := []string{"logs"}
+	if since != "" {
+		args = append(args, "--since", since)
+	}
+	if follow {
+		args = append(args, "--follow")
+	}
+	return append(args, container)
+}
+
+func capture_connect_logs(opts LogCaptureOptions) error {
+	if err := validate_log_level(opts.Filter.MinLevel); err != nil {
+		return err
+	}
+
+	dockerCmd := exec.Command("docker", docker_logs_args("kafka-connect", opts.Since, opts.Follow)...)
+	stdout, err := dockerCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	// docker logs replays the container stderr on its own stderr
+	dockerCmd.Stderr = dockerCmd.Stdout
+
+	var out io.Writer = os.Stdout
+	filename := ""
+	if !opts.Follow {
+		filename = opts.Output
+		if filename == "" {
+			filename = fmt.Sprintf("logs/%s_kafka_connect.log", time.Now().Format("20060102_150405"))
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return fmt.Errorf("failed to create log directory: %v", err)
+		}
+		file, err := os.Create(filename)
+		if err != nil {
+			return fmt.Errorf("failed to create log file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := dockerCmd.Start(); err != nil {
+		return fmt.Errorf("failed to execute docker logs: %v", err)
+	}
+
+	written, filterErr := filter_connect_logs(stdout, out, opts.Filter)
+	waitErr := dockerCmd.Wait()
+	if filterErr != nil {
+		return filterErr
+	}
+	if waitErr != nil {
+		return fmt.Errorf("docker logs failed: %v", waitErr)
+	}
+
+	if filename != "" {
+		fmt.Printf("%d log entries saved to %s\n", written, filename)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleConnectLog = `[2024-05-01 10:00:00,001] INFO Kafka Connect started (org.apache.kafka.connect.runtime.Connect:57)
+[2024-05-01 10:00:01,100] INFO [mdb-source|worker] Creating connector mdb-source of type com.mongodb.kafka.connect.MongoSourceConnector (org.apache.kafka.connect.runtime.Worker:312)
+[2024-05-01 10:00:02,200] DEBUG [mdb-source|task-0] Polling change stream (com.mongodb.kafka.connect.source.MongoSourceTask:220)
+[2024-05-01 10:00:03,300] ERROR [mdb-sink|task-0] WorkerSinkTask{id=mdb-sink-0} Task threw an uncaught and unrecoverable exception (org.apache.kafka.connect.runtime.WorkerTask:212)
+org.apache.kafka.connect.errors.ConnectException: Tolerance exceeded in error handler
+	at org.apache.kafka.connect.runtime.errors.RetryWithToleranceOperator.execAndHandleError(RetryWithToleranceOperator.java:230)
+[2024-05-01 10:00:04,400] WARN [mdb-source|task-0] Resume token missing, restarting (com.mongodb.kafka.connect.source.MongoSourceTask:400)
+[2024-05-01 10:00:05,500] INFO Connector mdb-sink config updated (org.apache.kafka.connect.runtime.distributed.DistributedHerder:2102)
+`
+
+func TestParseConnectLogLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		isHeader  bool
+		level     string
+		connector string
+		task      string
+		logger    string
+	}{
+		{
+			name:      "line with connector context",
+			line:      "[2024-05-01 10:00:02,200] DEBUG [mdb-source|task-0] Polling change stream (com.mongodb.kafka.connect.source.MongoSourceTask:220)",
+			isHeader:  true,
+			level:     "DEBUG",
+			connector: "mdb-source",
+			task:      "task-0",
+			logger:    "com.mongodb.kafka.connect.source.MongoSourceTask:220",
+		},
+		{
+			name:     "line without context",
+			line:     "[2024-05-01 10:00:00,001] INFO Kafka Connect started (org.apache.kafka.connect.runtime.Connect:57)",
+			isHeader: true,
+			level:    "INFO",
+			logger:   "org.apache.kafka.connect.runtime.Connect:57",
+		},
+		{
+			name:     "stack trace continuation",
+			line:     "\tat org.apache.kafka.connect.runtime.WorkerTask.run(WorkerTask.java:200)",
+			isHeader: false,
+		},
+		{
+			name:     "exception line",
+			line:     "org.apache.kafka.connect.errors.ConnectException: Tolerance exceeded in error handler",
+			isHeader: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, ok := parse_connect_log_line(tt.line)
+			if ok != tt.isHeader {
+				t.Fatalf("Expected header=%v, got %v", tt.isHeader, ok)
+			}
+			if !ok {
+				return
+			}
+			if entry.Level != tt.level {
+				t.Errorf("Expected level %s, got %s", tt.level, entry.Level)
+			}
+			if entry.Timestamp.Location() != time.UTC {
+				t.Errorf("Expected a UTC timestamp, got %s", entry.Timestamp)
+			}
+			if entry.Connector != tt.connector {
+				t.Errorf("Expected connector %q, got %q", tt.connector, entry.Connector)
+			}
+			if entry.Task != tt.task {
+				t.Errorf("Expected task %q, got %q", tt.task, entry.Task)
+			}
+			if entry.Logger != tt.logger {
+				t.Errorf("Expected logger %q, got %q", tt.logger, entry.Logger)
+			}
+			if entry.Timestamp.IsZero() {
+				t.Error("Expected a parsed timestamp")
+			}
+		})
+	}
+}
+
+func TestFilterConnectLogs(t *testing.T) {
+	tests := []struct {
+		name           string
+		filter         LogFilter
+		expectedCount  int
+		mustContain    []string
+		mustNotContain []string
+	}{
+		{
+			name:          "no filter keeps everything",
+			filter:        LogFilter{},
+			expectedCount: 6,
+		},
+		{
+			name:           "connector context",
+			filter:         LogFilter{Connector: "mdb-source"},
+			expectedCount:  3,
+			mustContain:    []string{"Polling change stream", "Resume token missing"},
+			mustNotContain: []string{"mdb-sink"},
+		},
+		{
+			name:          "connector mentioned by worker thread",
+			filter:        LogFilter{Connector: "mdb-sink"},
+			expectedCount: 2,
+			mustContain:   []string{"Tolerance exceeded", "config updated"},
+		},
+		{
+			name:           "minimum level",
+			filter:         LogFilter{MinLevel: "warn"},
+			expectedCount:  2,
+			mustContain:    []string{"RetryWithToleranceOperator"},
+			mustNotContain: []string{"Kafka Connect started"},
+		},
+		{
+			name:          "grep matches continuation lines",
+			filter:        LogFilter{Grep: regexp.MustCompile(`Tolerance exceeded`)},
+			expectedCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			count, err := filter_connect_logs(strings.NewReader(sampleConnectLog), &out, tt.filter)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if count != tt.expectedCount {
+				t.Errorf("Expected %d entries, got %d:\n%s", tt.expectedCount, count, out.String())
+			}
+			for _, expected := range tt.mustContain {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("Expected output to contain %q", expected)
+				}
+			}
+			for _, unexpected := range tt.mustNotContain {
+				if strings.Contains(out.String(), unexpected) {
+					t.Errorf("Expected output not to contain %q", unexpected)
+				}
+			}
+		})
+	}
+}
+
+func TestDockerLogsArgs(t *testing.T) {
+	args := docker_logs_args("kafka-connect", "10m", true)
+	expected := []string{"logs", "--since", "10m", "--follow", "kafka-connect"}
+	if strings.Join(args, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+
+	args = docker_logs_args("kafka-connect", "", false)
+	if strings.Join(args, " ") != "logs kafka-connect" {
+		t.Errorf("Expected plain logs command, got %v", args)
+	}
+}
+
+func TestValidateLogLevel(t *testing.T) {
+	for _, level := range []string{"", "warn", "ERROR", "trace"} {
+		if err := validate_log_level(level); err != nil {
+			t.Errorf("Level %q should be valid: %v", level, err)
+		}
+	}
+	if err := validate_log_level("verbose"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+}
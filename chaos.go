@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// every chaos action appends its before/after connector status here
+const chaosTimelineFile = "logs/chaos_timeline.log"
+
+// image run in the network namespace of a container to apply tc rules; Connect and Kafka
+// images ship neither tc nor NET_ADMIN
+const chaosNetworkImage = "nicolaka/netshoot"
+
+var chaosBrokers = []string{"kafka1", "kafka2", "kafka3"}
+
+// docker subcommand used for each broker action
+var chaosBrokerActions = map[string]string{
+	"kill":    "kill",
+	"pause":   "pause",
+	"unpause": "unpause",
+	"restart": "restart",
+	"start":   "start",
+}
+
+// summarize_statuses is one line per connector with its task states and workers
+func summarize_statuses(statuses map[string]*ConnectorStatus) []string {
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		status := statuses[name]
+		var tasks []string
+		for _, task := range status.Tasks {
+			tasks = append(tasks, fmt.Sprintf("task %d %s@%s", task.ID, task.State, task.Worker))
+		}
+		line := fmt.Sprintf("%s %s", name, connector_field(status, "state"))
+		if len(tasks) > 0 {
+			line += " [" + strings.Join(tasks, ", ") + "]"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// record_chaos_action runs action between two connector status snapshots taken settle apart
+// and appends the snapshots and the transitions between them to the chaos timeline
+func record_chaos_action(description string, settle time.Duration, action func() error) error {
+	if err := os.MkdirAll("logs", 0755); err != nil {
+		return err
+	}
+	timeline, err := os.OpenFile(chaosTimelineFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open chaos timeline: %v", err)
+	}
+	defer timeline.Close()
+	out := io.MultiWriter(os.Stdout, timeline)
+
+	snapshot := func(label string) map[string]*ConnectorStatus {
+		statuses, err := fetch_connector_statuses()
+		at := time.Now().Format(time.RFC3339)
+		if err != nil {
+			fmt.Fprintf(out, "%s %-10s Kafka Connect unreachable: %v\n", at, label, err)
+			return nil
+		}
+		if len(statuses) == 0 {
+			fmt.Fprintf(out, "%s %-10s no connectors\n", at, label)
+		}
+		for _, line := range summarize_statuses(statuses) {
+			fmt.Fprintf(out, "%s %-10s %s\n", at, label, line)
+		}
+		return statuses
+	}
+
+	before := snapshot("before")
+	fmt.Fprintf(out, "%s %-10s %s\n", time.Now().Format(time.RFC3339), "chaos", description)
+	actionErr := action()
+	if actionErr != nil {
+		fmt.Fprintf(out, "%s %-10s failed: %v\n", time.Now().Format(time.RFC3339), "chaos", actionErr)
+	}
+
+	fmt.Printf("Waiting %s for the connectors to react...\n", settle)
+	time.Sleep(settle)
+	after := snapshot("after")
+	if before != nil && after != nil {
+		for _, transition := range diff_component_statuses(before, after, time.Now()) {
+			fmt.Fprintln(out, transition.String())
+		}
+	}
+	fmt.Fprintln(timeline)
+	fmt.Printf("Timeline appended to %s\n", chaosTimelineFile)
+	return actionErr
+}
+
+// chaos_broker kills, pauses, unpauses, restarts or starts a broker container
+func chaos_broker(action, broker string, settle time.Duration) error {
+	dockerAction, ok := chaosBrokerActions[action]
+	if !ok {
+		return fmt.Errorf("unknown broker action %q (use kill, pause, unpause, restart or start)", action)
+	}
+	valid := false
+	for _, name := range chaosBrokers {
+		valid = valid || name == broker
+	}
+	if !valid {
+		return fmt.Errorf("unknown broker %q (use %s)", broker, strings.Join(chaosBrokers, ", "))
+	}
+	return record_chaos_action(fmt.Sprintf("broker %s %s", action, broker), settle, func() error {
+		return run_docker(dockerAction, broker)
+	})
+}
+
+// chaos_connect_restart restarts a Connect worker container
+func chaos_connect_restart(worker string, settle time.Duration) error {
+	return record_chaos_action("connect restart "+worker, settle, func() error {
+		return run_docker("restart", worker)
+	})
+}
+
+// chaos_mongo_stepdown asks the primary of the MongoDB target to step down
+func chaos_mongo_stepdown(seconds int, settle time.Duration) error {
+	target := resolve_mongo_target()
+	return record_chaos_action(fmt.Sprintf("mongo stepdown %ds", seconds), settle, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var client *mongo.Client
+		var err error
+		if is_local_target(target.URI) {
+			client, _, err = connect_replica_set_primary(ctx, target, local_replica_set_seeds(target.URI))
+		} else {
+			client, err = connect_mongo(ctx, target)
+		}
+		if err != nil {
+			return err
+		}
+		defer client.Disconnect(context.Background())
+
+		before, err := get_mongo_topology(ctx, client)
+		if err != nil {
+			return err
+		}
+		if before.Kind != "replica set" {
+			return fmt.Errorf("the MongoDB target is a %s; stepdown needs a replica set", before.Kind)
+		}
+		err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetStepDown", Value: seconds}}).Err()
+		// the primary closes its connections while stepping down
+		if err != nil && !mongo.IsNetworkError(err) {
+			return fmt.Errorf("replSetStepDown failed: %v", err)
+		}
+		fmt.Printf("Primary %s stepped down for %ds\n", before.Primary, seconds)
+		return nil
+	})
+}
+
+// NetworkFault describes a tc netem rule applied to traffic from one container to others
+type NetworkFault struct {
+	Mode   string // latency, loss, partition or heal
+	Delay  time.Duration
+	Jitter time.Duration
+	Loss   int
+}
+
+// netem_args are the netem parameters of a fault
+func netem_args(fault NetworkFault) ([]string, error) {
+	switch fault.Mode {
+	case "latency":
+		if fault.Delay <= 0 {
+			return nil, fmt.Errorf("latency needs a positive --delay")
+		}
+		args := []string{"delay", fmt.Sprintf("%dms", fault.Delay.Milliseconds())}
+		if fault.Jitter > 0 {
+			args = append(args, fmt.Sprintf("%dms", fault.Jitter.Milliseconds()))
+		}
+		return args, nil
+	case "loss":
+		if fault.Loss <= 0 || fault.Loss > 100 {
+			return nil, fmt.Errorf("loss needs --loss between 1 and 100")
+		}
+		return []string{"loss", fmt.Sprintf("%d%%", fault.Loss)}, nil
+	case "partition":
+		return []string{"loss", "100%"}, nil
+	}
+	return nil, fmt.Errorf("unknown network fault %q (use latency, loss, partition or heal)", fault.Mode)
+}
+
+// tc_commands builds the tc invocations that apply fault to traffic towards ips only: a fourth
+// prio band, which the default priomap never uses, receives the matched traffic and the netem qdisc
+func tc_commands(fault NetworkFault, ips []string) ([][]string, error) {
+	if fault.Mode == "heal" {
+		return [][]string{{"tc", "qdisc", "del", "dev", "eth0", "root"}}, nil
+	}
+	netem, err := netem_args(fault)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no destination addresses")
+	}
+
+	commands := [][]string{
+		{"tc", "qdisc", "add", "dev", "eth0", "root", "handle", "1:", "prio", "bands", "4"},
+		append([]string{"tc", "qdisc", "add", "dev", "eth0", "parent", "1:4", "handle", "40:", "netem"}, netem...),
+	}
+	for _, ip := range ips {
+		commands = append(commands, []string{"tc", "filter", "add", "dev", "eth0", "protocol", "ip", "parent", "1:0", "prio", "4", "u32", "match", "ip", "dst", ip + "/32", "flowid", "1:4"})
+	}
+	return commands, nil
+}
+
+// network_target_ips resolves "mongodb", "kafka" or a container name to the addresses seen from container
+func network_target_ips(container, to string) ([]string, error) {
+	switch to {
+	case "mongodb":
+		// MongoDB runs on the host, reached through the host-gateway entry of the container
+		output, err := exec.Command("docker", "exec", container, "getent", "hosts", replicaSetHostname).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s in %s: %v", replicaSetHostname, container, err)
+		}
+		fields := strings.Fields(string(output))
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s does not resolve in %s", replicaSetHostname, container)
+		}
+		return fields[:1], nil
+	case "kafka":
+		return container_ips(chaosBrokers...)
+	default:
+		return container_ips(to)
+	}
+}
+
+func container_ips(containers ...string) ([]string, error) {
+	var ips []string
+	for _, name := range containers {
+		output, err := exec.Command("docker", "inspect", "-f", "{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}}", name).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %v", name, err)
+		}
+		ips = append(ips, strings.Fields(string(output))...)
+	}
+	return ips, nil
+}
+
+// chaos_network applies or removes a network fault between container and the "to" services
+func chaos_network(fault NetworkFault, container, to string, settle time.Duration) error {
+	var ips []string
+	if fault.Mode != "heal" {
+		var err error
+		if ips, err = network_target_ips(container, to); err != nil {
+			return err
+		}
+	}
+	commands, err := tc_commands(fault, ips)
+	if err != nil {
+		return err
+	}
+
+	description := fmt.Sprintf("network heal %s", container)
+	if fault.Mode != "heal" {
+		netem, _ := netem_args(fault)
+		description = fmt.Sprintf("network %s %s → %s (%s) %s", fault.Mode, container, to, strings.Join(ips, ","), strings.Join(netem, " "))
+	}
+	return record_chaos_action(description, settle, func() error {
+		// replace any previous fault; deleting a missing root qdisc fails harmlessly
+		run_in_network_namespace(container, []string{"tc", "qdisc", "del", "dev", "eth0", "root"})
+		if fault.Mode == "heal" {
+			return nil
+		}
+		for _, command := range commands {
+			if err := run_in_network_namespace(container, command); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func run_in_network_namespace(container string, command []string) error {
+	args := append([]string{"run", "--rm", "--net", "container:" + container, "--cap-add", "NET_ADMIN", chaosNetworkImage}, command...)
+	output, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v %s", strings.Join(command, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func run_docker(args ...string) error {
+	output, err := exec.Command("docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker %s: %v %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTcCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		fault    NetworkFault
+		ips      []string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:  "latency with jitter",
+			fault: NetworkFault{Mode: "latency", Delay: 500 * time.Millisecond, Jitter: 50 * time.Millisecond},
+			ips:   []string{"172.18.0.2", "172.18.0.3"},
+			expected: []string{
+				"tc qdisc add dev eth0 root handle 1: prio bands 4",
+				"tc qdisc add dev eth0 parent 1:4 handle 40: netem delay 500ms 50ms",
+				"tc filter add dev eth0 protocol ip parent 1:0 prio 4 u32 match ip dst 172.18.0.2/32 flowid 1:4",
+				"tc filter add dev eth0 protocol ip parent 1:0 prio 4 u32 match ip dst 172.18.0.3/32 flowid 1:4",
+			},
+		},
+		{
+			name:  "partition",
+			fault: NetworkFault{Mode: "partition"},
+			ips:   []string{"192.168.65.254"},
+			expected: []string{
+				"tc qdisc add dev eth0 root handle 1: prio bands 4",
+				"tc qdisc add dev eth0 parent 1:4 handle 40: netem loss 100%",
+				"tc filter add dev eth0 protocol ip parent 1:0 prio 4 u32 match ip dst 192.168.65.254/32 flowid 1:4",
+			},
+		},
+		{
+			name:     "heal",
+			fault:    NetworkFault{Mode: "heal"},
+			expected: []string{"tc qdisc del dev eth0 root"},
+		},
+		{name: "loss out of range", fault: NetworkFault{Mode: "loss", Loss: 150}, ips: []string{"10.0.0.1"}, wantErr: true},
+		{name: "latency without delay", fault: NetworkFault{Mode: "latency"}, ips: []string{"10.0.0.1"}, wantErr: true},
+		{name: "no destinations", fault: NetworkFault{Mode: "partition"}, wantErr: true},
+		{name: "unknown fault", fault: NetworkFault{Mode: "corrupt"}, ips: []string{"10.0.0.1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands, err := tc_commands(tt.fault, tt.ips)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error state: %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(commands) != len(tt.expected) {
+				t.Fatalf("Expected %d commands, got %v", len(tt.expected), commands)
+			}
+			for i, expected := range tt.expected {
+				if got := strings.Join(commands[i], " "); got != expected {
+					t.Errorf("Command %d: expected %q, got %q", i, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeStatuses(t *testing.T) {
+	statuses := map[string]*ConnectorStatus{
+		"sink":   {Name: "sink", Connector: map[string]interface{}{"state": "RUNNING"}},
+		"source": {Name: "source", Connector: map[string]interface{}{"state": "RUNNING"}, Tasks: []TaskStatus{{ID: 0, State: "FAILED", Worker: "connect:8083"}}},
+	}
+
+	lines := summarize_statuses(statuses)
+	expected := []string{"sink RUNNING", "source RUNNING [task 0 FAILED@connect:8083]"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+}
+
+func TestChaosBrokerValidation(t *testing.T) {
+	if err := chaos_broker("explode", "kafka1", 0); err == nil || !strings.Contains(err.Error(), "unknown broker action") {
+		t.Errorf("Expected an unknown action error, got %v", err)
+	}
+	if err := chaos_broker("kill", "kafka9", 0); err == nil || !strings.Contains(err.Error(), "unknown broker") {
+		t.Errorf("Expected an unknown broker error, got %v", err)
+	}
+}
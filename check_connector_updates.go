@@ -5,74 +5,44 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
-	"regexp"
 	"strings"
-
-	"golang.org/x/mod/semver"
 )
 
 func check_connector_updates(inputVersion string) error {
-	pwd, _ := os.Getwd()
-
-	// Define variables
-	url := "https://repo1.maven.org/maven2/org/mongodb/kafka/mongo-kafka-connect/"
-	downloadDir := filepath.Join(pwd, "volumes")
-	envFile := filepath.Join(pwd, ".env")
-
-	// Get HTML content
-	resp, _ := http.Get(url)
-	body, _ := io.ReadAll(resp.Body)
-	html := string(body)
-
-	// Extract latest version
-	re := regexp.MustCompile(`<a href="(\d*(\.\d+)*)/?"`)
-	matches := re.FindAllStringSubmatch(html, -1)
-	versions := make([]string, len(matches))
-	// semantic version strings must begin with a leading "v", as in "v1.0.0"
-	for i, match := range matches {
-		versions[i] = fmt.Sprintf("v%s", strings.TrimSuffix(match[1], "/"))
-	}
-	// sort versions semmatically
-	semver.Sort(versions)
-	latestVersion := versions[len(versions)-1]
-
-	// clean up v
-	latestVersion = strings.TrimPrefix(latestVersion, "v")
-
-	if len(inputVersion) == 0 {
-		fmt.Printf("MongoDB Kafka connector latest Version: %s\n", latestVersion)
+	repository := connector_repository_url("")
+
+	version := inputVersion
+	if len(version) == 0 {
+		versions, err := remote_connector_versions(repository)
+		if err != nil {
+			// offline: keep the version in use when it is cached, else the newest cached one
+			cached := cached_connector_versions(connectorCacheDir)
+			if len(cached) == 0 {
+				return err
+			}
+			version = cached[len(cached)-1]
+			if inUse := connector_version_in_use(); contains_string(cached, inUse) {
+				version = inUse
+			}
+			fmt.Printf("%v\nUsing cached MongoDB Kafka connector Version: %s\n", err, version)
+		} else {
+			version = versions[len(versions)-1]
+			fmt.Printf("MongoDB Kafka connector latest Version: %s\n", version)
+		}
 	} else {
-		fmt.Printf("Using MongoDB Kafka connector Version: %s\n", inputVersion)
-		latestVersion = inputVersion
-
+		fmt.Printf("Using MongoDB Kafka connector Version: %s\n", version)
 	}
 
-	// Construct download link
-	downloadLink := fmt.Sprintf("%s%s/mongo-kafka-connect-%s-all.jar", url, latestVersion, latestVersion)
-
-	// Check if file exists and download if not
-	filePath := filepath.Join(downloadDir, fmt.Sprintf("mongo-kafka-connect-%s-all.jar", latestVersion))
-	err := download_file(downloadLink, filePath)
-	if err != nil {
-		fmt.Println("Check the list of existing versions: ", url)
+	if _, err := pull_connector_version(version, repository, connectorCacheDir); err != nil {
 		return err
 	}
 
-	// Read current version from .env file
-	envContent, _ := os.ReadFile(envFile)
-	re = regexp.MustCompile(`MONGO_KAFKA_CONNECT_VERSION=(.+)`)
-	match := re.FindStringSubmatch(string(envContent))
-
-	// show match value
-	//fmt.Printf("MONGO_KAFKA_CONNECT_VERSION=%s\n", match[1])
-	//fmt.Printf("I will updated to this =%s\n", latestVersion)
-
-	if len(match) > 1 && match[1] != latestVersion {
-		currentVersion := match[1]
-		fmt.Printf("Updating MONGO_KAFKA_CONNECT_VERSION from %s to %s\n", currentVersion, latestVersion)
-		updatedContent := strings.Replace(string(envContent), currentVersion, latestVersion, 1)
-		os.WriteFile(envFile, []byte(updatedContent), 0644)
+	currentVersion := connector_version_in_use()
+	if currentVersion != version {
+		fmt.Printf("Updating MONGO_KAFKA_CONNECT_VERSION from %s to %s\n", currentVersion, version)
+		if _, err := set_env_value(".env", "MONGO_KAFKA_CONNECT_VERSION", version); err != nil {
+			return err
+		}
 		fmt.Println("Choosen version of mongo-kafka-connect has been downloaded and updated in the .env file.")
 	}
 
@@ -80,15 +50,8 @@ func check_connector_updates(inputVersion string) error {
 }
 
 func download_file(url string, filepath string) error {
-	// Create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
 	// Get the data
-	resp, err := http.Get(url)
+	resp, err := connectorHTTPClient.Get(url)
 	if err != nil {
 		return err
 	}
@@ -99,11 +62,41 @@ func download_file(url string, filepath string) error {
 		return fmt.Errorf("bad status: %s", resp.Status)
 	}
 
-	// Writer the body to file
+	// Write to a temporary file so that a failed download never leaves a partial jar behind
+	out, err := os.Create(filepath + ".part")
+	if err != nil {
+		return err
+	}
 	_, err = io.Copy(out, resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		os.Remove(filepath + ".part")
 		return err
 	}
 
-	return nil
+	return os.Rename(filepath+".part", filepath)
+}
+
+// read_env_file parses KEY=VALUE lines from a .env file, ignoring comments and blank lines
+func read_env_file(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+	return values, nil
 }
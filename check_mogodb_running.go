@@ -3,92 +3,411 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
-	"os/exec"
-	"regexp"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 )
 
+// members are rewritten to this hostname so the Connect containers and the host reach the same addresses
+const replicaSetHostname = "host.docker.internal"
+
+// original replica set config, saved before the first rewrite so `klaunch stop` can restore it
+const replicaSetBackupFile = ".klaunch_replset_backup.json"
+
+// the renamed members must resolve on the host too
+const hostsFile = "/etc/hosts"
+
+const hostsEntry = "127.0.0.1 " + replicaSetHostname
+
+// local addresses probed when the URI lists no hosts; the other members are discovered with hello
+var replicaSetSeeds = []string{"127.0.0.1:27017", "127.0.0.1:27018", "127.0.0.1:27019"}
+
+// check_mongodb_running is the start preflight. A remote target (--mongo-uri, MONGO_URI) is only
+// reported; a local replica set is also reconfigured for the Connect containers.
 func check_mongodb_running() error {
-	// Replica set addresses
-	replSetAddresses := []string{"127.0.0.1:27017/?directConnection=true&serverSelectionTimeoutMS=2000", "127.0.0.1:27018/?directConnection=true&serverSelectionTimeoutMS=2000", "127.0.0.1:27019/?directConnection=true&serverSelectionTimeoutMS=2000"}
-
-	for _, addr := range replSetAddresses {
-		// Attempt to connect to MongoDB
-		clientOptions := options.Client().ApplyURI(fmt.Sprintf("mongodb://%s", addr))
-		client, _ := mongo.Connect(context.Background(), clientOptions)
-		err := client.Ping(context.Background(), nil)
-		if err != nil {
-			return err
-		}
-		var isMasterResult bson.M
-		db := client.Database("admin") // Change "admin" to your target database name
-
-		err = db.RunCommand(context.Background(), bson.D{{Key: "ismaster", Value: true}}).Decode(&isMasterResult)
-		// if isMasterResult is true then print the connections string
-		if isMasterResult["ismaster"] == true {
-			fmt.Printf("Connected to MongoDB at %s\n", addr)
-			// define the script to runn on the primary node
-			script := `
-			var cfg = rs.conf();
-			cfg.members[0].host = "host.docker.internal:27017";
-			cfg.members[1].host = "host.docker.internal:27018";
-			cfg.members[2].host = "host.docker.internal:27019";
-			rs.reconfig(cfg);
-			`
-
-			// find the port number from the connection string
-			port := strings.Trim(regexp.MustCompile(`:\d+`).FindStringSubmatch(addr)[0], ":")
-
-			// Execute the script
-			cmd := exec.Command("mongosh", "--port", port, "--quiet", "--eval", script)
-
-			//print the command
-			//fmt.Println(cmd.Args)
-
-			output, err := cmd.CombinedOutput()
-			if err != nil {
-				fmt.Printf("Output: %s\n", string(output))
+	target := resolve_mongo_target()
+	if !is_local_target(target.URI) {
+		return report_mongo_topology(target)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client, addr, err := connect_replica_set_primary(ctx, target, local_replica_set_seeds(target.URI))
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	fmt.Printf("Connected to MongoDB at %s\n", addr)
+
+	// the reconfig checks that the renamed members resolve, so the entry must exist first
+	if added, err := ensure_hosts_entry(hostsFile); err != nil {
+		fmt.Printf("Warning: could not update %s (%v); add this line to it:\n  %s\n", hostsFile, err, hostsEntry)
+	} else if added {
+		fmt.Printf("Added %q to %s\n", hostsEntry, hostsFile)
+	}
+
+	config, err := get_replica_set_config(ctx, client)
+	if err != nil {
+		return err
+	}
+	updated, changed, err := rewrite_member_hosts(config, replicaSetHostname)
+	if err != nil {
+		return err
+	}
+	if changed {
+		// keep the oldest backup: a previous run may already have rewritten the hosts
+		if _, err := os.Stat(replicaSetBackupFile); os.IsNotExist(err) {
+			if err := save_replica_set_backup(config); err != nil {
 				return err
 			}
+		}
+		if err := reconfigure_replica_set(ctx, client, updated); err != nil {
+			return err
+		}
+		fmt.Printf("Replica set members renamed to %s (original config saved to %s)\n", replicaSetHostname, replicaSetBackupFile)
+	}
 
-			client.Disconnect(context.Background())
-			return nil
+	topology, err := get_mongo_topology(ctx, client)
+	if err != nil {
+		return err
+	}
+	fmt.Println(format_mongo_topology(topology, target.URI))
+	return nil
+}
+
+// ensure_hosts_entry appends hostsEntry to path unless it is there; it reports whether it was added
+func ensure_hosts_entry(path string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if strings.Contains(string(content), hostsEntry) {
+		return false, nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return false, err
+	}
+	if _, err := file.WriteString("\n" + hostsEntry + "\n"); err != nil {
+		file.Close()
+		return false, err
+	}
+	return true, file.Close()
+}
+
+// local_replica_set_seeds maps the hosts of a local URI to 127.0.0.1, keeping their ports
+func local_replica_set_seeds(uri string) []string {
+	cs, err := connstring.Parse(uri)
+	if err != nil {
+		return replicaSetSeeds
+	}
+	var seeds []string
+	for _, host := range cs.Hosts {
+		port := "27017"
+		if _, p, err := net.SplitHostPort(host); err == nil {
+			port = p
 		}
+		seeds = append(seeds, net.JoinHostPort("127.0.0.1", port))
+	}
+	if len(seeds) == 0 {
+		return replicaSetSeeds
+	}
+	return seeds
+}
+
+// connect_direct opens a direct connection to one member, with the credentials and TLS files of target
+func connect_direct(ctx context.Context, target MongoTarget, addr string) (*mongo.Client, error) {
+	opts, err := target.client_options()
+	if err != nil {
+		return nil, err
+	}
+	opts.SetHosts([]string{addr}).SetDirect(true).SetServerSelectionTimeout(2 * time.Second)
+	opts.ReplicaSet = nil
+	return connect_mongo_options(ctx, opts)
+}
+
+// connect_replica_set_primary finds a reachable member among seeds and follows hello to the primary,
+// which is contacted on 127.0.0.1 with the port it advertises
+func connect_replica_set_primary(ctx context.Context, target MongoTarget, seeds []string) (*mongo.Client, string, error) {
+	var lastErr error
+	for _, seed := range seeds {
+		client, err := connect_direct(ctx, target, seed)
 		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		var hello bson.M
+		if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
 			client.Disconnect(context.Background())
-			return fmt.Errorf("failed to run ismaster command: %v", err)
+			lastErr = fmt.Errorf("failed to run hello: %v", err)
+			continue
+		}
+		if hello["setName"] == nil {
+			client.Disconnect(context.Background())
+			return nil, "", fmt.Errorf("MongoDB at %s is not a replica set member", seed)
+		}
+		if hello["isWritablePrimary"] == true {
+			return client, seed, nil
+		}
+		client.Disconnect(context.Background())
+
+		primary, _ := hello["primary"].(string)
+		if primary == "" {
+			lastErr = fmt.Errorf("replica set %v has no primary", hello["setName"])
+			continue
+		}
+		_, port, err := net.SplitHostPort(primary)
+		if err != nil {
+			return nil, "", fmt.Errorf("unexpected primary address %q: %v", primary, err)
+		}
+		addr := net.JoinHostPort("127.0.0.1", port)
+		client, err = connect_direct(ctx, target, addr)
+		if err != nil {
+			return nil, "", fmt.Errorf("primary %s is not reachable at %s: %v", primary, addr, err)
 		}
+		return client, addr, nil
 	}
 
-	// Read the current hosts file
-	content, err := os.ReadFile("/etc/hosts")
-	if err != nil {
-		fmt.Println("Error reading hosts file:", err)
-		return err
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no replica set seeds configured")
 	}
+	return nil, "", lastErr
+}
 
-	// Convert content to string
-	contentStr := string(content)
+func get_replica_set_config(ctx context.Context, client *mongo.Client) (bson.M, error) {
+	var result struct {
+		Config bson.M `bson:"config"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetConfig", Value: 1}}).Decode(&result); err != nil {
+		return nil, fmt.Errorf("replSetGetConfig failed: %v", err)
+	}
+	return result.Config, nil
+}
+
+func replica_set_members(config bson.M) ([]bson.M, error) {
+	members, ok := config["members"].(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("replica set config has no members")
+	}
+	result := make([]bson.M, 0, len(members))
+	for _, member := range members {
+		m, ok := member.(bson.M)
+		if !ok {
+			return nil, fmt.Errorf("unexpected member entry %v", member)
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// copy_replica_set_config copies the members so rewriting them leaves the original untouched
+func copy_replica_set_config(config bson.M) (bson.M, []bson.M, error) {
+	members, err := replica_set_members(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	copied := make(bson.M, len(config))
+	for key, value := range config {
+		copied[key] = value
+	}
+	copiedMembers := make(bson.A, len(members))
+	result := make([]bson.M, len(members))
+	for i, member := range members {
+		m := make(bson.M, len(member))
+		for key, value := range member {
+			m[key] = value
+		}
+		copiedMembers[i] = m
+		result[i] = m
+	}
+	copied["members"] = copiedMembers
+	return copied, result, nil
+}
 
-	// Check if the entry exists
-	if !strings.Contains(contentStr, "127.0.0.1 host.docker.internal") {
-		// Entry does not exist, append it
-		newContent := contentStr + "\n127.0.0.1 host.docker.internal"
+// rewrite_member_hosts points every member at hostname, keeping its port
+func rewrite_member_hosts(config bson.M, hostname string) (bson.M, bool, error) {
+	updated, members, err := copy_replica_set_config(config)
+	if err != nil {
+		return nil, false, err
+	}
 
-		// Write the new content back to the hosts file
-		err = os.WriteFile("/etc/hosts", []byte(newContent), 0644)
+	changed := false
+	ports := make(map[string]string)
+	for _, member := range members {
+		host, _ := member["host"].(string)
+		_, port, err := net.SplitHostPort(host)
 		if err != nil {
-			fmt.Println("Error appending to hosts file:", err)
-			return err
+			return nil, false, fmt.Errorf("unexpected member host %q: %v", host, err)
+		}
+		if other, ok := ports[port]; ok {
+			return nil, false, fmt.Errorf("members %s and %s share port %s; each member needs its own host port", other, host, port)
+		}
+		ports[port] = host
+
+		target := net.JoinHostPort(hostname, port)
+		if host != target {
+			member["host"] = target
+			changed = true
 		}
-		fmt.Println("Entry appended successfully.")
+	}
+	return updated, changed, nil
+}
+
+// restore_member_hosts puts back the hosts of original on the current config, matching members by _id
+func restore_member_hosts(current, original bson.M) (bson.M, error) {
+	updated, members, err := copy_replica_set_config(current)
+	if err != nil {
+		return nil, err
+	}
+	originalMembers, err := replica_set_members(original)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Println("Successfully connected to MongoDB")
+	hosts := make(map[string]interface{}, len(originalMembers))
+	for _, member := range originalMembers {
+		hosts[fmt.Sprint(member["_id"])] = member["host"]
+	}
+	for _, member := range members {
+		host, ok := hosts[fmt.Sprint(member["_id"])]
+		if !ok {
+			return nil, fmt.Errorf("member %v is not in the saved config", member["_id"])
+		}
+		member["host"] = host
+	}
+	return updated, nil
+}
+
+// reconfigure_replica_set bumps the config version and applies it with replSetReconfig
+func reconfigure_replica_set(ctx context.Context, client *mongo.Client, config bson.M) error {
+	switch version := config["version"].(type) {
+	case int32:
+		config["version"] = version + 1
+	case int64:
+		config["version"] = version + 1
+	case float64:
+		config["version"] = version + 1
+	default:
+		return fmt.Errorf("unexpected replica set config version %v", config["version"])
+	}
+	// the term is managed by the server
+	delete(config, "term")
+
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetReconfig", Value: config}}).Err(); err != nil {
+		return fmt.Errorf("replSetReconfig failed: %v", err)
+	}
 	return nil
 }
+
+func save_replica_set_backup(config bson.M) error {
+	content, err := bson.MarshalExtJSONIndent(config, true, false, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(replicaSetBackupFile, content, 0644); err != nil {
+		return fmt.Errorf("failed to save replica set config: %v", err)
+	}
+	return nil
+}
+
+func load_replica_set_backup() (bson.M, error) {
+	content, err := os.ReadFile(replicaSetBackupFile)
+	if err != nil {
+		return nil, err
+	}
+	var config bson.M
+	if err := bson.UnmarshalExtJSON(content, true, &config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", replicaSetBackupFile, err)
+	}
+	return config, nil
+}
+
+// restore_replica_set applies the member hostnames saved before klaunch renamed them.
+// It does nothing when no backup exists.
+func restore_replica_set() error {
+	original, err := load_replica_set_backup()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	members, err := replica_set_members(original)
+	if err != nil {
+		return err
+	}
+	var seeds []string
+	for _, member := range members {
+		if host, ok := member["host"].(string); ok {
+			if _, port, err := net.SplitHostPort(host); err == nil {
+				seeds = append(seeds, net.JoinHostPort("127.0.0.1", port))
+			}
+		}
+	}
+
+	client, _, err := connect_replica_set_primary(ctx, resolve_mongo_target(), seeds)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	current, err := get_replica_set_config(ctx, client)
+	if err != nil {
+		return err
+	}
+	restored, err := restore_member_hosts(current, original)
+	if err != nil {
+		return err
+	}
+	if err := reconfigure_replica_set(ctx, client, restored); err != nil {
+		return err
+	}
+	fmt.Printf("Replica set members restored to %s\n", describe_replica_set_hosts(restored))
+	return os.Remove(replicaSetBackupFile)
+}
+
+// describe_replica_set_hosts lists member hosts, for messages
+func describe_replica_set_hosts(config bson.M) string {
+	members, err := replica_set_members(config)
+	if err != nil {
+		return ""
+	}
+	var hosts []string
+	for _, member := range members {
+		hosts = append(hosts, fmt.Sprint(member["host"]))
+	}
+	return strings.Join(hosts, ", ")
+}
+
+// connect_mongo opens a client for target and verifies the deployment is reachable
+func connect_mongo(ctx context.Context, target MongoTarget) (*mongo.Client, error) {
+	opts, err := target.client_options()
+	if err != nil {
+		return nil, err
+	}
+	return connect_mongo_options(ctx, opts)
+}
+
+func connect_mongo_options(ctx context.Context, opts *options.ClientOptions) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MongoDB client: %s", redact_text(err.Error()))
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("failed to reach MongoDB: %s", redact_text(err.Error()))
+	}
+	return client, nil
+}
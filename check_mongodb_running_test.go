@@ -187,6 +187,43 @@ func TestHostsFileModification(t *testing.T) {
 	}
 }
 
+func TestEnsureHostsEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		missing bool
+		added   bool
+		wantErr bool
+	}{
+		{name: "missing entry", content: "127.0.0.1 localhost\n", added: true},
+		{name: "existing entry", content: "127.0.0.1 localhost\n127.0.0.1 host.docker.internal\n"},
+		{name: "no hosts file", missing: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hosts")
+			if !tt.missing {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("Failed to create test hosts file: %v", err)
+				}
+			}
+
+			added, err := ensure_hosts_entry(path)
+			if (err != nil) != tt.wantErr || added != tt.added {
+				t.Fatalf("Expected added=%t and error=%t, got %t, %v", tt.added, tt.wantErr, added, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			content, _ := os.ReadFile(path)
+			if count := strings.Count(string(content), hostsEntry); count != 1 {
+				t.Errorf("Expected the entry once, got %d in:\n%s", count, content)
+			}
+		})
+	}
+}
+
 func TestReplicaSetConfiguration(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -316,3 +353,104 @@ func TestMongoDBConnectionWorkflow(t *testing.T) {
 }
 
 // Benchmark tests moved to benchmarks_test.go to avoid duplication
+
+func test_replica_set_config(hosts ...string) bson.M {
+	members := bson.A{}
+	for i, host := range hosts {
+		members = append(members, bson.M{"_id": int32(i), "host": host, "priority": 1.0})
+	}
+	return bson.M{"_id": "replset", "version": int32(3), "term": int64(7), "members": members}
+}
+
+func TestRewriteMemberHosts(t *testing.T) {
+	original := test_replica_set_config("mongo1:27017", "localhost:27018", "localhost:27019", "localhost:27020")
+
+	updated, changed, err := rewrite_member_hosts(original, replicaSetHostname)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !changed {
+		t.Error("Expected the hosts to change")
+	}
+	expected := "host.docker.internal:27017, host.docker.internal:27018, host.docker.internal:27019, host.docker.internal:27020"
+	if hosts := describe_replica_set_hosts(updated); hosts != expected {
+		t.Errorf("Expected %s, got %s", expected, hosts)
+	}
+	if hosts := describe_replica_set_hosts(original); !strings.HasPrefix(hosts, "mongo1:27017") {
+		t.Errorf("The original config should be left untouched, got %s", hosts)
+	}
+
+	if _, changed, _ := rewrite_member_hosts(updated, replicaSetHostname); changed {
+		t.Error("Rewriting an already rewritten config should be a no-op")
+	}
+
+	if _, _, err := rewrite_member_hosts(test_replica_set_config("mongo1:27017", "mongo2:27017"), replicaSetHostname); err == nil {
+		t.Error("Expected an error when members share a port")
+	}
+}
+
+func TestRestoreMemberHosts(t *testing.T) {
+	original := test_replica_set_config("localhost:27017", "localhost:27018", "localhost:27019")
+	current, _, _ := rewrite_member_hosts(original, replicaSetHostname)
+	current["version"] = int32(4)
+
+	restored, err := restore_member_hosts(current, original)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if hosts := describe_replica_set_hosts(restored); hosts != "localhost:27017, localhost:27018, localhost:27019" {
+		t.Errorf("Unexpected hosts after restore: %s", hosts)
+	}
+	if restored["version"] != int32(4) {
+		t.Errorf("Expected the current version to be kept, got %v", restored["version"])
+	}
+
+	if _, err := restore_member_hosts(test_replica_set_config("a:1", "b:2", "c:3", "d:4"), original); err == nil {
+		t.Error("Expected an error for a member missing from the saved config")
+	}
+}
+
+func TestReconfigureReplicaSet(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("bumps version and drops term", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		config := test_replica_set_config("host.docker.internal:27017")
+
+		if err := reconfigure_replica_set(context.Background(), mt.Client, config); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		event := mt.GetStartedEvent()
+		if event == nil || event.CommandName != "replSetReconfig" {
+			t.Fatalf("Expected replSetReconfig, got %v", event)
+		}
+		sent := event.Command.Lookup("replSetReconfig")
+		if version := sent.Document().Lookup("version").Int32(); version != 4 {
+			t.Errorf("Expected version 4, got %d", version)
+		}
+		if _, err := sent.Document().LookupErr("term"); err == nil {
+			t.Error("term should not be sent")
+		}
+	})
+}
+
+func TestReplicaSetBackupRoundTrip(t *testing.T) {
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+
+	original := test_replica_set_config("localhost:27017", "localhost:27018")
+	if err := save_replica_set_backup(original); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	loaded, err := load_replica_set_backup()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if describe_replica_set_hosts(loaded) != describe_replica_set_hosts(original) {
+		t.Errorf("Expected %s, got %s", describe_replica_set_hosts(original), describe_replica_set_hosts(loaded))
+	}
+	if loaded["version"] != int32(3) {
+		t.Errorf("Expected the version type to survive the round trip, got %T", loaded["version"])
+	}
+}
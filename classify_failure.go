@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// directory holding the known-issue rule files, one JSON document per file
+const failureRulesDir = "./failure_rules"
+
+// FailureRule describes a known connector or Connect failure and how to fix it
+type FailureRule struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Patterns    []string `json:"patterns"`
+	Cause       string   `json:"cause"`
+	Remediation string   `json:"remediation"`
+	References  []string `json:"references"`
+	// Fallback rules match generic wrapper errors and only apply when nothing more specific does
+	Fallback bool `json:"fallback"`
+
+	source   string
+	compiled []*regexp.Regexp
+}
+
+type failureRuleFile struct {
+	Rules []FailureRule `json:"rules"`
+}
+
+var (
+	loadFailureRulesOnce sync.Once
+	loadedFailureRules   []FailureRule
+)
+
+// load_failure_rules reads every *.json rule file in dir, in file name order
+func load_failure_rules(dir string) ([]FailureRule, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var rules []FailureRule
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		var ruleFile failureRuleFile
+		if err := json.Unmarshal(content, &ruleFile); err != nil {
+			return nil, fmt.Errorf("failed to parse rule file %s: %v", file, err)
+		}
+
+		for _, rule := range ruleFile.Rules {
+			if rule.ID == "" || len(rule.Patterns) == 0 {
+				return nil, fmt.Errorf("rule file %s: every rule needs an id and at least one pattern", file)
+			}
+			for _, pattern := range rule.Patterns {
+				re, err := regexp.Compile("(?i)" + pattern)
+				if err != nil {
+					return nil, fmt.Errorf("rule %s in %s: invalid pattern %q: %v", rule.ID, file, pattern, err)
+				}
+				rule.compiled = append(rule.compiled, re)
+			}
+			rule.source = filepath.Base(file)
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+// failure_rules returns the shipped rules, loading them on first use
+func failure_rules() []FailureRule {
+	loadFailureRulesOnce.Do(func() {
+		rules, err := load_failure_rules(failureRulesDir)
+		if err != nil {
+			fmt.Println("Warning: could not load failure rules:", err)
+			return
+		}
+		loadedFailureRules = rules
+	})
+	return loadedFailureRules
+}
+
+// classify_failure_trace returns the first specific rule matching the trace,
+// falling back to generic rules, or nil when nothing matches
+func classify_failure_trace(trace string, rules []FailureRule) *FailureRule {
+	if strings.TrimSpace(trace) == "" {
+		return nil
+	}
+
+	var fallback *FailureRule
+	for i := range rules {
+		rule := &rules[i]
+		for _, re := range rule.compiled {
+			if !re.MatchString(trace) {
+				continue
+			}
+			if !rule.Fallback {
+				return rule
+			}
+			if fallback == nil {
+				fallback = rule
+			}
+			break
+		}
+	}
+	return fallback
+}
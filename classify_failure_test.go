@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShippedFailureRulesLoad(t *testing.T) {
+	rules, err := load_failure_rules(failureRulesDir)
+	if err != nil {
+		t.Fatalf("Failed to load shipped rules: %v", err)
+	}
+	if len(rules) == 0 {
+		t.Fatal("Expected shipped rules, got none")
+	}
+
+	seen := make(map[string]string)
+	for _, rule := range rules {
+		if previous, ok := seen[rule.ID]; ok {
+			t.Errorf("Duplicate rule id %s in %s and %s", rule.ID, previous, rule.source)
+		}
+		seen[rule.ID] = rule.source
+		if rule.Cause == "" || rule.Remediation == "" {
+			t.Errorf("Rule %s should have a cause and a remediation", rule.ID)
+		}
+	}
+}
+
+func TestClassifyFailureTrace(t *testing.T) {
+	rules, err := load_failure_rules(failureRulesDir)
+	if err != nil {
+		t.Fatalf("Failed to load shipped rules: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		trace      string
+		expectedID string
+	}{
+		{
+			name: "resume token lost",
+			trace: `org.apache.kafka.connect.errors.ConnectException: Tolerance exceeded in error handler
+Caused by: com.mongodb.MongoCommandException: Command failed with error 286 (ChangeStreamHistoryLost): 'Resume of change stream was not possible, as the resume point may no longer be in the oplog.'`,
+			expectedID: "resume-token-not-found",
+		},
+		{
+			name:       "immutable _id with BsonOidStrategy",
+			trace:      `com.mongodb.MongoBulkWriteException: Bulk write operation error on server host.docker.internal:27017. Write errors: [BulkWriteError{index=0, code=66, message='Performing an update on the path '_id' would modify the immutable field '_id''}]`,
+			expectedID: "bson-oid-strategy-non-objectid",
+		},
+		{
+			name:       "schemas enable mismatch",
+			trace:      `org.apache.kafka.connect.errors.DataException: JsonConverter with schemas.enable requires "schema" and "payload" fields and may not contain additional fields.`,
+			expectedID: "json-converter-schemas-enable",
+		},
+		{
+			name:       "oversized record",
+			trace:      `org.apache.kafka.common.errors.RecordTooLargeException: The message is 2097152 bytes when serialized which is larger than 1048576`,
+			expectedID: "record-too-large",
+		},
+		{
+			name:       "generic tolerance error falls back",
+			trace:      `org.apache.kafka.connect.errors.ConnectException: Tolerance exceeded in error handler`,
+			expectedID: "error-tolerance-exceeded",
+		},
+		{
+			name:       "unknown failure",
+			trace:      `java.lang.IllegalStateException: something unexpected`,
+			expectedID: "",
+		},
+		{
+			name:       "empty trace",
+			trace:      "",
+			expectedID: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := classify_failure_trace(tt.trace, rules)
+			if tt.expectedID == "" {
+				if rule != nil {
+					t.Errorf("Expected no match, got %s", rule.ID)
+				}
+				return
+			}
+			if rule == nil {
+				t.Fatalf("Expected rule %s, got no match", tt.expectedID)
+			}
+			if rule.ID != tt.expectedID {
+				t.Errorf("Expected rule %s, got %s", tt.expectedID, rule.ID)
+			}
+		})
+	}
+}
+
+func TestLoadFailureRulesErrors(t *testing.T) {
+	tu := NewTestUtils(t)
+
+	tests := []struct {
+		name          string
+		content       string
+		errorContains string
+	}{
+		{
+			name:          "invalid json",
+			content:       `{"rules": [`,
+			errorContains: "failed to parse",
+		},
+		{
+			name:          "missing patterns",
+			content:       `{"rules": [{"id": "no-patterns"}]}`,
+			errorContains: "at least one pattern",
+		},
+		{
+			name:          "invalid regex",
+			content:       `{"rules": [{"id": "bad-regex", "patterns": ["(unclosed"]}]}`,
+			errorContains: "invalid pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tu.CreateJSONFile(dir, "team_rules.json", tt.content)
+
+			_, err := load_failure_rules(dir)
+			if err == nil {
+				t.Fatal("Expected error but got none")
+			}
+			if !strings.Contains(err.Error(), tt.errorContains) {
+				t.Errorf("Expected error containing %q, got %v", tt.errorContains, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// base compose file; overlays are layered on top of it with -f
+const baseComposeFile = "docker-compose.yaml"
+
+// ComposeOptions selects the compose overlays `klaunch start` layers on docker-compose.yaml
+type ComposeOptions struct {
+	MongoTopology  string
+	ConnectWorkers int
+	Kraft          string // "", combined or dedicated
+	Security       string // "", plaintext, sasl-scram, sasl-plain or mtls
+}
+
+// compose_base_file is the file the overlays of opts are layered on
+func compose_base_file(opts ComposeOptions) string {
+	if opts.Kraft != "" {
+		return kraftComposeFile
+	}
+	return baseComposeFile
+}
+
+// compose_files lists the compose files for opts, base file first; nil means the default file only
+func compose_files(opts ComposeOptions) ([]string, error) {
+	base := compose_base_file(opts)
+	if opts.Kraft != "" {
+		if _, err := kraft_nodes(opts.Kraft); err != nil {
+			return nil, err
+		}
+	}
+
+	var overlays []string
+	switch opts.MongoTopology {
+	case "", "replicaset":
+	case "sharded":
+		overlays = append(overlays, shardedComposeFile)
+	default:
+		return nil, fmt.Errorf("unknown MongoDB topology %q (use replicaset or sharded)", opts.MongoTopology)
+	}
+
+	if opts.ConnectWorkers < 1 || opts.ConnectWorkers > maxConnectWorkers {
+		return nil, fmt.Errorf("--connect-workers must be between 1 and %d", maxConnectWorkers)
+	}
+	if opts.ConnectWorkers > 1 {
+		overlays = append(overlays, connectWorkersComposeFile)
+	}
+
+	if err := validate_security_mode(opts.Security); err != nil {
+		return nil, err
+	}
+	// last, so that it also secures the added Connect workers
+	if is_secured(opts.Security) {
+		overlays = append(overlays, securityComposeFile)
+	}
+
+	if base == baseComposeFile && len(overlays) == 0 {
+		return nil, nil
+	}
+	return append([]string{base}, overlays...), nil
+}
+
+// compose_up_args are the docker compose arguments of `klaunch start`
+func compose_up_args(opts ComposeOptions) ([]string, error) {
+	files, err := compose_files(opts)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"-p", "klaunch"}
+	for _, file := range files {
+		args = append(args, "-f", file)
+	}
+	return append(args, "up", "-d"), nil
+}
+
+// write_compose_overlays generates the compose files that depend on the options
+func write_compose_overlays(opts ComposeOptions) error {
+	if opts.Kraft != "" {
+		content, err := render_kraft_compose(opts.Kraft)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(kraftComposeFile, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", kraftComposeFile, err)
+		}
+	}
+	if opts.ConnectWorkers > 1 {
+		content, err := render_connect_workers_compose(opts.ConnectWorkers, compose_base_file(opts))
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(connectWorkersComposeFile, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", connectWorkersComposeFile, err)
+		}
+	}
+	if is_secured(opts.Security) {
+		if err := write_security_material(securitySecretsDir, opts.Security); err != nil {
+			return err
+		}
+		content, err := render_security_compose(opts)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(securityComposeFile, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", securityComposeFile, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComposeUpArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     ComposeOptions
+		expected string
+		wantErr  bool
+	}{
+		{name: "default", opts: ComposeOptions{ConnectWorkers: 1}, expected: "-p klaunch up -d"},
+		{name: "replicaset", opts: ComposeOptions{MongoTopology: "replicaset", ConnectWorkers: 1}, expected: "-p klaunch up -d"},
+		{name: "sharded", opts: ComposeOptions{MongoTopology: "sharded", ConnectWorkers: 1}, expected: "-p klaunch -f docker-compose.yaml -f docker-compose.mongo-sharded.yaml up -d"},
+		{name: "connect workers", opts: ComposeOptions{ConnectWorkers: 3}, expected: "-p klaunch -f docker-compose.yaml -f docker-compose.connect-workers.yaml up -d"},
+		{
+			name:     "sharded with connect workers",
+			opts:     ComposeOptions{MongoTopology: "sharded", ConnectWorkers: 2},
+			expected: "-p klaunch -f docker-compose.yaml -f docker-compose.mongo-sharded.yaml -f docker-compose.connect-workers.yaml up -d",
+		},
+		{name: "kraft", opts: ComposeOptions{Kraft: "combined", ConnectWorkers: 1}, expected: "-p klaunch -f docker-compose.kraft.yaml up -d"},
+		{
+			name:     "kraft with connect workers",
+			opts:     ComposeOptions{Kraft: "dedicated", ConnectWorkers: 2},
+			expected: "-p klaunch -f docker-compose.kraft.yaml -f docker-compose.connect-workers.yaml up -d",
+		},
+		{
+			name:     "secured",
+			opts:     ComposeOptions{Security: "sasl-scram", ConnectWorkers: 2},
+			expected: "-p klaunch -f docker-compose.yaml -f docker-compose.connect-workers.yaml -f docker-compose.security.yaml up -d",
+		},
+		{name: "plaintext", opts: ComposeOptions{Security: "plaintext", ConnectWorkers: 1}, expected: "-p klaunch up -d"},
+		{name: "unknown security", opts: ComposeOptions{Security: "kerberos", ConnectWorkers: 1}, wantErr: true},
+		{name: "unknown kraft mode", opts: ComposeOptions{Kraft: "zookeeper", ConnectWorkers: 1}, wantErr: true},
+		{name: "unknown topology", opts: ComposeOptions{MongoTopology: "standalone", ConnectWorkers: 1}, wantErr: true},
+		{name: "too many workers", opts: ComposeOptions{ConnectWorkers: maxConnectWorkers + 1}, wantErr: true},
+		{name: "no workers", opts: ComposeOptions{}, wantErr: true},
+		{name: "negative workers", opts: ComposeOptions{ConnectWorkers: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := compose_up_args(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error state: %v", err)
+			}
+			if !tt.wantErr && strings.Join(args, " ") != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, strings.Join(args, " "))
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// compose overlay generated by `klaunch start --connect-workers N`
+const connectWorkersComposeFile = "docker-compose.connect-workers.yaml"
+
+// workers publish their REST port on 8083 upwards; 8091 is taken by the broker JMX exporters
+const maxConnectWorkers = 8
+
+const firstConnectRestPort = 8083
+
+// connect_worker_container is the container name of worker i, starting at 1
+func connect_worker_container(i int) string {
+	if i == 1 {
+		return "kafka-connect"
+	}
+	return fmt.Sprintf("kafka-connect-%d", i)
+}
+
+func connect_worker_port(i int) int {
+	return firstConnectRestPort + i - 1
+}
+
+// connect_worker_id is the worker_id Connect reports in task statuses
+func connect_worker_id(i int) string {
+	return fmt.Sprintf("%s:%d", connect_worker_container(i), connect_worker_port(i))
+}
+
+type connectWorker struct {
+	Name    string
+	Port    int
+	JMXPort int
+}
+
+type connectWorkersCompose struct {
+	Base    string
+	Workers []connectWorker
+}
+
+// connect_worker_jmx_port is the host port of the JMX exporter of worker i; worker 1 uses the 8095 of docker-compose.yaml
+func connect_worker_jmx_port(i int) int {
+	return 8095 + i - 1
+}
+
+// Workers 2..N extend the kafka-connect service of the base compose file and only change their host name,
+// REST port and published JMX exporter port. Worker 1 is made to advertise a resolvable host name so requests
+// can be forwarded to the leader. !override needs Docker Compose 2.24.4 or later.
+var connectWorkersTemplate = template.Must(template.New("connect-workers").Parse(`---
+# Generated by ` + "`klaunch start --connect-workers {{len .Workers}}`" + `; do not edit.
+version: '3'
+services:
+  kafka-connect:
+    environment:
+      CONNECT_REST_ADVERTISED_HOST_NAME: "kafka-connect"
+      CONNECT_SCHEDULED_REBALANCE_MAX_DELAY_MS: ${CONNECT_SCHEDULED_REBALANCE_MAX_DELAY_MS:-300000}
+{{range .Workers}}
+  {{.Name}}:
+    extends:
+      file: {{$.Base}}
+      service: kafka-connect
+    hostname: {{.Name}}
+    container_name: {{.Name}}
+    depends_on: !override
+      - kafka-connect
+    ports: !override
+      - {{.Port}}:{{.Port}}
+      - {{.JMXPort}}:8091
+    environment:
+      CONNECT_REST_ADVERTISED_HOST_NAME: "{{.Name}}"
+      CONNECT_REST_PORT: {{.Port}}
+      CONNECT_SCHEDULED_REBALANCE_MAX_DELAY_MS: ${CONNECT_SCHEDULED_REBALANCE_MAX_DELAY_MS:-300000}
+{{end}}`))
+
+// render_connect_workers_compose generates the overlay adding workers 2..n to the Connect group of base
+func render_connect_workers_compose(n int, base string) (string, error) {
+	if n < 2 || n > maxConnectWorkers {
+		return "", fmt.Errorf("--connect-workers must be between 1 and %d", maxConnectWorkers)
+	}
+	compose := connectWorkersCompose{Base: base}
+	for i := 2; i <= n; i++ {
+		compose.Workers = append(compose.Workers, connectWorker{
+			Name:    connect_worker_container(i),
+			Port:    connect_worker_port(i),
+			JMXPort: connect_worker_jmx_port(i),
+		})
+	}
+	var b strings.Builder
+	if err := connectWorkersTemplate.Execute(&b, compose); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// running_connect_workers returns the running Connect worker numbers, in order
+func running_connect_workers() ([]int, error) {
+	output, err := exec.Command("docker", "ps", "--filter", "name=kafka-connect", "--format", "{{.Names}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Connect workers: %v", err)
+	}
+	var workers []int
+	for _, name := range strings.Fields(string(output)) {
+		for i := 1; i <= maxConnectWorkers; i++ {
+			if name == connect_worker_container(i) {
+				workers = append(workers, i)
+			}
+		}
+	}
+	sort.Ints(workers)
+	return workers, nil
+}
+
+// format_worker_assignments groups connectors and tasks by the worker running them; workers are
+// listed in the given order, idle ones included, followed by any other worker the statuses name
+func format_worker_assignments(statuses map[string]*ConnectorStatus, workers []string) string {
+	names := append([]string{}, workers...)
+	assigned := make(map[string][]assignment)
+	for _, worker := range workers {
+		assigned[worker] = nil
+	}
+	var others []string
+	for _, line := range summarize_assignments(statuses) {
+		if _, ok := assigned[line.worker]; !ok {
+			others = append(others, line.worker)
+		}
+		assigned[line.worker] = append(assigned[line.worker], line)
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	var b strings.Builder
+	b.WriteString("Workers:\n")
+	for i, worker := range names {
+		branch, indent := "├──", "│   "
+		if i == len(names)-1 {
+			branch, indent = "└──", "    "
+		}
+		tasks := 0
+		for _, line := range assigned[worker] {
+			if line.task {
+				tasks++
+			}
+		}
+		fmt.Fprintf(&b, "%s %s (%d tasks)\n", branch, worker, tasks)
+		if len(assigned[worker]) == 0 {
+			fmt.Fprintf(&b, "%s└── idle\n", indent)
+		}
+		for j, line := range assigned[worker] {
+			item := "├──"
+			if j == len(assigned[worker])-1 {
+				item = "└──"
+			}
+			fmt.Fprintf(&b, "%s%s %s\n", indent, item, line.text)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+type assignment struct {
+	worker string
+	text   string
+	task   bool
+}
+
+func summarize_assignments(statuses map[string]*ConnectorStatus) []assignment {
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []assignment
+	for _, name := range names {
+		status := statuses[name]
+		if worker := connector_field(status, "worker_id"); worker != "" {
+			result = append(result, assignment{worker, fmt.Sprintf("%s (connector) %s", name, connector_field(status, "state")), false})
+		}
+		for _, task := range status.Tasks {
+			result = append(result, assignment{task.Worker, fmt.Sprintf("%s task %d %s", name, task.ID, task.State), true})
+		}
+	}
+	return result
+}
+
+// list_worker_assignments prints the worker grouping; unless always is set, only when more
+// than one worker is running
+func list_worker_assignments(always bool) error {
+	workers, err := running_connect_workers()
+	if err != nil || (len(workers) < 2 && !always) {
+		return err
+	}
+	statuses, err := fetch_connector_statuses()
+	if err != nil {
+		return err
+	}
+	// a single worker advertises the host name of docker-compose.yaml, so list what it reports
+	var ids []string
+	if len(workers) > 1 {
+		for _, i := range workers {
+			ids = append(ids, connect_worker_id(i))
+		}
+	}
+	fmt.Println(format_worker_assignments(statuses, ids))
+	return nil
+}
+
+// worker_connector_statuses reads every connector status through the REST port of one worker
+func worker_connector_statuses(port int) (map[string]*ConnectorStatus, error) {
+	raw, err := connect_worker_rest_get(port, "/connectors?expand=status")
+	if err != nil {
+		return nil, err
+	}
+	var expanded map[string]struct {
+		Status ConnectorStatus `json:"status"`
+	}
+	if err := json.Unmarshal(raw, &expanded); err != nil {
+		return nil, fmt.Errorf("failed to parse connector statuses: %v", err)
+	}
+	statuses := make(map[string]*ConnectorStatus, len(expanded))
+	for name, entry := range expanded {
+		status := entry.Status
+		statuses[name] = &status
+	}
+	return statuses, nil
+}
+
+// tasks_on_worker lists the tasks assigned to worker
+func tasks_on_worker(statuses map[string]*ConnectorStatus, worker string) []string {
+	var tasks []string
+	for _, line := range summarize_assignments(statuses) {
+		if line.task && line.worker == worker {
+			tasks = append(tasks, line.text)
+		}
+	}
+	sort.Strings(tasks)
+	return tasks
+}
+
+// stop_connect_worker stops one worker container and reports how its connectors and tasks were
+// reassigned, polling a surviving worker until nothing is left on the stopped one
+func stop_connect_worker(worker int, timeout time.Duration) error {
+	running, err := running_connect_workers()
+	if err != nil {
+		return err
+	}
+	survivor := 0
+	found := false
+	for _, i := range running {
+		if i == worker {
+			found = true
+		} else if survivor == 0 {
+			survivor = i
+		}
+	}
+	if !found {
+		return fmt.Errorf("worker %s is not running", connect_worker_container(worker))
+	}
+	if survivor == 0 {
+		return fmt.Errorf("%s is the only running worker; start with --connect-workers N", connect_worker_container(worker))
+	}
+
+	stoppedID := connect_worker_id(worker)
+	before, err := worker_connector_statuses(connect_worker_port(survivor))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Tasks on %s before stopping it:\n", stoppedID)
+	for _, task := range tasks_on_worker(before, stoppedID) {
+		fmt.Printf("  %s\n", task)
+	}
+
+	if err := run_docker("stop", connect_worker_container(worker)); err != nil {
+		return err
+	}
+	start := time.Now()
+	fmt.Printf("Stopped %s; waiting up to %s for the group to reassign its work (scheduled.rebalance.max.delay.ms)\n", stoppedID, timeout)
+
+	after := before
+	for time.Since(start) < timeout {
+		time.Sleep(5 * time.Second)
+		current, err := worker_connector_statuses(connect_worker_port(survivor))
+		if err != nil {
+			continue
+		}
+		after = current
+		if len(tasks_on_worker(after, stoppedID)) == 0 && connectors_on_worker(after, stoppedID) == 0 {
+			break
+		}
+	}
+
+	fmt.Printf("\nAfter %s:\n", time.Since(start).Round(time.Second))
+	for _, transition := range diff_component_statuses(before, after, time.Now()) {
+		fmt.Println(transition.String())
+	}
+	if left := tasks_on_worker(after, stoppedID); len(left) > 0 {
+		fmt.Printf("Still assigned to %s: %s\n", stoppedID, strings.Join(left, ", "))
+	}
+	fmt.Println(format_worker_assignments(after, nil))
+	return nil
+}
+
+func connectors_on_worker(statuses map[string]*ConnectorStatus, worker string) int {
+	count := 0
+	for _, status := range statuses {
+		if connector_field(status, "worker_id") == worker {
+			count++
+		}
+	}
+	return count
+}
+
+// parse_connect_worker accepts a worker number or its container name
+func parse_connect_worker(value string) (int, error) {
+	for i := 1; i <= maxConnectWorkers; i++ {
+		if value == connect_worker_container(i) || value == fmt.Sprint(i) || value == connect_worker_id(i) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown worker %q (use a number or a name such as kafka-connect-2)", value)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderConnectWorkersCompose(t *testing.T) {
+	content, err := render_connect_workers_compose(3, baseComposeFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{
+		"  kafka-connect-2:\n",
+		"  kafka-connect-3:\n",
+		"- 8084:8084",
+		"- 8085:8085",
+		"- 8096:8091",
+		"- 8097:8091",
+		"CONNECT_REST_PORT: 8085",
+		`CONNECT_REST_ADVERTISED_HOST_NAME: "kafka-connect-3"`,
+		`CONNECT_REST_ADVERTISED_HOST_NAME: "kafka-connect"`,
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, content)
+		}
+	}
+	if strings.Contains(content, "kafka-connect-4") {
+		t.Errorf("Did not expect a fourth worker in:\n%s", content)
+	}
+	// the rest of the worker definition comes from the base file
+	extends := "    extends:\n      file: docker-compose.yaml\n      service: kafka-connect\n"
+	if count := strings.Count(content, extends); count != 2 {
+		t.Errorf("Expected both added workers to extend kafka-connect, got %d in:\n%s", count, content)
+	}
+	for _, absent := range []string{"image:", "CONNECT_GROUP_ID", "volumes:"} {
+		if strings.Contains(content, absent) {
+			t.Errorf("Did not expect %q in:\n%s", absent, content)
+		}
+	}
+
+	content, err = render_connect_workers_compose(2, kraftComposeFile)
+	if err != nil || !strings.Contains(content, "file: "+kraftComposeFile) {
+		t.Errorf("Expected workers to extend %s, got %v:\n%s", kraftComposeFile, err, content)
+	}
+
+	for _, n := range []int{1, maxConnectWorkers + 1} {
+		if _, err := render_connect_workers_compose(n, baseComposeFile); err == nil {
+			t.Errorf("Expected an error for %d workers", n)
+		}
+	}
+}
+
+func TestParseConnectWorker(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int
+		wantErr  bool
+	}{
+		{value: "1", expected: 1},
+		{value: "kafka-connect", expected: 1},
+		{value: "kafka-connect-2", expected: 2},
+		{value: "kafka-connect-3:8085", expected: 3},
+		{value: "kafka-connect-9", wantErr: true},
+		{value: "connect", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			worker, err := parse_connect_worker(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error state: %v", err)
+			}
+			if !tt.wantErr && worker != tt.expected {
+				t.Errorf("Expected worker %d, got %d", tt.expected, worker)
+			}
+		})
+	}
+}
+
+func TestFormatWorkerAssignments(t *testing.T) {
+	statuses := map[string]*ConnectorStatus{
+		"sink": {
+			Name:      "sink",
+			Connector: map[string]interface{}{"state": "RUNNING", "worker_id": "kafka-connect-2:8084"},
+			Tasks:     []TaskStatus{{ID: 0, State: "RUNNING", Worker: "kafka-connect:8083"}},
+		},
+		"source": {
+			Name:      "source",
+			Connector: map[string]interface{}{"state": "RUNNING", "worker_id": "kafka-connect:8083"},
+			Tasks: []TaskStatus{
+				{ID: 0, State: "RUNNING", Worker: "kafka-connect:8083"},
+				{ID: 1, State: "UNASSIGNED", Worker: "kafka-connect-2:8084"},
+			},
+		},
+	}
+
+	expected := strings.Join([]string{
+		"Workers:",
+		"├── kafka-connect:8083 (2 tasks)",
+		"│   ├── sink task 0 RUNNING",
+		"│   ├── source (connector) RUNNING",
+		"│   └── source task 0 RUNNING",
+		"├── kafka-connect-2:8084 (1 tasks)",
+		"│   ├── sink (connector) RUNNING",
+		"│   └── source task 1 UNASSIGNED",
+		"└── kafka-connect-3:8085 (0 tasks)",
+		"    └── idle",
+	}, "\n")
+	workers := []string{"kafka-connect:8083", "kafka-connect-2:8084", "kafka-connect-3:8085"}
+	if got := format_worker_assignments(statuses, workers); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	if left := tasks_on_worker(statuses, "kafka-connect-2:8084"); len(left) != 1 || left[0] != "source task 1 UNASSIGNED" {
+		t.Errorf("Unexpected tasks on kafka-connect-2: %v", left)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MONGO_KAFKA_CONNECT_VERSION of a locally built jar; it is mounted like a release as
+// volumes/mongo-kafka-connect-local-all.jar, apart from the cached releases
+const localConnectorVersion = "local"
+
+// jar_manifest_version checks that path is a MongoDB Kafka connector jar and returns the version
+// in its manifest, or "" when the manifest has none
+func jar_manifest_version(path string) (string, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a jar: %v", path, err)
+	}
+	defer reader.Close()
+
+	connector := false
+	version := ""
+	for _, file := range reader.File {
+		if strings.HasPrefix(file.Name, "com/mongodb/kafka/connect/") {
+			connector = true
+		}
+		if file.Name != "META-INF/MANIFEST.MF" {
+			continue
+		}
+		manifest, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		attributes := make(map[string]string)
+		scanner := bufio.NewScanner(manifest)
+		for scanner.Scan() {
+			if name, value, ok := strings.Cut(scanner.Text(), ":"); ok {
+				attributes[name] = strings.TrimSpace(value)
+			}
+		}
+		manifest.Close()
+		for _, name := range []string{"Implementation-Version", "Bundle-Version", "Specification-Version"} {
+			if version == "" {
+				version = attributes[name]
+			}
+		}
+	}
+	if !connector {
+		return "", fmt.Errorf("%s has no com.mongodb.kafka.connect classes; build the -all jar of mongo-kafka", path)
+	}
+	return version, nil
+}
+
+// install_connector_jar copies a locally built jar into volumes/ and makes it the mounted connector;
+// it returns the version the jar declares
+func install_connector_jar(src string) (string, error) {
+	version, err := jar_manifest_version(src)
+	if err != nil {
+		return "", err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(connectorCacheDir, 0755); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(connectorCacheDir, connector_jar_name(localConnectorVersion))
+	out, err := os.Create(dest + ".part")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(dest+".part", dest)
+	}
+	if err != nil {
+		os.Remove(dest + ".part")
+		return "", fmt.Errorf("failed to install %s: %v", src, err)
+	}
+
+	if _, err := set_env_value(".env", "MONGO_KAFKA_CONNECT_VERSION", localConnectorVersion); err != nil {
+		return "", fmt.Errorf("failed to update .env: %v", err)
+	}
+	fmt.Printf("Installed %s as %s (version %s)\n", src, dest, display_version(version))
+	return version, nil
+}
+
+func display_version(version string) string {
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
+
+// connect_compose_files reads the compose files a running container was created from
+func connect_compose_files(container string) ([]string, error) {
+	output, err := exec.Command("docker", "inspect", "--format", `{{index .Config.Labels "com.docker.compose.project.config_files"}}`, container).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s is not running: %v", container, err)
+	}
+	var files []string
+	for _, file := range strings.Split(strings.TrimSpace(string(output)), ",") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s was not started by docker compose", container)
+	}
+	return files, nil
+}
+
+// connect_recreate_args are the compose arguments recreating the given workers only, so they mount
+// the jar named in .env
+func connect_recreate_args(files []string, workers []int) []string {
+	args := []string{"-p", "klaunch"}
+	for _, file := range files {
+		args = append(args, "-f", file)
+	}
+	args = append(args, "up", "-d", "--no-deps", "--force-recreate")
+	for _, i := range workers {
+		args = append(args, connect_worker_container(i))
+	}
+	return args
+}
+
+// run_compose runs docker-compose, falling back to docker compose like start and stop
+func run_compose(args ...string) error {
+	if err := exec.Command("docker-compose", args...).Run(); err == nil {
+		return nil
+	}
+	return run_docker(append([]string{"compose"}, args...)...)
+}
+
+// recreate_connect_workers recreates every running Connect worker and leaves the rest of the stack alone
+func recreate_connect_workers() ([]int, error) {
+	workers, err := running_connect_workers()
+	if err != nil {
+		return nil, err
+	}
+	if len(workers) == 0 {
+		return nil, fmt.Errorf("kafka-connect is not running; use `klaunch start --connector-jar`")
+	}
+	files, err := connect_compose_files(connect_worker_container(workers[0]))
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Recreating %d Connect worker(s)\n", len(workers))
+	if err := run_compose(connect_recreate_args(files, workers)...); err != nil {
+		return nil, err
+	}
+	return workers, nil
+}
+
+// mongo_plugin_versions maps the MongoDB connector classes of GET /connector-plugins to their version
+func mongo_plugin_versions(body []byte) (map[string]string, error) {
+	var plugins []map[string]string
+	if err := json.Unmarshal(body, &plugins); err != nil {
+		return nil, fmt.Errorf("failed to parse connector plugins: %v", err)
+	}
+	versions := make(map[string]string)
+	for _, plugin := range plugins {
+		if strings.HasPrefix(plugin["class"], "com.mongodb") {
+			versions[plugin["class"]] = plugin["version"]
+		}
+	}
+	return versions, nil
+}
+
+// confirm_connector_plugins waits for every worker to serve /connector-plugins and reports the
+// MongoDB plugin versions it loaded, failing when they differ from expected
+func confirm_connector_plugins(workers []int, expected string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	mismatch := false
+	for _, i := range workers {
+		var versions map[string]string
+		for {
+			body, err := connect_worker_rest_get(connect_worker_port(i), "/connector-plugins")
+			if err == nil {
+				versions, err = mongo_plugin_versions(body)
+			}
+			if err == nil && len(versions) > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("%s did not report MongoDB plugins within %s", connect_worker_container(i), timeout)
+			}
+			time.Sleep(3 * time.Second)
+		}
+		classes := make([]string, 0, len(versions))
+		for class := range versions {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		fmt.Printf("%s (GET /connector-plugins):\n", connect_worker_container(i))
+		for _, class := range classes {
+			note := ""
+			if expected != "" && versions[class] != expected {
+				note = fmt.Sprintf("  (jar declares %s)", expected)
+				mismatch = true
+			}
+			fmt.Printf("  %s %s%s\n", class, versions[class], note)
+		}
+	}
+	if mismatch {
+		return fmt.Errorf("loaded plugin version differs from the jar; check for another MongoDB connector in CONNECT_PLUGIN_PATH")
+	}
+	return nil
+}
+
+// swap_connector_jar installs a jar into a running stack, recreating only the Connect workers
+func swap_connector_jar(src string, timeout time.Duration) error {
+	version, err := install_connector_jar(src)
+	if err != nil {
+		return err
+	}
+	workers, err := recreate_connect_workers()
+	if err != nil {
+		return err
+	}
+	return confirm_connector_plugins(workers, version, timeout)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestJar creates a jar holding the given entries
+func writeTestJar(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	w := zip.NewWriter(file)
+	for name, content := range entries {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJarManifestVersion(t *testing.T) {
+	connectorClass := "com/mongodb/kafka/connect/MongoSourceConnector.class"
+	tests := []struct {
+		name     string
+		entries  map[string]string
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "implementation version",
+			entries:  map[string]string{"META-INF/MANIFEST.MF": "Manifest-Version: 1.0\r\nImplementation-Version: 1.14.0-SNAPSHOT\r\n", connectorClass: ""},
+			expected: "1.14.0-SNAPSHOT",
+		},
+		{
+			name:     "bundle version",
+			entries:  map[string]string{"META-INF/MANIFEST.MF": "Bundle-Version: 1.13.1\n", connectorClass: ""},
+			expected: "1.13.1",
+		},
+		{name: "no manifest", entries: map[string]string{connectorClass: ""}},
+		{name: "not the connector", entries: map[string]string{"org/example/Other.class": ""}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "connector.jar")
+			writeTestJar(t, path, tt.entries)
+			version, err := jar_manifest_version(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if version != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, version)
+			}
+		})
+	}
+
+	notJar := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(notJar, []byte("text"), 0644)
+	if _, err := jar_manifest_version(notJar); err == nil {
+		t.Error("Expected an error for a file that is not a jar")
+	}
+}
+
+func TestInstallConnectorJar(t *testing.T) {
+	tu := NewTestUtils(t)
+	tempDir := tu.CreateTempDirStructure(TempDirStructure{
+		Files: map[string]string{".env": "CONNECT_PLUGIN_PATH=/usr/share/java\nMONGO_KAFKA_CONNECT_VERSION=1.13.0\n"},
+	})
+	originalWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(originalWd)
+
+	jar := filepath.Join(tempDir, "build", "mongo-kafka-connect-1.14.0-SNAPSHOT-all.jar")
+	os.MkdirAll(filepath.Dir(jar), 0755)
+	writeTestJar(t, jar, map[string]string{
+		"META-INF/MANIFEST.MF":                               "Implementation-Version: 1.14.0-SNAPSHOT\n",
+		"com/mongodb/kafka/connect/MongoSinkConnector.class": "patched",
+	})
+
+	version, err := install_connector_jar(jar)
+	if err != nil || version != "1.14.0-SNAPSHOT" {
+		t.Fatalf("Unexpected result %q, %v", version, err)
+	}
+	if !tu.FileExists("volumes/mongo-kafka-connect-local-all.jar") || tu.FileExists("volumes/mongo-kafka-connect-local-all.jar.part") {
+		t.Error("Expected the jar to be installed as mongo-kafka-connect-local-all.jar")
+	}
+	env, _ := read_env_file(".env")
+	if env["MONGO_KAFKA_CONNECT_VERSION"] != "local" || env["CONNECT_PLUGIN_PATH"] != "/usr/share/java" {
+		t.Errorf("Unexpected .env %v", env)
+	}
+	if versions := cached_connector_versions("volumes"); len(versions) != 0 {
+		t.Errorf("Expected the local jar to stay out of the release cache, got %v", versions)
+	}
+}
+
+func TestConnectRecreateArgs(t *testing.T) {
+	args := connect_recreate_args([]string{"/work/docker-compose.yaml", "/work/docker-compose.connect-workers.yaml"}, []int{1, 2})
+	expected := "-p klaunch -f /work/docker-compose.yaml -f /work/docker-compose.connect-workers.yaml up -d --no-deps --force-recreate kafka-connect kafka-connect-2"
+	if strings.Join(args, " ") != expected {
+		t.Errorf("Expected %q, got %q", expected, strings.Join(args, " "))
+	}
+}
+
+func TestMongoPluginVersions(t *testing.T) {
+	body := `[
+		{"class":"com.mongodb.kafka.connect.MongoSinkConnector","type":"sink","version":"1.14.0-SNAPSHOT"},
+		{"class":"com.mongodb.kafka.connect.MongoSourceConnector","type":"source","version":"1.14.0-SNAPSHOT"},
+		{"class":"org.apache.kafka.connect.mirror.MirrorSourceConnector","type":"source","version":"7.7.0-ccs"}
+	]`
+	versions, err := mongo_plugin_versions([]byte(body))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(versions) != 2 || versions["com.mongodb.kafka.connect.MongoSourceConnector"] != "1.14.0-SNAPSHOT" {
+		t.Errorf("Unexpected versions %v", versions)
+	}
+	if _, err := mongo_plugin_versions([]byte("not json")); err == nil {
+		t.Error("Expected an error for an invalid response")
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// Maven directory of the connector; MONGO_KAFKA_CONNECT_REPOSITORY or --repository point to a mirror
+const defaultConnectorRepository = "https://repo1.maven.org/maven2/org/mongodb/kafka/mongo-kafka-connect/"
+
+// downloaded jars and their .sha1 files; docker-compose.yaml mounts the one in use from here
+const connectorCacheDir = "volumes"
+
+var connectorJarPattern = regexp.MustCompile(`^mongo-kafka-connect-(\d+(?:\.\d+)*)-all\.jar$`)
+
+var connectorVersionLinkPattern = regexp.MustCompile(`<a href="(\d*(\.\d+)*)/?"`)
+
+// connectorHTTPClient also serves file:// URLs so that a directory can stand in for Maven
+var connectorHTTPClient = func() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return &http.Client{Transport: transport, Timeout: 5 * time.Minute}
+}()
+
+// connector_repository_url picks --repository, then MONGO_KAFKA_CONNECT_REPOSITORY from the
+// environment or .klaunch.env, then Maven Central
+func connector_repository_url(flag string) string {
+	repository := flag
+	if repository == "" {
+		if vars, err := load_template_vars(""); err == nil {
+			repository = vars["MONGO_KAFKA_CONNECT_REPOSITORY"]
+		}
+	}
+	if repository == "" {
+		repository = defaultConnectorRepository
+	}
+	return strings.TrimSuffix(repository, "/") + "/"
+}
+
+func connector_jar_name(version string) string {
+	return fmt.Sprintf("mongo-kafka-connect-%s-all.jar", version)
+}
+
+func fetch_url(url string) ([]byte, error) {
+	resp, err := connectorHTTPClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// sort_versions orders X.Y.Z versions semantically, oldest first
+func sort_versions(versions []string) []string {
+	prefixed := make([]string, len(versions))
+	for i, version := range versions {
+		prefixed[i] = "v" + version
+	}
+	semver.Sort(prefixed)
+	sorted := make([]string, 0, len(prefixed))
+	for _, version := range prefixed {
+		version = strings.TrimPrefix(version, "v")
+		if len(sorted) == 0 || sorted[len(sorted)-1] != version {
+			sorted = append(sorted, version)
+		}
+	}
+	return sorted
+}
+
+// parse_maven_versions reads the versions of maven-metadata.xml, or of a directory listing
+func parse_maven_versions(body []byte) []string {
+	var metadata struct {
+		Versions []string `xml:"versioning>versions>version"`
+	}
+	if err := xml.Unmarshal(body, &metadata); err == nil && len(metadata.Versions) > 0 {
+		return sort_versions(metadata.Versions)
+	}
+	var versions []string
+	for _, match := range connectorVersionLinkPattern.FindAllStringSubmatch(string(body), -1) {
+		if match[1] != "" {
+			versions = append(versions, match[1])
+		}
+	}
+	return sort_versions(versions)
+}
+
+// remote_connector_versions lists the versions published in the repository
+func remote_connector_versions(repository string) ([]string, error) {
+	body, err := fetch_url(repository + "maven-metadata.xml")
+	if err != nil {
+		if body, err = fetch_url(repository); err != nil {
+			return nil, fmt.Errorf("failed to reach %s: %v", repository, err)
+		}
+	}
+	versions := parse_maven_versions(body)
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no connector versions found at %s", repository)
+	}
+	return versions, nil
+}
+
+// cached_connector_versions lists the jars in the cache directory
+func cached_connector_versions(dir string) []string {
+	entries, _ := os.ReadDir(dir)
+	var versions []string
+	for _, entry := range entries {
+		if match := connectorJarPattern.FindStringSubmatch(entry.Name()); match != nil {
+			versions = append(versions, match[1])
+		}
+	}
+	return sort_versions(versions)
+}
+
+func file_sha1(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha1.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// parse_sha1 reads a Maven .sha1 file, which may be followed by the file name
+func parse_sha1(content []byte) (string, error) {
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 || len(fields[0]) != 40 {
+		return "", fmt.Errorf("invalid .sha1 content %q", strings.TrimSpace(string(content)))
+	}
+	if _, err := hex.DecodeString(fields[0]); err != nil {
+		return "", fmt.Errorf("invalid .sha1 content %q", fields[0])
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// expected_connector_sha1 reads the checksum from the repository and keeps a copy next to the jar,
+// or uses that copy when the repository cannot be reached
+func expected_connector_sha1(version, repository, dir string) (string, error) {
+	name := connector_jar_name(version)
+	localPath := filepath.Join(dir, name+".sha1")
+	content, err := fetch_url(repository + version + "/" + name + ".sha1")
+	if err == nil {
+		sum, err := parse_sha1(content)
+		if err != nil {
+			return "", err
+		}
+		os.WriteFile(localPath, []byte(sum+"\n"), 0644)
+		return sum, nil
+	}
+	if local, localErr := os.ReadFile(localPath); localErr == nil {
+		return parse_sha1(local)
+	}
+	return "", err
+}
+
+// pull_connector_version makes sure the jar of version is cached and matches its .sha1; a verified
+// cached jar is not downloaded again, and offline a cached jar is used as is
+func pull_connector_version(version, repository, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := connector_jar_name(version)
+	path := filepath.Join(dir, name)
+	expected, sumErr := expected_connector_sha1(version, repository, dir)
+
+	if actual, err := file_sha1(path); err == nil {
+		switch {
+		case expected == "":
+			fmt.Printf("Using cached %s (not verified: %v)\n", name, sumErr)
+			return path, nil
+		case actual == expected:
+			fmt.Printf("Using cached %s (sha1 verified)\n", name)
+			return path, nil
+		}
+		fmt.Printf("Cached %s does not match its sha1 (%s, expected %s); downloading it again\n", name, actual, expected)
+	}
+
+	fmt.Printf("Downloading %s from %s\n", name, repository)
+	if err := download_file(repository+version+"/"+name, path); err != nil {
+		fmt.Println("Check the list of existing versions: ", repository)
+		return "", err
+	}
+	if expected == "" {
+		fmt.Printf("Downloaded %s without verification: %v\n", name, sumErr)
+	} else {
+		actual, err := file_sha1(path)
+		if err != nil {
+			return "", err
+		}
+		if actual != expected {
+			os.Remove(path)
+			return "", fmt.Errorf("%s failed verification: sha1 %s, expected %s", name, actual, expected)
+		}
+		fmt.Printf("Verified %s (sha1 %s)\n", name, actual)
+	}
+	return path, nil
+}
+
+// connector_version_in_use is MONGO_KAFKA_CONNECT_VERSION from .env
+func connector_version_in_use() string {
+	env, _ := read_env_file(".env")
+	return env["MONGO_KAFKA_CONNECT_VERSION"]
+}
+
+// use_connector_version caches version and records it in .env for the next start
+func use_connector_version(version, repository string) error {
+	if _, err := pull_connector_version(version, repository, connectorCacheDir); err != nil {
+		return err
+	}
+	changed, err := set_env_value(".env", "MONGO_KAFKA_CONNECT_VERSION", version)
+	if err != nil {
+		return fmt.Errorf("failed to update .env: %v", err)
+	}
+	if changed {
+		fmt.Printf("MONGO_KAFKA_CONNECT_VERSION set to %s in .env; run `klaunch start %s` (or recreate kafka-connect) to load it\n", version, version)
+	} else {
+		fmt.Printf("MONGO_KAFKA_CONNECT_VERSION is already %s\n", version)
+	}
+	return nil
+}
+
+// format_connector_versions lists remote and cached versions, newest first, marking the cached
+// ones, the one in use and the latest release
+func format_connector_versions(remote, cached []string, inUse string) string {
+	isCached := make(map[string]bool)
+	for _, version := range cached {
+		isCached[version] = true
+	}
+	all := sort_versions(append(append([]string{}, remote...), cached...))
+	latest := ""
+	if len(remote) > 0 {
+		latest = remote[len(remote)-1]
+	}
+
+	var b strings.Builder
+	for i := len(all) - 1; i >= 0; i-- {
+		version := all[i]
+		var marks []string
+		if version == inUse {
+			marks = append(marks, "in use")
+		}
+		if isCached[version] {
+			marks = append(marks, "cached")
+		}
+		if version == latest {
+			marks = append(marks, "latest")
+		}
+		if len(remote) > 0 && !contains_string(remote, version) {
+			marks = append(marks, "not in repository")
+		}
+		fmt.Fprintf(&b, "  %-10s %s\n", version, strings.Join(marks, ", "))
+	}
+	return b.String()
+}
+
+func contains_string(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func list_connector_versions(repository string, cachedOnly bool) error {
+	cached := cached_connector_versions(connectorCacheDir)
+	var remote []string
+	if !cachedOnly {
+		var err error
+		if remote, err = remote_connector_versions(repository); err != nil {
+			fmt.Printf("Offline (%v); showing cached versions only\n", err)
+		}
+	}
+	if len(remote) == 0 && len(cached) == 0 {
+		return fmt.Errorf("no cached connector versions in %s", connectorCacheDir)
+	}
+	fmt.Printf("MongoDB Kafka connector versions (%s):\n", repository)
+	fmt.Print(format_connector_versions(remote, cached, connector_version_in_use()))
+	return nil
+}
+
+// prune_connector_versions removes cached jars other than the one in use and those in keep
+func prune_connector_versions(dir string, keep []string, dryRun bool) ([]string, error) {
+	keep = append(keep, connector_version_in_use())
+	var removed []string
+	for _, version := range cached_connector_versions(dir) {
+		if contains_string(keep, version) {
+			continue
+		}
+		path := filepath.Join(dir, connector_jar_name(version))
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return removed, err
+			}
+			os.Remove(path + ".sha1")
+		}
+		removed = append(removed, version)
+	}
+	return removed, nil
+}
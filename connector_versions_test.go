@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseMavenVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected []string
+	}{
+		{
+			name:     "maven metadata",
+			body:     `<metadata><versioning><latest>1.10.0</latest><versions><version>1.9.1</version><version>1.10.0</version><version>1.2.0</version></versions></versioning></metadata>`,
+			expected: []string{"1.2.0", "1.9.1", "1.10.0"},
+		},
+		{
+			name:     "directory listing",
+			body:     createMockMavenResponse([]string{"1.13.0", "2.0.1", "1.14.0"}),
+			expected: []string{"1.13.0", "1.14.0", "2.0.1"},
+		},
+		{name: "no versions", body: "<html><body>No versions</body></html>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			versions := parse_maven_versions([]byte(tt.body))
+			if strings.Join(versions, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v, got %v", tt.expected, versions)
+			}
+		})
+	}
+}
+
+func TestParseSha1(t *testing.T) {
+	sum := "3f786850e387550fdab836ed7e6dc881de23001b"
+	for _, content := range []string{sum, sum + "\n", strings.ToUpper(sum) + "  mongo-kafka-connect-2.0.1-all.jar\n"} {
+		if got, err := parse_sha1([]byte(content)); err != nil || got != sum {
+			t.Errorf("parse_sha1(%q) = %q, %v", content, got, err)
+		}
+	}
+	for _, content := range []string{"", "<html>Not Found</html>", strings.Repeat("z", 40)} {
+		if _, err := parse_sha1([]byte(content)); err == nil {
+			t.Errorf("Expected an error for %q", content)
+		}
+	}
+}
+
+func TestPullConnectorVersion(t *testing.T) {
+	jar := "mock jar content"
+	hash := sha1.Sum([]byte(jar))
+	sum := hex.EncodeToString(hash[:])
+	served := jar
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repo/2.0.1/mongo-kafka-connect-2.0.1-all.jar":
+			downloads++
+			w.Write([]byte(served))
+		case "/repo/2.0.1/mongo-kafka-connect-2.0.1-all.jar.sha1":
+			w.Write([]byte(sum))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	dir := t.TempDir()
+	repository := server.URL + "/repo/"
+	path := filepath.Join(dir, "mongo-kafka-connect-2.0.1-all.jar")
+
+	if _, err := pull_connector_version("2.0.1", repository, dir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != jar {
+		t.Fatalf("Unexpected jar content %q", content)
+	}
+
+	// a verified cached jar is not downloaded again
+	if _, err := pull_connector_version("2.0.1", repository, dir); err != nil || downloads != 1 {
+		t.Fatalf("Expected the cached jar to be used, got %d downloads, %v", downloads, err)
+	}
+
+	// a corrupted cached jar is downloaded again
+	os.WriteFile(path, []byte("truncated"), 0644)
+	if _, err := pull_connector_version("2.0.1", repository, dir); err != nil || downloads != 2 {
+		t.Fatalf("Expected a new download, got %d downloads, %v", downloads, err)
+	}
+
+	// offline, the saved .sha1 still verifies the cached jar
+	server.Close()
+	if _, err := pull_connector_version("2.0.1", repository, dir); err != nil {
+		t.Fatalf("Expected the cached jar to be used offline: %v", err)
+	}
+	if _, err := pull_connector_version("1.13.0", repository, dir); err == nil {
+		t.Error("Expected an error for an uncached version offline")
+	}
+}
+
+func TestPullConnectorVersionMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sha1") {
+			w.Write([]byte("3f786850e387550fdab836ed7e6dc881de23001b"))
+			return
+		}
+		w.Write([]byte("tampered"))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	if _, err := pull_connector_version("2.0.1", connector_repository_url(server.URL), dir); err == nil || !strings.Contains(err.Error(), "failed verification") {
+		t.Fatalf("Expected a verification error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "mongo-kafka-connect-2.0.1-all.jar")); !os.IsNotExist(err) {
+		t.Error("Expected the unverified jar to be removed")
+	}
+}
+
+func TestFileRepository(t *testing.T) {
+	mirror := t.TempDir()
+	os.MkdirAll(filepath.Join(mirror, "1.13.0"), 0755)
+	os.MkdirAll(filepath.Join(mirror, "2.0.1"), 0755)
+	os.WriteFile(filepath.Join(mirror, "2.0.1", "mongo-kafka-connect-2.0.1-all.jar"), []byte("jar"), 0644)
+
+	repository := connector_repository_url("file://" + mirror)
+	versions, err := remote_connector_versions(repository)
+	if err != nil || strings.Join(versions, ",") != "1.13.0,2.0.1" {
+		t.Fatalf("Expected the mirror versions, got %v, %v", versions, err)
+	}
+	if _, err := pull_connector_version("2.0.1", repository, t.TempDir()); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestFormatConnectorVersions(t *testing.T) {
+	output := format_connector_versions([]string{"1.13.0", "1.14.0", "2.0.1"}, []string{"1.12.0", "1.14.0"}, "1.14.0")
+	expected := []string{
+		"  2.0.1      latest",
+		"  1.14.0     in use, cached",
+		"  1.13.0     ",
+		"  1.12.0     cached, not in repository",
+	}
+	if strings.TrimRight(output, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), output)
+	}
+}
+
+func TestPruneConnectorVersions(t *testing.T) {
+	tu := NewTestUtils(t)
+	tempDir := tu.CreateTempDirStructure(TempDirStructure{
+		Dirs: []string{"volumes"},
+		Files: map[string]string{
+			".env": "MONGO_KAFKA_CONNECT_VERSION=1.14.0\n",
+			"volumes/mongo-kafka-connect-1.12.0-all.jar":      "jar",
+			"volumes/mongo-kafka-connect-1.12.0-all.jar.sha1": "sum",
+			"volumes/mongo-kafka-connect-1.13.0-all.jar":      "jar",
+			"volumes/mongo-kafka-connect-1.14.0-all.jar":      "jar",
+			"volumes/kafka_config.yml":                        "rules",
+		},
+	})
+	originalWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(originalWd)
+
+	removed, err := prune_connector_versions("volumes", []string{"1.13.0"}, true)
+	if err != nil || strings.Join(removed, ",") != "1.12.0" || !tu.FileExists("volumes/mongo-kafka-connect-1.12.0-all.jar") {
+		t.Fatalf("Dry run: unexpected result %v, %v", removed, err)
+	}
+
+	removed, err = prune_connector_versions("volumes", nil, false)
+	if err != nil || strings.Join(removed, ",") != "1.12.0,1.13.0" {
+		t.Fatalf("Unexpected result %v, %v", removed, err)
+	}
+	if versions := cached_connector_versions("volumes"); strings.Join(versions, ",") != "1.14.0" {
+		t.Errorf("Expected only the version in use to remain, got %v", versions)
+	}
+	if tu.FileExists("volumes/mongo-kafka-connect-1.12.0-all.jar.sha1") || !tu.FileExists("volumes/kafka_config.yml") {
+		t.Error("Expected the .sha1 to be removed with its jar and other files to be kept")
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BundleEntry describes one item collected into the diagnostic bundle
+type BundleEntry struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	Bytes  int    `json:"bytes"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BundleManifest is written as manifest.json at the root of every bundle
+type BundleManifest struct {
+	CaseNumber string        `json:"case_number,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	Host       string        `json:"host"`
+	Entries    []BundleEntry `json:"entries"`
+}
+
+type bundleWriter struct {
+	tw       *tar.Writer
+	root     string
+	manifest *BundleManifest
+}
+
+// add runs collect and stores its output under name. Failures are recorded in the
+// manifest and never abort the bundle, so a partially broken stack still gets captured.
+func (b *bundleWriter) add(name, source string, collect func() ([]byte, error)) error {
+	entry := BundleEntry{Path: name, Source: source}
+
+	content, err := collect()
+	if err != nil {
+		entry.Error = err.Error()
+		name = name + ".error.txt"
+		entry.Path = name
+		content = []byte(fmt.Sprintf("collection failed: %v\n%s", err, content))
+	}
+	entry.Bytes = len(content)
+	b.manifest.Entries = append(b.manifest.Entries, entry)
+
+	return b.write(name, content)
+}
+
+func (b *bundleWriter) write(name string, content []byte) error {
+	header := &tar.Header{
+		Name:    filepath.ToSlash(filepath.Join(b.root, name)),
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: b.manifest.CreatedAt,
+	}
+	if err := b.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := b.tw.Write(content)
+	return err
+}
+
+func (b *bundleWriter) close() error {
+	manifest, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.write("manifest.json", manifest)
+}
+
+func run_output(name string, args ...string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		return exec.Command(name, args...).CombinedOutput()
+	}
+}
+
+func http_output(url string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		resp, err := http.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("bad status: %s", resp.Status)
+		}
+		return body, err
+	}
+}
+
+func rest_output(path string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		out, err := connect_rest_get(path)
+		return pretty_json(out), err
+	}
+}
+
+func file_output(path string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		return os.ReadFile(path)
+	}
+}
+
+// redacted masks credentials in the output of a text collector
+func redacted(collect func() ([]byte, error)) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		content, err := collect()
+		return []byte(redact_text(string(content))), err
+	}
+}
+
+func pretty_json(content []byte) []byte {
+	var value interface{}
+	if err := json.Unmarshal(content, &value); err != nil {
+		return content
+	}
+	pretty, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return content
+	}
+	return pretty
+}
+
+func collect_connector_bundle(b *bundleWriter) error {
+	names, err := connect_rest_get("/connectors")
+	if err != nil {
+		return b.add("connectors/connectors.json", "GET /connectors", func() ([]byte, error) { return nil, err })
+	}
+
+	var connectorNames []string
+	if err := json.Unmarshal(names, &connectorNames); err != nil {
+		return b.add("connectors/connectors.json", "GET /connectors", func() ([]byte, error) { return names, err })
+	}
+	sort.Strings(connectorNames)
+
+	for _, name := range connectorNames {
+		err := b.add(fmt.Sprintf("connectors/%s/config.json", name), fmt.Sprintf("GET /connectors/%s/config (redacted)", name), func() ([]byte, error) {
+			raw, err := connect_rest_get(fmt.Sprintf("/connectors/%s/config", name))
+			if err != nil {
+				return nil, err
+			}
+			var config map[string]string
+			if err := json.Unmarshal(raw, &config); err != nil {
+				return nil, err
+			}
+			return json.MarshalIndent(redact_connector_config(config), "", "  ")
+		})
+		if err != nil {
+			return err
+		}
+
+		var status ConnectorStatus
+		err = b.add(fmt.Sprintf("connectors/%s/status.json", name), fmt.Sprintf("GET /connectors/%s/status", name), func() ([]byte, error) {
+			raw, err := connect_rest_get(fmt.Sprintf("/connectors/%s/status", name))
+			if err == nil {
+				json.Unmarshal(raw, &status)
+			}
+			return []byte(redact_text(string(pretty_json(raw)))), err
+		})
+		if err != nil {
+			return err
+		}
+
+		err = b.add(fmt.Sprintf("connectors/%s/traces.txt", name), "status traces", func() ([]byte, error) {
+			var traces strings.Builder
+			if trace := connector_field(&status, "trace"); trace != "" {
+				fmt.Fprintf(&traces, "=== connector %s [%s]\n%s\n\n", name, connector_field(&status, "state"), trace)
+			}
+			for _, task := range status.Tasks {
+				if task.Trace != "" {
+					fmt.Fprintf(&traces, "=== task %d [%s] on %s\n%s\n\n", task.ID, task.State, task.Worker, task.Trace)
+				}
+			}
+			if traces.Len() == 0 {
+				traces.WriteString("no traces reported\n")
+			}
+			return []byte(redact_text(traces.String())), nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func connector_jar_version_report(envFile string) ([]byte, error) {
+	var report strings.Builder
+
+	env, err := read_env_file(envFile)
+	if err != nil {
+		fmt.Fprintf(&report, ".env: %v\n", err)
+	} else {
+		fmt.Fprintf(&report, "MONGO_KAFKA_CONNECT_VERSION=%s\n", env["MONGO_KAFKA_CONNECT_VERSION"])
+	}
+
+	jars, _ := filepath.Glob(filepath.Join("volumes", "mongo-kafka-connect-*-all.jar"))
+	fmt.Fprintf(&report, "\nDownloaded jars:\n")
+	for _, jar := range jars {
+		fmt.Fprintf(&report, "  %s\n", filepath.Base(jar))
+	}
+
+	fmt.Fprintf(&report, "\nLoaded MongoDB plugins (GET /connector-plugins):\n")
+	plugins, err := connect_rest_get("/connector-plugins")
+	if err != nil {
+		fmt.Fprintf(&report, "  unavailable: %v\n", err)
+		return []byte(report.String()), nil
+	}
+	var pluginList []map[string]string
+	json.Unmarshal(plugins, &pluginList)
+	for _, plugin := range pluginList {
+		if strings.HasPrefix(plugin["class"], "com.mongodb") {
+			fmt.Fprintf(&report, "  %s %s\n", plugin["class"], plugin["version"])
+		}
+	}
+	return []byte(report.String()), nil
+}
+
+func create_bundle(output string) (string, error) {
+	now := time.Now()
+	host, _ := os.Hostname()
+	env, _ := read_env_file(".env")
+
+	root := fmt.Sprintf("klaunch_bundle_%s", now.Format("20060102_150405"))
+	if caseNumber := env["CASENUMBER"]; caseNumber != "" {
+		root = fmt.Sprintf("klaunch_bundle_%s_%s", caseNumber, now.Format("20060102_150405"))
+	}
+	if output == "" {
+		output = filepath.Join("bundles", root+".tar.gz")
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return "", fmt.Errorf("failed to create bundle directory: %v", err)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return "", fmt.Errorf("failed to create bundle: %v", err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+
+	b := &bundleWriter{
+		tw:   tw,
+		root: root,
+		manifest: &BundleManifest{
+			CaseNumber: env["CASENUMBER"],
+			CreatedAt:  now,
+			Host:       host,
+		},
+	}
+
+	steps := []struct {
+		name   string
+		source string
+		fn     func() ([]byte, error)
+	}{
+		{"connect/root.json", "GET /", rest_output("/")},
+		{"connect/connector-plugins.json", "GET /connector-plugins", rest_output("/connector-plugins")},
+		{"kafka/topics.txt", "kafka-topics --describe", run_output("docker", kafka_cli_args("kafka-topics", "--describe")...)},
+		{"kafka/consumer-groups.txt", "kafka-consumer-groups --describe --all-groups", run_output("docker", kafka_cli_args("kafka-consumer-groups", "--describe", "--all-groups")...)},
+		{"environment/connector-version.txt", ".env, volumes/ and GET /connector-plugins", func() ([]byte, error) { return connector_jar_version_report(".env") }},
+		{"environment/.env", ".env (redacted)", redacted(file_output(".env"))},
+		{"environment/docker-version.txt", "docker version", run_output("docker", "version")},
+		{"environment/docker-compose-version.txt", "docker compose version", run_output("docker", "compose", "version")},
+		{"environment/containers.txt", "docker ps", run_output("docker", "ps", "-a", "--filter", "label=com.docker.compose.project=klaunch")},
+		{"compose/docker-compose.yaml", "docker-compose.yaml (redacted)", redacted(file_output("docker-compose.yaml"))},
+		{"compose/Dockerfile-MongoConnect", "Dockerfile-MongoConnect", file_output("Dockerfile-MongoConnect")},
+		{"metrics/prometheus-snapshot.txt", "Prometheus /federate", http_output(`http://localhost:9090/federate?match[]=%7Bjob%3D~%22.%2B%22%7D`)},
+	}
+
+	fmt.Println("Collecting connectors...")
+	if err := collect_connector_bundle(b); err != nil {
+		return "", err
+	}
+	for _, step := range steps {
+		fmt.Printf("Collecting %s...\n", step.name)
+		if err := b.add(step.name, step.source, step.fn); err != nil {
+			return "", err
+		}
+	}
+	// the overlays written by start define the stack as much as the base file
+	for _, file := range []string{kraftComposeFile, shardedComposeFile, connectWorkersComposeFile, securityComposeFile} {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		fmt.Printf("Collecting compose/%s...\n", file)
+		if err := b.add("compose/"+file, file+" (redacted)", redacted(file_output(file))); err != nil {
+			return "", err
+		}
+	}
+
+	containers, err := list_project_containers()
+	if err != nil {
+		b.add("logs/containers.txt", "docker ps", func() ([]byte, error) { return nil, err })
+	}
+	for _, container := range containers {
+		fmt.Printf("Collecting logs from %s...\n", container)
+		if err := b.add(fmt.Sprintf("logs/%s.log", container), "docker logs "+container+" (redacted)", redacted(run_output("docker", "logs", "--timestamps", container))); err != nil {
+			return "", err
+		}
+	}
+
+	if err := b.close(); err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	failed := 0
+	for _, entry := range b.manifest.Entries {
+		if entry.Error != "" {
+			failed++
+		}
+	}
+	fmt.Printf("Collected %d items (%d failed, see manifest.json)\n", len(b.manifest.Entries), failed)
+	return output, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBundleWriterRecordsManifest(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	b := &bundleWriter{
+		tw:       tw,
+		root:     "klaunch_bundle_test",
+		manifest: &BundleManifest{CaseNumber: "000001", CreatedAt: time.Now()},
+	}
+
+	if err := b.add("connect/root.json", "GET /", func() ([]byte, error) {
+		return []byte(`{"version":"7.7.0"}`), nil
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := b.add("metrics/prometheus-snapshot.txt", "Prometheus /federate", func() ([]byte, error) {
+		return nil, fmt.Errorf("connection refused")
+	}); err != nil {
+		t.Fatalf("Failed collections should not abort the bundle: %v", err)
+	}
+	if err := b.close(); err != nil {
+		t.Fatalf("Unexpected error closing bundle: %v", err)
+	}
+	tw.Close()
+
+	files := make(map[string]string)
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar: %v", err)
+		}
+		content, _ := io.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+
+	for _, expected := range []string{
+		"klaunch_bundle_test/connect/root.json",
+		"klaunch_bundle_test/metrics/prometheus-snapshot.txt.error.txt",
+		"klaunch_bundle_test/manifest.json",
+	} {
+		if _, ok := files[expected]; !ok {
+			t.Errorf("Expected %s in bundle, got %v", expected, files)
+		}
+	}
+
+	var manifest BundleManifest
+	if err := json.Unmarshal([]byte(files["klaunch_bundle_test/manifest.json"]), &manifest); err != nil {
+		t.Fatalf("Invalid manifest: %v", err)
+	}
+	if manifest.CaseNumber != "000001" {
+		t.Errorf("Expected case number 000001, got %s", manifest.CaseNumber)
+	}
+	if len(manifest.Entries) != 2 {
+		t.Fatalf("Expected 2 manifest entries, got %d", len(manifest.Entries))
+	}
+	if manifest.Entries[0].Error != "" || manifest.Entries[0].Bytes != len(`{"version":"7.7.0"}`) {
+		t.Errorf("Unexpected entry for successful collection: %+v", manifest.Entries[0])
+	}
+	if !strings.Contains(manifest.Entries[1].Error, "connection refused") {
+		t.Errorf("Expected failure to be recorded, got %+v", manifest.Entries[1])
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	tu := NewTestUtils(t)
+	dir := t.TempDir()
+	path := tu.CreateJSONFile(dir, ".env", "# klaunch\nCONNECT_PLUGIN_PATH=\"/usr/share/java,/usr/share/confluent-hub-components\"\nMONGO_KAFKA_CONNECT_VERSION=2.0.1\n\nCASENUMBER=000001\n")
+
+	env, err := read_env_file(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		"CONNECT_PLUGIN_PATH":         "/usr/share/java,/usr/share/confluent-hub-components",
+		"MONGO_KAFKA_CONNECT_VERSION": "2.0.1",
+		"CASENUMBER":                  "000001",
+	}
+	for key, value := range expected {
+		if env[key] != value {
+			t.Errorf("Expected %s=%s, got %s", key, value, env[key])
+		}
+	}
+
+	if _, err := read_env_file(filepath.Join(dir, "missing.env")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -10,9 +12,7 @@ import (
 	"strings"
 )
 
-func create_kafka_task() error {
-	url := "http://localhost:8083/connectors"
-
+func create_kafka_task(envName string) error {
 	// Get available config files
 	configFiles, err := getConfigFiles()
 	if err != nil {
@@ -59,17 +59,28 @@ func create_kafka_task() error {
 
 	fmt.Printf("Selected configuration file: %s\n", filePath)
 
-	file, err := os.ReadFile(filePath)
+	// resolve ${VAR} references and "extends" before sending the config
+	file, err := render_config(filePath, envName)
 	if err != nil {
-		fmt.Println("Error reading file:", err)
+		fmt.Println("Error rendering configuration:", err)
 		return err
 	}
 
 	// show the content of file
 	fmt.Println("Using the following configuration:")
-	fmt.Println(string(file))
+	fmt.Println(redact_text(string(file)))
+
+	// configs reading fullDocumentBeforeChange need pre-images on the MongoDB side
+	if _, config, err := flatten_rendered_config(file); err == nil {
+		offer_pre_images(config)
+	}
+
+	return post_connector_config(file)
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(file))
+// post_connector_config creates a connector from a rendered {"name", "config"} document
+func post_connector_config(file []byte) error {
+	req, err := http.NewRequest("POST", "http://localhost:8083/connectors", bytes.NewBuffer(file))
 	if err != nil {
 		fmt.Println("Error creating request:", err)
 		return err
@@ -87,12 +98,29 @@ func create_kafka_task() error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		if message := connect_error_message(body); message != "" {
+			return fmt.Errorf("failed to create task: %s: %s", resp.Status, message)
+		}
 		return fmt.Errorf("failed to create task: %s", resp.Status)
 	}
 
 	return nil
 }
 
+// connect_error_message is the message of a Connect REST error body ({"error_code": ..., "message": ...}),
+// redacted because validation errors echo config values such as connection.uri
+func connect_error_message(body []byte) string {
+	var restError struct {
+		ErrorCode int    `json:"error_code"`
+		Message   string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &restError); err != nil || restError.Message == "" {
+		return redact_text(strings.TrimSpace(string(body)))
+	}
+	return redact_text(restError.Message)
+}
+
 func getConfigFiles() ([]string, error) {
 	configDir := "./case_configs"
 	files, err := os.ReadDir(configDir)
@@ -198,9 +198,7 @@ func delete_single_connector(connectorName string) error {
 func delete_single_topic(topicName string) error {
 	fmt.Printf("Deleting topic: %s\n", topicName)
 	
-	deleteCmd := exec.Command("docker", "exec", "kafka-connect", "kafka-topics", 
-		"--delete", "--bootstrap-server=kafka2:19092,kafka3:19093,kafka1:19091", 
-		"--topic", topicName)
+	deleteCmd := exec.Command("docker", kafka_cli_args("kafka-topics", "--delete", "--topic", topicName)...)
 	
 	output, err := deleteCmd.CombinedOutput()
 	if err != nil {
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// compose file generated by `klaunch start --kraft`; it replaces docker-compose.yaml
+const kraftComposeFile = "docker-compose.kraft.yaml"
+
+// services of docker-compose.yaml that do not depend on ZooKeeper, reused as they are; kafka-connect
+// is reused too, without its dependency on zookeeper1
+var kraftReusedServices = []string{"schema-registry", "prometheus", "grafana"}
+
+// every node of the KRaft quorum must be formatted with the same cluster id
+const kraftClusterID = "a2xhdW5jaC1rcmFmdC0wMQ"
+
+// KRaft controller placement: combined runs the controller in kafka1-3, dedicated adds controller1-3
+var kraftModes = []string{"combined", "dedicated"}
+
+type kraftNode struct {
+	Name       string
+	NodeID     int
+	Roles      string
+	Broker     bool
+	Index      int // 1-3, selects the listener and JMX exporter ports of docker-compose.yaml
+	Controller string
+	DependsOn  []string
+}
+
+type kraftCompose struct {
+	Mode      string
+	Release   string
+	ClusterID string
+	Voters    string
+	Nodes     []kraftNode
+	Reused    []string
+}
+
+// kraft_nodes lays out the brokers and controllers; brokers keep the names and ports of
+// docker-compose.yaml so the rest of klaunch works unchanged
+func kraft_nodes(mode string) ([]kraftNode, error) {
+	var nodes []kraftNode
+	switch mode {
+	case "combined":
+		for i := 1; i <= 3; i++ {
+			name := fmt.Sprintf("kafka%d", i)
+			nodes = append(nodes, kraftNode{
+				Name:       name,
+				NodeID:     i,
+				Roles:      "broker,controller",
+				Broker:     true,
+				Index:      i,
+				Controller: fmt.Sprintf("%s:%d", name, 29090+i),
+			})
+		}
+	case "dedicated":
+		var controllers []string
+		for i := 1; i <= 3; i++ {
+			name := fmt.Sprintf("controller%d", i)
+			controllers = append(controllers, name)
+			nodes = append(nodes, kraftNode{Name: name, NodeID: 100 + i, Roles: "controller", Index: i, Controller: name + ":9093"})
+		}
+		for i := 1; i <= 3; i++ {
+			nodes = append(nodes, kraftNode{Name: fmt.Sprintf("kafka%d", i), NodeID: i, Roles: "broker", Broker: true, Index: i, DependsOn: controllers})
+		}
+	default:
+		return nil, fmt.Errorf("unknown KRaft mode %q (use %s)", mode, strings.Join(kraftModes, " or "))
+	}
+	return nodes, nil
+}
+
+// kraft_quorum_voters is KAFKA_CONTROLLER_QUORUM_VOTERS: id@host:port of every controller
+func kraft_quorum_voters(nodes []kraftNode) string {
+	var voters []string
+	for _, node := range nodes {
+		if node.Controller != "" {
+			voters = append(voters, fmt.Sprintf("%d@%s", node.NodeID, node.Controller))
+		}
+	}
+	return strings.Join(voters, ",")
+}
+
+var kraftComposeTemplate = template.Must(template.New("kraft").Parse(`---
+# Generated by ` + "`klaunch start --kraft={{.Mode}}`" + `; do not edit.
+# KRaft replaces ZooKeeper, so zookeeper1 and cmak are not part of this stack; the other
+# services extend docker-compose.yaml.
+version: '3'
+services:
+{{- range .Nodes}}
+  {{.Name}}:
+    image: confluentinc/cp-server:{{$.Release}}
+    hostname: {{.Name}}
+    container_name: {{.Name}}
+{{- if .DependsOn}}
+    depends_on:
+{{- range .DependsOn}}
+      - {{.}}
+{{- end}}
+{{- end}}
+    extra_hosts:
+      - "host.docker.internal:host-gateway"
+    environment:
+      CLUSTER_ID: {{$.ClusterID}}
+      KAFKA_NODE_ID: {{.NodeID}}
+      KAFKA_PROCESS_ROLES: {{.Roles}}
+      KAFKA_CONTROLLER_QUORUM_VOTERS: {{$.Voters}}
+      KAFKA_CONTROLLER_LISTENER_NAMES: CONTROLLER
+{{- if .Broker}}
+      KAFKA_LISTENERS: PLAINTEXT://{{.Name}}:1909{{.Index}}, EXTERNAL://{{.Name}}:909{{.Index}}{{if .Controller}}, CONTROLLER://{{.Controller}}{{end}}
+      KAFKA_LISTENER_SECURITY_PROTOCOL_MAP: PLAINTEXT:PLAINTEXT,EXTERNAL:PLAINTEXT,CONTROLLER:PLAINTEXT
+      KAFKA_ADVERTISED_LISTENERS: PLAINTEXT://{{.Name}}:1909{{.Index}}, EXTERNAL://localhost:909{{.Index}}
+      KAFKA_INTER_BROKER_LISTENER_NAME: PLAINTEXT
+      KAFKA_GROUP_INITIAL_REBALANCE_DELAY_MS: 0
+      KAFKA_JMX_PORT: 9999
+      KAFKA_JMX_HOSTNAME: {{.Name}}
+      KAFKA_BROKER_RACK: rack-0
+      KAFKA_JVM_PERFORMANCE_OPTS: "-javaagent:/tmp/jmx_prometheus_javaagent-0.19.0.jar=809{{.Index}}:/tmp/kafka_config.yml"
+    volumes:
+      - $PWD/volumes/jmx_prometheus_javaagent-0.19.0.jar:/tmp/jmx_prometheus_javaagent-0.19.0.jar
+      - $PWD/volumes/kafka_config.yml:/tmp/kafka_config.yml
+    ports:
+      - 909{{.Index}}:909{{.Index}}
+      - 809{{.Index}}:809{{.Index}}
+{{- else}}
+      KAFKA_LISTENERS: CONTROLLER://{{.Controller}}
+      KAFKA_LISTENER_SECURITY_PROTOCOL_MAP: CONTROLLER:PLAINTEXT
+{{- end}}
+{{end}}
+  kafka-connect:
+    extends:
+      file: ` + baseComposeFile + `
+      service: kafka-connect
+    depends_on: !override
+      - kafka1
+      - kafka2
+      - kafka3
+    environment:
+      CONNECT_ZOOKEEPER_CONNECT: !reset null
+{{- range .Reused}}
+
+  {{.}}:
+    extends:
+      file: ` + baseComposeFile + `
+      service: {{.}}
+{{- end}}
+`))
+
+// render_kraft_compose generates the KRaft variant of docker-compose.yaml
+func render_kraft_compose(mode string) (string, error) {
+	nodes, err := kraft_nodes(mode)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	err = kraftComposeTemplate.Execute(&b, kraftCompose{
+		Mode:      mode,
+		Release:   cpVersionImageTag,
+		ClusterID: kraftClusterID,
+		Voters:    kraft_quorum_voters(nodes),
+		Nodes:     nodes,
+		Reused:    kraftReusedServices,
+	})
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestKraftQuorumVoters(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected string
+		wantErr  bool
+	}{
+		{mode: "combined", expected: "1@kafka1:29091,2@kafka2:29092,3@kafka3:29093"},
+		{mode: "dedicated", expected: "101@controller1:9093,102@controller2:9093,103@controller3:9093"},
+		{mode: "zookeeper", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			nodes, err := kraft_nodes(tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error state: %v", err)
+			}
+			if !tt.wantErr && kraft_quorum_voters(nodes) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, kraft_quorum_voters(nodes))
+			}
+		})
+	}
+}
+
+func TestRenderKraftCompose(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected []string
+		absent   []string
+	}{
+		{
+			mode: "combined",
+			expected: []string{
+				"KAFKA_PROCESS_ROLES: broker,controller",
+				"KAFKA_LISTENERS: PLAINTEXT://kafka1:19091, EXTERNAL://kafka1:9091, CONTROLLER://kafka1:29091",
+				"KAFKA_ADVERTISED_LISTENERS: PLAINTEXT://kafka3:19093, EXTERNAL://localhost:9093",
+			},
+			absent: []string{"controller1:"},
+		},
+		{
+			mode: "dedicated",
+			expected: []string{
+				"  controller1:\n",
+				"KAFKA_PROCESS_ROLES: controller\n",
+				"KAFKA_PROCESS_ROLES: broker\n",
+				"KAFKA_LISTENERS: CONTROLLER://controller2:9093",
+				"KAFKA_LISTENERS: PLAINTEXT://kafka2:19092, EXTERNAL://kafka2:9092\n",
+			},
+			absent: []string{"broker,controller"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			content, err := render_kraft_compose(tt.mode)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// the services the rest of klaunch talks to keep their names
+			for _, service := range []string{"kafka1", "kafka2", "kafka3", "kafka-connect", "schema-registry", "prometheus", "grafana"} {
+				if !strings.Contains(content, "\n  "+service+":\n") {
+					t.Errorf("Expected service %s in:\n%s", service, content)
+				}
+			}
+			for _, expected := range append(tt.expected, "CLUSTER_ID: "+kraftClusterID, "CONNECT_ZOOKEEPER_CONNECT: !reset null") {
+				if !strings.Contains(content, expected) {
+					t.Errorf("Expected %q in:\n%s", expected, content)
+				}
+			}
+			for _, absent := range append(tt.absent, "KAFKA_ZOOKEEPER_CONNECT", "zookeeper1:", "cmak:") {
+				if strings.Contains(content, absent) {
+					t.Errorf("Did not expect %q in:\n%s", absent, content)
+				}
+			}
+		})
+	}
+}
+
+func TestKraftComposeReusesBaseServices(t *testing.T) {
+	base, err := os.ReadFile(baseComposeFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, err := render_kraft_compose("combined")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// every service of the base file but ZooKeeper, cmak and the brokers is extended, not copied
+	replaced := map[string]bool{"zookeeper1": true, "cmak": true, "kafka1": true, "kafka2": true, "kafka3": true}
+	for _, match := range regexp.MustCompile(`(?m)^  ([a-z0-9-]+):$`).FindAllStringSubmatch(string(base), -1) {
+		service := match[1]
+		if replaced[service] {
+			continue
+		}
+		extends := "  " + service + ":\n    extends:\n      file: " + baseComposeFile + "\n      service: " + service + "\n"
+		if !strings.Contains(content, extends) {
+			t.Errorf("Expected %s to extend the base file in:\n%s", service, content)
+		}
+	}
+	for _, copied := range []string{"image: klaunch/kafka-connect", "cp-schema-registry", "prom/prometheus", "grafana/grafana"} {
+		if strings.Contains(content, copied) {
+			t.Errorf("Did not expect a copy of %q in:\n%s", copied, content)
+		}
+	}
+}
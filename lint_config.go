@@ -0,0 +1,673 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	mongoSourceConnectorClass = "com.mongodb.kafka.connect.MongoSourceConnector"
+	mongoSinkConnectorClass   = "com.mongodb.kafka.connect.MongoSinkConnector"
+)
+
+// lint severities, from most to least serious
+const (
+	lintError   = "ERROR"
+	lintWarning = "WARN"
+	lintInfo    = "INFO"
+)
+
+// document.id.strategy classes that build the _id from the record key, so tombstones can be deleted
+var keyIdStrategies = []string{"ProvidedInKeyStrategy", "FullKeyStrategy", "PartialKeyStrategy"}
+
+var lintSeverityOrder = map[string]int{lintError: 0, lintWarning: 1, lintInfo: 2}
+
+// LintFinding is one problem reported by `klaunch lint`
+type LintFinding struct {
+	Rule        string
+	Severity    string
+	Property    string
+	Message     string
+	Explanation string
+}
+
+// LintTarget is a rendered connector config with its properties flattened to strings
+type LintTarget struct {
+	Path   string
+	Name   string
+	Config map[string]string
+}
+
+// lintRule checks one property combination; kind is "source", "sink" or "" for both
+type lintRule struct {
+	id    string
+	kind  string
+	check func(config map[string]string) *LintFinding
+}
+
+func config_is_true(config map[string]string, key string) bool {
+	return strings.EqualFold(config[key], "true")
+}
+
+// connector_kind maps connector.class to "source" or "sink"; other connectors are not linted
+func connector_kind(config map[string]string) string {
+	switch config["connector.class"] {
+	case mongoSourceConnectorClass:
+		return "source"
+	case mongoSinkConnectorClass:
+		return "sink"
+	}
+	return ""
+}
+
+var lintRules = []lintRule{
+	{
+		id:   "before-change-requires-pre-images",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			mode := config["change.stream.full.document.before.change"]
+			if mode != "whenAvailable" && mode != "required" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintInfo,
+				Property:    "change.stream.full.document.before.change",
+				Message:     fmt.Sprintf("%q needs changeStreamPreAndPostImages enabled on the watched collections (MongoDB 6.0+)", mode),
+				Explanation: "Without pre-images, \"required\" makes the change stream fail and \"whenAvailable\" silently publishes events without fullDocumentBeforeChange. Run with --live to verify the collection.",
+			}
+		},
+	},
+	{
+		id:   "schema-output-without-infer",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			if config["output.format.value"] != "schema" || config["output.schema.value"] != "" || config_is_true(config, "output.schema.infer.value") {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintWarning,
+				Property:    "output.format.value",
+				Message:     "output.format.value=schema without output.schema.infer.value=true or output.schema.value",
+				Explanation: "The default value schema describes the change event envelope only; fullDocument is published as a JSON string instead of a typed struct.",
+			}
+		},
+	},
+	{
+		id:   "schema-output-with-string-converter",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			if config["output.format.value"] != "schema" || !strings.HasSuffix(config["value.converter"], "StringConverter") {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintError,
+				Property:    "value.converter",
+				Message:     "output.format.value=schema is serialized with StringConverter",
+				Explanation: "StringConverter calls toString() on the Struct, producing \"Struct{...}\" text. Use AvroConverter, ProtobufConverter, JsonSchemaConverter or JsonConverter with schemas.enable=true.",
+			}
+		},
+	},
+	{
+		id:   "full-document-only-overrides-full-document",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			fullDocument := config["change.stream.full.document"]
+			if !config_is_true(config, "publish.full.document.only") || fullDocument == "" || fullDocument == "updateLookup" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintInfo,
+				Property:    "change.stream.full.document",
+				Message:     fmt.Sprintf("change.stream.full.document=%s is overridden by publish.full.document.only=true", fullDocument),
+				Explanation: "The connector always opens the change stream with updateLookup in this mode, so updates are published with their full document. Deletes are never published in this mode.",
+			}
+		},
+	},
+	{
+		id:   "json-formatter-ignored",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			if config["output.json.formatter"] == "" || config["output.format.value"] == "" || config["output.format.value"] == "json" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintInfo,
+				Property:    "output.json.formatter",
+				Message:     "output.json.formatter only applies when output.format.value=json",
+				Explanation: "With schema or bson output the formatter setting has no effect.",
+			}
+		},
+	},
+	{
+		id:   "copy-existing-deprecated",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			if !config_is_true(config, "copy.existing") {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintWarning,
+				Property:    "copy.existing",
+				Message:     "copy.existing is deprecated",
+				Explanation: "Use startup.mode=copy_existing and the startup.mode.copy.existing.* properties instead.",
+			}
+		},
+	},
+	{
+		id:   "pipeline-not-json-array",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			pipeline := strings.TrimSpace(config["pipeline"])
+			if pipeline == "" {
+				return nil
+			}
+			if _, err := parse_pipeline_stages(pipeline); err == nil {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintError,
+				Property:    "pipeline",
+				Message:     "pipeline is not a JSON array of stages",
+				Explanation: "The pipeline must be a JSON array such as [{\"$match\": {\"operationType\": \"insert\"}}], escaped inside the config string.",
+			}
+		},
+	},
+	{
+		id:   "pipeline-stage-not-allowed",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			pipeline := strings.TrimSpace(config["pipeline"])
+			if pipeline == "" {
+				return nil
+			}
+			if _, err := parse_pipeline_stages(pipeline); err != nil {
+				return nil
+			}
+			issues := validate_pipeline(pipeline)
+			if len(issues) == 0 {
+				return nil
+			}
+			var messages []string
+			for _, issue := range issues {
+				messages = append(messages, issue.String())
+			}
+			return &LintFinding{
+				Severity:    lintError,
+				Property:    "pipeline",
+				Message:     strings.Join(messages, "; "),
+				Explanation: "Change streams only accept $addFields, $match, $project, $replaceRoot, $replaceWith, $redact, $set, $unset and $changeStreamSplitLargeEvent, and the event _id must be kept to resume.",
+			}
+		},
+	},
+	{
+		id:   "collection-without-database",
+		kind: "",
+		check: func(config map[string]string) *LintFinding {
+			if config["collection"] == "" || config["database"] != "" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintError,
+				Property:    "database",
+				Message:     "collection is set but database is not",
+				Explanation: "The connector ignores collection without database; set both to target a single namespace.",
+			}
+		},
+	},
+	{
+		id:   "source-multiple-tasks",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			if config["tasks.max"] == "" || config["tasks.max"] == "1" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintInfo,
+				Property:    "tasks.max",
+				Message:     fmt.Sprintf("tasks.max=%s has no effect on a source connector", config["tasks.max"]),
+				Explanation: "MongoSourceConnector always runs a single task per change stream.",
+			}
+		},
+	},
+	{
+		id:   "filtered-stream-without-heartbeat",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			if !strings.Contains(config["pipeline"], "$match") || config["heartbeat.interval.ms"] != "" && config["heartbeat.interval.ms"] != "0" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintWarning,
+				Property:    "heartbeat.interval.ms",
+				Message:     "the pipeline filters events but heartbeat.interval.ms is not set",
+				Explanation: "When no event matches for longer than the oplog window the stored resume token expires. Heartbeats keep the offset moving.",
+			}
+		},
+	},
+	{
+		id:   "source-errors-without-dlq",
+		kind: "source",
+		check: func(config map[string]string) *LintFinding {
+			if config["mongo.errors.tolerance"] != "all" || config["mongo.errors.deadletterqueue.topic.name"] != "" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintInfo,
+				Property:    "mongo.errors.deadletterqueue.topic.name",
+				Message:     "mongo.errors.tolerance=all without a dead letter queue topic",
+				Explanation: "Events that cannot be converted are dropped silently unless mongo.errors.log.enable=true.",
+			}
+		},
+	},
+	{
+		id:   "sink-topics-missing",
+		kind: "sink",
+		check: func(config map[string]string) *LintFinding {
+			if config["topics"] != "" || config["topics.regex"] != "" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintError,
+				Property:    "topics",
+				Message:     "neither topics nor topics.regex is set",
+				Explanation: "A sink connector needs at least one topic to consume from.",
+			}
+		},
+	},
+	{
+		id:   "oid-strategy-with-replace",
+		kind: "sink",
+		check: func(config map[string]string) *LintFinding {
+			if !strings.HasSuffix(config["document.id.strategy"], "BsonOidStrategy") || config["change.data.capture.handler"] != "" {
+				return nil
+			}
+			strategy := config["writemodel.strategy"]
+			if strings.HasSuffix(strategy, "InsertOneDefaultStrategy") {
+				return nil
+			}
+			if strategy == "" {
+				strategy = "ReplaceOneDefaultStrategy"
+			}
+			return &LintFinding{
+				Severity:    lintWarning,
+				Property:    "document.id.strategy",
+				Message:     fmt.Sprintf("BsonOidStrategy with %s", strategy[strings.LastIndex(strategy, ".")+1:]),
+				Explanation: "BsonOidStrategy generates a new ObjectId for every record, so replaces and updates never match existing documents and redelivered records become duplicates. Use ProvidedInKeyStrategy or ProvidedInValueStrategy when records carry their own _id.",
+			}
+		},
+	},
+	{
+		id:   "cdc-handler-ignores-post-processors",
+		kind: "sink",
+		check: func(config map[string]string) *LintFinding {
+			if config["change.data.capture.handler"] == "" {
+				return nil
+			}
+			for _, key := range []string{"post.processor.chain", "document.id.strategy", "writemodel.strategy"} {
+				if config[key] != "" {
+					return &LintFinding{
+						Severity:    lintWarning,
+						Property:    key,
+						Message:     fmt.Sprintf("%s is ignored when change.data.capture.handler is set", key),
+						Explanation: "CDC handlers build the write models from the change event themselves; id strategies, post processors and write model strategies do not apply.",
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		id:   "delete-on-null-requires-key-id",
+		kind: "sink",
+		check: func(config map[string]string) *LintFinding {
+			if !config_is_true(config, "delete.on.null.values") {
+				return nil
+			}
+			for _, strategy := range keyIdStrategies {
+				if strings.HasSuffix(config["document.id.strategy"], strategy) {
+					return nil
+				}
+			}
+			return &LintFinding{
+				Severity:    lintError,
+				Property:    "delete.on.null.values",
+				Message:     "delete.on.null.values=true requires a key-based document.id.strategy (" + strings.Join(keyIdStrategies, ", ") + ")",
+				Explanation: "Tombstones have no value, so the _id of the document to delete can only come from the record key.",
+			}
+		},
+	},
+	{
+		id:   "sink-errors-without-dlq",
+		kind: "sink",
+		check: func(config map[string]string) *LintFinding {
+			if config["errors.tolerance"] != "all" || config["errors.deadletterqueue.topic.name"] != "" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintWarning,
+				Property:    "errors.deadletterqueue.topic.name",
+				Message:     "errors.tolerance=all without errors.deadletterqueue.topic.name",
+				Explanation: "Records that fail conversion or transforms are skipped and lost.",
+			}
+		},
+	},
+	{
+		id:   "json-converter-schemas-enabled",
+		kind: "",
+		check: func(config map[string]string) *LintFinding {
+			if !strings.HasSuffix(config["value.converter"], "JsonConverter") || config["value.converter.schemas.enable"] != "" {
+				return nil
+			}
+			return &LintFinding{
+				Severity:    lintWarning,
+				Property:    "value.converter.schemas.enable",
+				Message:     "JsonConverter without value.converter.schemas.enable",
+				Explanation: "schemas.enable defaults to true, which expects every message to be a {\"schema\", \"payload\"} envelope. Set it to false for plain JSON.",
+			}
+		},
+	},
+}
+
+// load_lint_target renders a config and flattens its properties for the rules
+func load_lint_target(path, envName string) (*LintTarget, error) {
+	rendered, err := render_config(path, envName)
+	if err != nil {
+		return nil, err
+	}
+	name, config, err := flatten_rendered_config(rendered)
+	if err != nil {
+		return nil, err
+	}
+	return &LintTarget{Path: path, Name: name, Config: config}, nil
+}
+
+// flatten_rendered_config returns the connector name and its properties as strings
+func flatten_rendered_config(rendered []byte) (string, map[string]string, error) {
+	var doc struct {
+		Name   string                 `json:"name"`
+		Config map[string]interface{} `json:"config"`
+	}
+	if err := json.Unmarshal(rendered, &doc); err != nil {
+		return "", nil, err
+	}
+
+	config := make(map[string]string, len(doc.Config))
+	for key, value := range doc.Config {
+		if value != nil {
+			config[key] = fmt.Sprint(value)
+		}
+	}
+	return doc.Name, config, nil
+}
+
+// lint_connector_config applies the static rules matching the connector class
+func lint_connector_config(config map[string]string) []LintFinding {
+	kind := connector_kind(config)
+	if kind == "" {
+		return []LintFinding{{
+			Rule:     "not-a-mongodb-connector",
+			Severity: lintInfo,
+			Property: "connector.class",
+			Message:  fmt.Sprintf("%q is not a MongoDB connector; only generic checks were applied", config["connector.class"]),
+		}}
+	}
+
+	var findings []LintFinding
+	for _, rule := range lintRules {
+		if rule.kind != "" && rule.kind != kind {
+			continue
+		}
+		if finding := rule.check(config); finding != nil {
+			finding.Rule = rule.id
+			findings = append(findings, *finding)
+		}
+	}
+	return findings
+}
+
+// source_topics returns the topics a source connector writes to, or nil when they depend on
+// the namespace map or the collections found at runtime
+func source_topics(config map[string]string) []string {
+	if config["topic.namespace.map"] != "" || config["database"] == "" || config["collection"] == "" {
+		return nil
+	}
+	separator := config["topic.separator"]
+	if separator == "" {
+		separator = "."
+	}
+	var parts []string
+	for _, part := range []string{config["topic.prefix"], config["database"], config["collection"], config["topic.suffix"]} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return []string{strings.Join(parts, separator)}
+}
+
+func sink_consumes_topic(config map[string]string, topic string) bool {
+	for _, name := range strings.Split(config["topics"], ",") {
+		if strings.TrimSpace(name) == topic {
+			return true
+		}
+	}
+	if pattern := config["topics.regex"]; pattern != "" {
+		if re, err := regexp.Compile("^(?:" + pattern + ")$"); err == nil && re.MatchString(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// lint_connector_pairs checks sources and sinks linted together that share a topic
+func lint_connector_pairs(targets []*LintTarget) map[string][]LintFinding {
+	findings := make(map[string][]LintFinding)
+	for _, source := range targets {
+		if connector_kind(source.Config) != "source" || !config_is_true(source.Config, "publish.full.document.only") {
+			continue
+		}
+		for _, topic := range source_topics(source.Config) {
+			for _, sink := range targets {
+				if connector_kind(sink.Config) != "sink" || !strings.HasSuffix(sink.Config["change.data.capture.handler"], "ChangeStreamHandler") || !sink_consumes_topic(sink.Config, topic) {
+					continue
+				}
+				findings[sink.Path] = append(findings[sink.Path], LintFinding{
+					Rule:        "cdc-handler-with-full-document-only",
+					Severity:    lintError,
+					Property:    "change.data.capture.handler",
+					Message:     fmt.Sprintf("%s consumes %s, which %s publishes with publish.full.document.only=true", sink.Name, topic, source.Name),
+					Explanation: "ChangeStreamHandler needs the full change event (operationType, documentKey, ...), but the source only publishes fullDocument.",
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// lint_live checks the config against the MongoDB deployment it points to
+func lint_live(ctx context.Context, client *mongo.Client, config map[string]string) []LintFinding {
+	var findings []LintFinding
+	admin := client.Database("admin")
+
+	var hello bson.M
+	if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err == nil {
+		if hello["setName"] == nil && hello["msg"] != "isdbgrid" && connector_kind(config) == "source" {
+			findings = append(findings, LintFinding{
+				Rule:        "change-stream-requires-replica-set",
+				Severity:    lintError,
+				Property:    "connection.uri",
+				Message:     "the deployment is a standalone server",
+				Explanation: "Change streams are only available on replica sets and sharded clusters.",
+			})
+		}
+	}
+
+	switch connector_kind(config) {
+	case "source":
+		findings = append(findings, lint_live_pre_images(ctx, client, config)...)
+	case "sink":
+		findings = append(findings, lint_live_sink_ids(ctx, client, config)...)
+	}
+	return findings
+}
+
+func lint_live_pre_images(ctx context.Context, client *mongo.Client, config map[string]string) []LintFinding {
+	mode := config["change.stream.full.document.before.change"]
+	if (mode != "whenAvailable" && mode != "required") || config["database"] == "" {
+		return nil
+	}
+
+	var findings []LintFinding
+	var buildInfo bson.M
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo); err == nil {
+		if version, ok := buildInfo["version"].(string); ok && semver.Compare("v"+version, "v6.0.0") < 0 {
+			findings = append(findings, LintFinding{
+				Rule:        "before-change-requires-pre-images",
+				Severity:    lintError,
+				Property:    "change.stream.full.document.before.change",
+				Message:     fmt.Sprintf("MongoDB %s does not support pre-images", version),
+				Explanation: "fullDocumentBeforeChange requires MongoDB 6.0 or later.",
+			})
+			return findings
+		}
+	}
+
+	status, err := pre_images_status(ctx, client, config["database"], config["collection"])
+	if err != nil {
+		return append(findings, LintFinding{Rule: "live-check-failed", Severity: lintWarning, Message: err.Error()})
+	}
+
+	severity := lintWarning
+	if mode == "required" {
+		severity = lintError
+	}
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if status[name] {
+			continue
+		}
+		findings = append(findings, LintFinding{
+			Rule:        "before-change-requires-pre-images",
+			Severity:    severity,
+			Property:    "change.stream.full.document.before.change",
+			Message:     fmt.Sprintf("pre-images are not enabled on %s.%s", config["database"], name),
+			Explanation: fmt.Sprintf("Run `klaunch mongo preimages enable %s.%s`.", config["database"], name),
+		})
+	}
+	return findings
+}
+
+func lint_live_sink_ids(ctx context.Context, client *mongo.Client, config map[string]string) []LintFinding {
+	if !strings.HasSuffix(config["document.id.strategy"], "BsonOidStrategy") || config["database"] == "" {
+		return nil
+	}
+	collection := config["collection"]
+	if collection == "" {
+		// the sink writes to a collection named after the topic by default
+		collection = strings.Split(config["topics"], ",")[0]
+	}
+	if collection == "" {
+		return nil
+	}
+
+	var doc bson.M
+	err := client.Database(config["database"]).Collection(collection).FindOne(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$type", Value: "objectId"}}}}}}).Decode(&doc)
+	if err != nil {
+		return nil
+	}
+	return []LintFinding{{
+		Rule:        "bson-oid-strategy-non-objectid",
+		Severity:    lintWarning,
+		Property:    "document.id.strategy",
+		Message:     fmt.Sprintf("%s.%s already holds documents whose _id is not an ObjectId (e.g. %v)", config["database"], collection, doc["_id"]),
+		Explanation: "Records written with BsonOidStrategy get a new ObjectId and never replace or update these documents.",
+	}}
+}
+
+func drop_lint_findings(findings []LintFinding, rule string) []LintFinding {
+	kept := findings[:0]
+	for _, finding := range findings {
+		if finding.Rule != rule {
+			kept = append(kept, finding)
+		}
+	}
+	return kept
+}
+
+// sort_lint_findings orders findings by severity, keeping rule order within a severity
+func sort_lint_findings(findings []LintFinding) {
+	sort.SliceStable(findings, func(a, b int) bool {
+		return lintSeverityOrder[findings[a].Severity] < lintSeverityOrder[findings[b].Severity]
+	})
+}
+
+func format_lint_findings(target *LintTarget, findings []LintFinding) string {
+	var b strings.Builder
+	class := target.Config["connector.class"]
+	fmt.Fprintf(&b, "%s (%s, %s)\n", target.Path, target.Name, class[strings.LastIndex(class, ".")+1:])
+	if len(findings) == 0 {
+		b.WriteString("  ✅ no problems found\n")
+		return b.String()
+	}
+	for _, finding := range findings {
+		fmt.Fprintf(&b, "  %-5s %s: %s\n", finding.Severity, finding.Rule, finding.Message)
+		if finding.Explanation != "" {
+			fmt.Fprintf(&b, "        %s\n", finding.Explanation)
+		}
+	}
+	return b.String()
+}
+
+// lint_configs lints every file and returns the number of errors found
+func lint_configs(paths []string, envName string, live bool) (int, error) {
+	var targets []*LintTarget
+	for _, path := range paths {
+		target, err := load_lint_target(path, envName)
+		if err != nil {
+			return 0, err
+		}
+		targets = append(targets, target)
+	}
+
+	pairFindings := lint_connector_pairs(targets)
+	counts := make(map[string]int)
+	for _, target := range targets {
+		findings := lint_connector_config(target.Config)
+		findings = append(findings, pairFindings[target.Path]...)
+
+		if live && connector_kind(target.Config) != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			client, err := connect_mongo(ctx, target_for_config(target.Config))
+			if err != nil {
+				findings = append(findings, LintFinding{Rule: "live-check-failed", Severity: lintWarning, Property: "connection.uri", Message: err.Error()})
+			} else {
+				// the live pre-image check replaces the static reminder
+				findings = drop_lint_findings(findings, "before-change-requires-pre-images")
+				findings = append(findings, lint_live(ctx, client, target.Config)...)
+				client.Disconnect(context.Background())
+			}
+			cancel()
+		}
+
+		sort_lint_findings(findings)
+		for _, finding := range findings {
+			counts[finding.Severity]++
+		}
+		fmt.Println(format_lint_findings(target, findings))
+	}
+
+	fmt.Printf("%d errors, %d warnings, %d info\n", counts[lintError], counts[lintWarning], counts[lintInfo])
+	return counts[lintError], nil
+}
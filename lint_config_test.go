@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func finding_rules(findings []LintFinding) string {
+	var rules []string
+	for _, finding := range findings {
+		rules = append(rules, finding.Severity+" "+finding.Rule)
+	}
+	return strings.Join(rules, ",")
+}
+
+func TestLintConnectorConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected []string
+		absent   []string
+	}{
+		{
+			name: "schema output without infer",
+			config: map[string]string{
+				"connector.class":     mongoSourceConnectorClass,
+				"output.format.value": "schema",
+				"value.converter":     "org.apache.kafka.connect.storage.StringConverter",
+			},
+			expected: []string{"WARN schema-output-without-infer", "ERROR schema-output-with-string-converter"},
+		},
+		{
+			name: "schema output with inference",
+			config: map[string]string{
+				"connector.class":           mongoSourceConnectorClass,
+				"output.format.value":       "schema",
+				"output.schema.infer.value": "true",
+				"value.converter":           "io.confluent.connect.avro.AvroConverter",
+			},
+			absent: []string{"schema-output-without-infer", "schema-output-with-string-converter"},
+		},
+		{
+			name: "before change without live check",
+			config: map[string]string{
+				"connector.class": mongoSourceConnectorClass,
+				"database":        "db",
+				"collection":      "coll",
+				"change.stream.full.document.before.change": "required",
+			},
+			expected: []string{"INFO before-change-requires-pre-images"},
+		},
+		{
+			name: "full document only overrides full document",
+			config: map[string]string{
+				"connector.class":             mongoSourceConnectorClass,
+				"publish.full.document.only":  "true",
+				"change.stream.full.document": "default",
+			},
+			expected: []string{"INFO full-document-only-overrides-full-document"},
+		},
+		{
+			name: "full document only without full document",
+			config: map[string]string{
+				"connector.class":            mongoSourceConnectorClass,
+				"publish.full.document.only": "true",
+			},
+			absent: []string{"full-document-only-overrides-full-document"},
+		},
+		{
+			name: "filtered pipeline with heartbeat",
+			config: map[string]string{
+				"connector.class":       mongoSourceConnectorClass,
+				"pipeline":              `[{"$match": {"operationType": "insert"}}]`,
+				"heartbeat.interval.ms": "10000",
+			},
+			absent: []string{"filtered-stream-without-heartbeat", "pipeline-not-json-array"},
+		},
+		{
+			name: "pipeline stage not allowed",
+			config: map[string]string{
+				"connector.class": mongoSourceConnectorClass,
+				"pipeline":        `[{"$sort": {"clusterTime": 1}}]`,
+			},
+			expected: []string{"ERROR pipeline-stage-not-allowed"},
+			absent:   []string{"pipeline-not-json-array"},
+		},
+		{
+			name: "sink with oid strategy and default write model",
+			config: map[string]string{
+				"connector.class":      mongoSinkConnectorClass,
+				"topics":               "orders",
+				"document.id.strategy": "com.mongodb.kafka.connect.sink.processor.id.strategy.BsonOidStrategy",
+			},
+			expected: []string{"WARN oid-strategy-with-replace"},
+		},
+		{
+			name: "sink cdc handler with source-only property",
+			config: map[string]string{
+				"connector.class":             mongoSinkConnectorClass,
+				"topics":                      "orders",
+				"change.data.capture.handler": "com.mongodb.kafka.connect.sink.cdc.mongodb.ChangeStreamHandler",
+				"publish.full.document.only":  "true",
+			},
+			absent: []string{"cdc-handler-with-full-document-only"},
+		},
+		{
+			name: "sink without topics and tolerance without dlq",
+			config: map[string]string{
+				"connector.class":  mongoSinkConnectorClass,
+				"errors.tolerance": "all",
+			},
+			expected: []string{"ERROR sink-topics-missing", "WARN sink-errors-without-dlq"},
+		},
+		{
+			name: "delete on null with value strategy",
+			config: map[string]string{
+				"connector.class":       mongoSinkConnectorClass,
+				"topics":                "orders",
+				"delete.on.null.values": "true",
+				"document.id.strategy":  "com.mongodb.kafka.connect.sink.processor.id.strategy.BsonOidStrategy",
+			},
+			expected: []string{"ERROR delete-on-null-requires-key-id"},
+		},
+		{
+			name: "delete on null with provided in key strategy",
+			config: map[string]string{
+				"connector.class":       mongoSinkConnectorClass,
+				"topics":                "orders",
+				"delete.on.null.values": "true",
+				"document.id.strategy":  "com.mongodb.kafka.connect.sink.processor.id.strategy.ProvidedInKeyStrategy",
+			},
+			absent: []string{"delete-on-null-requires-key-id"},
+		},
+		{
+			name: "delete on null with full key strategy",
+			config: map[string]string{
+				"connector.class":       mongoSinkConnectorClass,
+				"topics":                "orders",
+				"delete.on.null.values": "true",
+				"document.id.strategy":  "com.mongodb.kafka.connect.sink.processor.id.strategy.FullKeyStrategy",
+			},
+			absent: []string{"delete-on-null-requires-key-id"},
+		},
+		{
+			name: "delete on null with partial key strategy",
+			config: map[string]string{
+				"connector.class":       mongoSinkConnectorClass,
+				"topics":                "orders",
+				"delete.on.null.values": "true",
+				"document.id.strategy":  "com.mongodb.kafka.connect.sink.processor.id.strategy.PartialKeyStrategy",
+				"document.id.strategy.partial.key.projection.type": "AllowList",
+				"document.id.strategy.partial.key.projection.list": "orderId",
+			},
+			absent: []string{"delete-on-null-requires-key-id"},
+		},
+		{
+			name:     "other connectors",
+			config:   map[string]string{"connector.class": "io.confluent.connect.jdbc.JdbcSinkConnector"},
+			expected: []string{"INFO not-a-mongodb-connector"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := finding_rules(lint_connector_config(tt.config))
+			for _, expected := range tt.expected {
+				if !strings.Contains(result, expected) {
+					t.Errorf("Expected %q in %s", expected, result)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(result, absent) {
+					t.Errorf("Did not expect %q in %s", absent, result)
+				}
+			}
+		})
+	}
+}
+
+func TestLintConnectorPairs(t *testing.T) {
+	source := &LintTarget{Path: "source.json", Name: "orders-source", Config: map[string]string{
+		"connector.class":            mongoSourceConnectorClass,
+		"topic.prefix":               "shop",
+		"database":                   "sales",
+		"collection":                 "orders",
+		"publish.full.document.only": "true",
+	}}
+	sink := &LintTarget{Path: "sink.json", Name: "orders-sink", Config: map[string]string{
+		"connector.class":             mongoSinkConnectorClass,
+		"topics.regex":                "shop\\.sales\\..*",
+		"change.data.capture.handler": "com.mongodb.kafka.connect.sink.cdc.mongodb.ChangeStreamHandler",
+	}}
+
+	findings := lint_connector_pairs([]*LintTarget{source, sink})
+	if len(findings["sink.json"]) != 1 || findings["sink.json"][0].Severity != lintError {
+		t.Fatalf("Expected one error for the sink, got %v", findings)
+	}
+	if !strings.Contains(findings["sink.json"][0].Message, "shop.sales.orders") {
+		t.Errorf("Expected the shared topic in the message, got %s", findings["sink.json"][0].Message)
+	}
+	if len(findings["source.json"]) != 0 {
+		t.Errorf("Did not expect findings for the source, got %v", findings["source.json"])
+	}
+}
+
+func TestLintLivePreImages(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	config := map[string]string{
+		"connector.class": mongoSourceConnectorClass,
+		"database":        "source_db_test",
+		"collection":      "source_collection_test",
+		"change.stream.full.document.before.change": "required",
+	}
+
+	mt.Run("pre-images disabled", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "setName", Value: "replset"}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "version", Value: "7.0.12"}},
+			mtest.CreateCursorResponse(0, "source_db_test.$cmd.listCollections", mtest.FirstBatch, bson.D{
+				{Key: "name", Value: "source_collection_test"},
+				{Key: "type", Value: "collection"},
+				{Key: "options", Value: bson.D{}},
+			}),
+		)
+
+		result := finding_rules(lint_live(context.Background(), mt.Client, config))
+		if result != "ERROR before-change-requires-pre-images" {
+			t.Errorf("Expected a pre-image error, got %s", result)
+		}
+	})
+
+	mt.Run("pre-images enabled", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "setName", Value: "replset"}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "version", Value: "7.0.12"}},
+			mtest.CreateCursorResponse(0, "source_db_test.$cmd.listCollections", mtest.FirstBatch, bson.D{
+				{Key: "name", Value: "source_collection_test"},
+				{Key: "type", Value: "collection"},
+				{Key: "options", Value: bson.D{{Key: "changeStreamPreAndPostImages", Value: bson.D{{Key: "enabled", Value: true}}}}},
+			}),
+		)
+
+		if findings := lint_live(context.Background(), mt.Client, config); len(findings) != 0 {
+			t.Errorf("Expected no findings, got %v", findings)
+		}
+	})
+
+	mt.Run("standalone server", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "isWritablePrimary", Value: true}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "version", Value: "5.0.3"}},
+		)
+
+		result := finding_rules(lint_live(context.Background(), mt.Client, config))
+		for _, expected := range []string{"ERROR change-stream-requires-replica-set", "ERROR before-change-requires-pre-images"} {
+			if !strings.Contains(result, expected) {
+				t.Errorf("Expected %q in %s", expected, result)
+			}
+		}
+	})
+}
@@ -3,7 +3,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os/exec"
+	"sort"
 	"strings"
 )
 
@@ -38,11 +41,22 @@ var excludedTopics = []ExcludedTopic{
 	{"docker-connect-status"},
 }
 
-func list_components(verbose bool) error {
+func list_components(verbose bool, showConfig bool) error {
 	_, err := list_connectors(verbose)
 	if err != nil {
 		return err
 	}
+
+	// distributed mode: show which worker runs each connector and task
+	if err := list_worker_assignments(false); err != nil {
+		return err
+	}
+
+	if showConfig {
+		if err := list_connector_configs(); err != nil {
+			return err
+		}
+	}
 	
 	_, err = list_topics()
 	if err != nil {
@@ -81,7 +95,8 @@ func format_task_output(name string, tasks []TaskStatus, verbose bool) {
 		
 		// Show error details for failed tasks
 		if strings.ToUpper(task.State) == "FAILED" && task.Trace != "" {
-			errorMsg := extractErrorMessage(task.Trace, verbose)
+			// traces echo config values such as connection.uri
+			errorMsg := extractErrorMessage(redact_text(task.Trace), verbose)
 			if errorMsg != "" {
 				if verbose {
 					fmt.Printf("│       └── %s", errorMsg)
@@ -90,10 +105,22 @@ func format_task_output(name string, tasks []TaskStatus, verbose bool) {
 					fmt.Printf("│       └── Use './klaunch show components --verbose' for full stack trace\n")
 				}
 			}
+			if rule := classify_failure_trace(task.Trace, failure_rules()); rule != nil {
+				format_failure_hint(rule)
+			}
 		}
 	}
 }
 
+func format_failure_hint(rule *FailureRule) {
+	fmt.Printf("│       └── 💡 Known issue: %s [%s]\n", rule.Title, rule.ID)
+	fmt.Printf("│           Likely cause: %s\n", rule.Cause)
+	fmt.Printf("│           Remediation: %s\n", rule.Remediation)
+	for _, ref := range rule.References {
+		fmt.Printf("│           See: %s\n", ref)
+	}
+}
+
 func extractErrorMessage(trace string, verbose bool) string {
 	if trace == "" {
 		return ""
@@ -168,6 +195,102 @@ func list_connector_status(connectorName string) (*ConnectorStatus, error) {
 	return &status, nil
 }
 
+// connect_rest_get fetches a path from the Kafka Connect REST API exposed on localhost
+func connect_rest_get(path string) ([]byte, error) {
+	return connect_worker_rest_get(firstConnectRestPort, path)
+}
+
+// connect_worker_rest_get sends a GET to the REST port a Connect worker publishes on the host
+func connect_worker_rest_get(port int, path string) ([]byte, error) {
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d%s", port, path))
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s failed: %s", path, resp.Status)
+	}
+	return body, nil
+}
+
+// list_connector_configs prints the deployed configuration of every connector, with credentials masked
+func list_connector_configs() error {
+	output, err := connect_rest_get("/connectors")
+	if err != nil {
+		return err
+	}
+
+	var connectorNames []string
+	if err := json.Unmarshal(output, &connectorNames); err != nil {
+		return fmt.Errorf("failed to parse connector list: %v", err)
+	}
+	sort.Strings(connectorNames)
+
+	fmt.Println("\nConnector configurations:")
+	for _, name := range connectorNames {
+		raw, err := connect_rest_get(fmt.Sprintf("/connectors/%s/config", name))
+		if err != nil {
+			fmt.Printf("├── %s [ERROR: %v]\n", name, err)
+			continue
+		}
+
+		var config map[string]string
+		if err := json.Unmarshal(raw, &config); err != nil {
+			fmt.Printf("├── %s [ERROR: failed to parse config: %v]\n", name, err)
+			continue
+		}
+
+		fmt.Printf("├── %s\n", name)
+		format_connector_config(redact_connector_config(config))
+	}
+	return nil
+}
+
+func format_connector_config(config map[string]string) {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "pipeline" && strings.TrimSpace(config[key]) != "" {
+			format_pipeline_property(config[key], "│   ")
+			continue
+		}
+		fmt.Printf("│   %s = %s\n", key, config[key])
+	}
+}
+
+// fetch_connector_statuses returns the status of every connector without printing anything
+func fetch_connector_statuses() (map[string]*ConnectorStatus, error) {
+	listCmd := exec.Command("docker", "exec", "kafka-connect", "curl", "-s", "http://localhost:8083/connectors")
+	output, err := listCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connectors: %v", err)
+	}
+
+	var connectorNames []string
+	if err := json.Unmarshal(output, &connectorNames); err != nil {
+		return nil, fmt.Errorf("failed to parse connector list: %v", err)
+	}
+
+	statuses := make(map[string]*ConnectorStatus, len(connectorNames))
+	for _, name := range connectorNames {
+		status, err := list_connector_status(name)
+		if err != nil {
+			return nil, err
+		}
+		statuses[name] = status
+	}
+	return statuses, nil
+}
+
 func list_connectors(verbose bool) (string, error) {
 	listCmd := exec.Command("docker", "exec", "kafka-connect", "curl", "-s", "http://localhost:8083/connectors")
 	output, err := listCmd.Output()
@@ -202,7 +325,15 @@ func list_connectors(verbose bool) (string, error) {
 		}
 
 		fmt.Printf("├── %s [%s]\n", name, connectorState)
-		
+
+		// A connector can fail before any task starts; classify its own trace too
+		if connectorTrace := connector_field(status, "trace"); strings.ToUpper(connectorState) == "FAILED" && connectorTrace != "" {
+			fmt.Printf("│   └── Error: %s\n", extractErrorMessage(redact_text(connectorTrace), false))
+			if rule := classify_failure_trace(connectorTrace, failure_rules()); rule != nil {
+				format_failure_hint(rule)
+			}
+		}
+
 		// Use the new formatting function
 		format_task_output(name, status.Tasks, verbose)
 	}
@@ -211,7 +342,7 @@ func list_connectors(verbose bool) (string, error) {
 }
 
 func list_topics() ([]string, error) {
-	listCmd := exec.Command("docker", "exec", "kafka-connect", "kafka-topics", "--bootstrap-server=kafka2:19092,kafka3:19093,kafka1:19091", "--list")
+	listCmd := exec.Command("docker", kafka_cli_args("kafka-topics", "--list")...)
 	output, err := listCmd.Output()
 	if err != nil {
 		return nil, err
@@ -66,7 +66,7 @@ func list_messages() error {
 	fmt.Printf("Connecting to Kafka brokers: %s\n", brokers)
 	fmt.Printf("Consumer group: %s\n", group)
 
-	c, err := kafka.NewConsumer(&kafka.ConfigMap{
+	config := kafka.ConfigMap{
 		"bootstrap.servers":        brokers,
 		"group.id":                 group,
 		"session.timeout.ms":       30000,  // Increased from 6000 to 30000
@@ -78,7 +78,12 @@ func list_messages() error {
 		"auto.offset.reset":        "earliest",
 		"enable.auto.commit":       true,
 		"auto.commit.interval.ms":  5000,
-	})
+	}
+	// credentials of the listener security chosen at start
+	for key, value := range librdkafka_client_config(kafka_security_mode()) {
+		config[key] = value
+	}
+	c, err := kafka.NewConsumer(&config)
 
 	if err != nil {
 		fmt.Printf("Failed to create consumer: %v\n", err)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"time"
 
@@ -17,6 +18,14 @@ func main() {
 		Long:  `Klaunch is a CLI tool to manage Docker infrastructure components like starting, stopping, creating, deleting, and showing logs of tasks and topics.`,
 	}
 
+	rootCmd.PersistentFlags().BoolVar(&showSecrets, "show-secrets", false, "Do not redact credentials in displayed or exported configs, logs and bundles")
+	rootCmd.PersistentFlags().StringVar(&mongoTargetFlags.URI, "mongo-uri", "", "MongoDB deployment to use (default: MONGO_URI from the environment or .klaunch.env, then the local replica set)")
+	rootCmd.PersistentFlags().StringVar(&mongoTargetFlags.Username, "mongo-username", "", "MongoDB SCRAM username (default: MONGO_USERNAME; the password is read from MONGO_PASSWORD)")
+	rootCmd.PersistentFlags().StringVar(&mongoTargetFlags.AuthMechanism, "mongo-auth-mechanism", "", "MongoDB auth mechanism: SCRAM-SHA-256, SCRAM-SHA-1 or MONGODB-X509 (default: MONGO_AUTH_MECHANISM or the URI)")
+	rootCmd.PersistentFlags().StringVar(&mongoTargetFlags.AuthSource, "mongo-auth-source", "", "MongoDB authentication database (default: MONGO_AUTH_SOURCE or the URI)")
+	rootCmd.PersistentFlags().StringVar(&mongoTargetFlags.TLSCAFile, "mongo-tls-ca-file", "", "CA file used to verify the MongoDB servers (default: MONGO_TLS_CA_FILE)")
+	rootCmd.PersistentFlags().StringVar(&mongoTargetFlags.TLSCertKeyFile, "mongo-tls-cert-key-file", "", "Client certificate and key PEM file; selects X.509 auth without other credentials (default: MONGO_TLS_CERT_KEY_FILE)")
+
 	var startCmd = &cobra.Command{
 		Use:   "start [connectorVersion]",
 		Short: "Starts klaunch with specified connector version",
@@ -31,18 +40,71 @@ func main() {
 				connectorVersion = ""
 			}
 
-			if err := check_mongodb_running(); err != nil {
-				fmt.Println("Error checking for running MongoDB:", err)
-				fmt.Println("\nDISREGARD in case you are using Atlas as source or destination")
+			mongoTopology, _ := cmd.Flags().GetString("mongo-topology")
+			connectWorkers, _ := cmd.Flags().GetInt("connect-workers")
+			kraft, _ := cmd.Flags().GetString("kraft")
+			security, _ := cmd.Flags().GetString("security")
+			composeOpts := ComposeOptions{MongoTopology: mongoTopology, ConnectWorkers: connectWorkers, Kraft: kraft, Security: security}
+			composeArgs, err := compose_up_args(composeOpts)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			cpVersionFlag, _ := cmd.Flags().GetString("cp-version")
+			cpVersion := resolve_cp_version(cpVersionFlag)
+			if err := validate_cp_version(cpVersion, kraft != ""); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if err := validate_security_support(security, cpVersion, kraft != ""); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if err := record_cp_version(cpVersion); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if _, err := set_env_value(".env", "KAFKA_SECURITY", security); err != nil {
+				fmt.Println("Error recording KAFKA_SECURITY in .env:", err)
+				return
+			}
+			if err := write_compose_overlays(composeOpts); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if err := ensure_plugins_dir(); err != nil {
+				fmt.Println("Error preparing the plugins directory:", err)
+				return
+			}
+
+			// the sharded cluster runs in compose; the local replica set is not used
+			if mongoTopology != "sharded" {
+				if err := check_mongodb_running(); err != nil {
+					fmt.Println("Error checking MongoDB:", err)
+					fmt.Println("Pass --mongo-uri (or set MONGO_URI in .klaunch.env) to check another deployment such as Atlas")
+				}
 			}
 
-			if err := check_connector_updates(connectorVersion); err != nil {
+			connectorJar, _ := cmd.Flags().GetString("connector-jar")
+			jarVersion := ""
+			if connectorJar != "" {
+				if connectorVersion != "" {
+					fmt.Println("Error: pass either a connector version or --connector-jar")
+					return
+				}
+				if jarVersion, err = install_connector_jar(connectorJar); err != nil {
+					fmt.Println("Error installing the connector jar:", err)
+					return
+				}
+			} else if err := check_connector_updates(connectorVersion); err != nil {
 				fmt.Println("Error checking for connector updates:", err)
 				fmt.Println("\nValidate available network Connection")
 			}
+			// compose does not recreate running workers when only the jar content changed
+			runningWorkers, _ := running_connect_workers()
 
 			dockerCmd := exec.Command("open", "-a", "Docker")
-			err := dockerCmd.Run()
+			err = dockerCmd.Run()
 			if err != nil {
 				fmt.Println("Error: Docker daemon not running", err)
 			} else {
@@ -51,21 +113,58 @@ func main() {
 			}
 
 			fmt.Println("Checking to pull docker images...(this can take a few minutes)")
-			composeCmd := exec.Command("docker-compose", "-p", "klaunch", "up", "-d")
+			composeCmd := exec.Command("docker-compose", composeArgs...)
 			err = composeCmd.Run()
 			if err != nil {
-				composeCmd = exec.Command("docker", "compose", "-p", "klaunch", "up", "-d")
+				composeCmd = exec.Command("docker", append([]string{"compose"}, composeArgs...)...)
 				err = composeCmd.Run()
 				if err != nil {
 					fmt.Println("Error starting docker compose:", err)
-				} else {
-					fmt.Println("Klaunch docker compose started successfully!")
+					return
 				}
+				fmt.Println("Klaunch docker compose started successfully!")
 			} else {
 				fmt.Println("Klaunch docker-compose started successfully!")
 			}
+
+			if security == "sasl-scram" {
+				if err := create_scram_user(2 * time.Minute); err != nil {
+					fmt.Println("Error:", err)
+				}
+			}
+			fmt.Println(describe_security(security))
+
+			if connectorJar != "" {
+				workers := []int{1}
+				if len(runningWorkers) > 0 {
+					if workers, err = recreate_connect_workers(); err != nil {
+						fmt.Println("Error restarting Kafka Connect:", err)
+					}
+				} else if connectWorkers > 1 {
+					workers, _ = running_connect_workers()
+				}
+				if err := confirm_connector_plugins(workers, jarVersion, 3*time.Minute); err != nil {
+					fmt.Println("Error:", err)
+				}
+			}
+
+			if mongoTopology == "sharded" {
+				shardCollection, _ := cmd.Flags().GetString("shard-collection")
+				if err := setup_sharded_cluster(shardCollection); err != nil {
+					fmt.Println("Error setting up the sharded cluster:", err)
+				}
+			}
 		}}
 
+	startCmd.Flags().String("mongo-topology", "replicaset", "MongoDB topology: replicaset (the local replica set) or sharded (config server, two shards and mongos in compose)")
+	startCmd.Flags().String("shard-collection", defaultShardCollection, "Collection sharded on a hashed _id with --mongo-topology sharded")
+	startCmd.Flags().Int("connect-workers", 1, "Number of Kafka Connect workers in the connect-cluster-group (REST ports 8083, 8084, ...); more than 1 needs Docker Compose 2.24.4 or later")
+	startCmd.Flags().String("kraft", "", "Run Kafka in KRaft mode without ZooKeeper: combined (controllers in kafka1-3) or dedicated (controller1-3); --kraft alone means combined; needs Docker Compose 2.24.4 or later")
+	startCmd.Flags().Lookup("kraft").NoOptDefVal = "combined"
+	startCmd.Flags().String("security", "plaintext", "Kafka listener security: plaintext, sasl-scram, sasl-plain or mtls (SASL_SSL/SSL with a generated local CA in secrets/)")
+	startCmd.Flags().String("connector-jar", "", "Locally built mongo-kafka-connect -all jar to deploy instead of a Maven release")
+	startCmd.Flags().String("cp-version", "", "Confluent Platform release of every Confluent image, e.g. 7.6.1 (default: CP_VERSION from .klaunch.env, then the last one used, then "+defaultCPVersion+")")
+
 	var stopCmd = &cobra.Command{
 		Use:   "stop",
 		Short: "Stops klaunch and removes all containers",
@@ -94,6 +193,11 @@ func main() {
 				}
 			}
 			fmt.Println("Containers removed successfully!")
+
+			if err := restore_replica_set(); err != nil {
+				fmt.Println("Error restoring the replica set member hostnames:", err)
+				fmt.Printf("The original config is kept in %s\n", replicaSetBackupFile)
+			}
 		},
 	}
 
@@ -101,8 +205,9 @@ func main() {
 		Use:   "create",
 		Short: "Creates a new Kafka task",
 		Run: func(cmd *cobra.Command, args []string) {
+			envName, _ := cmd.Flags().GetString("env")
 			fmt.Println("Creating new Kafka task...")
-			if err := create_kafka_task(); err != nil {
+			if err := create_kafka_task(envName); err != nil {
 				fmt.Println("Error creating new task:", err)
 			} else {
 				fmt.Println("New task created successfully!")
@@ -110,6 +215,553 @@ func main() {
 		},
 	}
 
+	createCmd.Flags().String("env", "", "Environment used to render the config (loads .klaunch.<env>.env and sets KLAUNCH_ENV)")
+
+	var renderCmd = &cobra.Command{
+		Use:   "render <file>",
+		Short: "Shows the final JSON of a case config after variables and extends are resolved",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName, _ := cmd.Flags().GetString("env")
+			rendered, err := render_config(args[0], envName)
+			if err != nil {
+				fmt.Println("Error rendering configuration:", err)
+				return
+			}
+			fmt.Println(redact_text(string(rendered)))
+			// on stderr so the rendered JSON can still be redirected to a file
+			print_rendered_pipeline(rendered)
+		},
+	}
+
+	renderCmd.Flags().String("env", "", "Environment used to render the config (loads .klaunch.<env>.env and sets KLAUNCH_ENV)")
+
+	var fixCmd = &cobra.Command{
+		Use:   "fix <file>",
+		Short: "Repairs a malformed connector config and writes a corrected copy",
+		Long: `Detect and repair the defects commonly found in configs sent by customers: unescaped quotes
+inside string values such as the pipeline, trailing commas, duplicate keys, properties that are not
+nested under "config" and flat .properties files. The corrected config is written to
+<file>.fixed.json unless --output or --in-place is given.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			output, _ := cmd.Flags().GetString("output")
+			inPlace, _ := cmd.Flags().GetBool("in-place")
+			if inPlace {
+				output = args[0]
+			}
+			if err := fix_config_file(args[0], output); err != nil {
+				fmt.Println("Error fixing configuration:", err)
+			}
+		},
+	}
+
+	fixCmd.Flags().String("output", "", "Path of the corrected config (default <file>.fixed.json)")
+	fixCmd.Flags().Bool("in-place", false, "Overwrite the input file")
+
+	var lintCmd = &cobra.Command{
+		Use:   "lint <file>...",
+		Short: "Checks MongoDB source and sink connector configs for semantic mistakes",
+		Long: `Check MongoSourceConnector and MongoSinkConnector configs for property combinations that Connect
+accepts but that do not behave as intended. Findings are reported as ERROR, WARN or INFO with an
+explanation. Sources and sinks linted together are also checked against each other through their
+shared topics. With --live the config is also checked against the MongoDB deployment it points to
+(replica set, server version, pre-images, existing _id types). Exits with status 1 when errors are found.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName, _ := cmd.Flags().GetString("env")
+			live, _ := cmd.Flags().GetBool("live")
+			errors, err := lint_configs(args, envName, live)
+			if err != nil {
+				fmt.Println("Error linting configuration:", err)
+				os.Exit(1)
+			}
+			if errors > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	lintCmd.Flags().String("env", "", "Environment used to render the config (loads .klaunch.<env>.env and sets KLAUNCH_ENV)")
+	lintCmd.Flags().Bool("live", false, "Also check the config against the live MongoDB deployment")
+
+	var pipelineCmd = &cobra.Command{
+		Use:   "pipeline",
+		Short: "Works with the aggregation pipeline of a source connector config",
+	}
+
+	var pipelineTestCmd = &cobra.Command{
+		Use:   "test <file>",
+		Short: "Runs the config pipeline as a change stream and shows the events emitted for a sample document",
+		Long: `Open a change stream with the pipeline and change stream settings of a MongoSourceConnector config,
+then insert, update and delete a sample document in the watched namespace. Each event is shown as the
+connector would publish it, or as filtered out by the pipeline. The sample document is removed again.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var opts PipelineTestOptions
+			opts.EnvName, _ = cmd.Flags().GetString("env")
+			opts.Collection, _ = cmd.Flags().GetString("collection")
+			opts.Sample, _ = cmd.Flags().GetString("sample")
+			opts.Timeout, _ = cmd.Flags().GetDuration("timeout")
+			if err := test_pipeline(args[0], opts); err != nil {
+				fmt.Println("Error testing pipeline:", err)
+			}
+		},
+	}
+
+	pipelineTestCmd.Flags().String("env", "", "Environment used to render the config (loads .klaunch.<env>.env and sets KLAUNCH_ENV)")
+	pipelineTestCmd.Flags().String("collection", "", "Collection for the sample document when the connector watches a whole database")
+	pipelineTestCmd.Flags().String("sample", "", "Sample document as extended JSON (default: a generated document)")
+	pipelineTestCmd.Flags().Duration("timeout", 3*time.Second, "How long to wait for change events")
+	pipelineCmd.AddCommand(pipelineTestCmd)
+
+	var mongoCmd = &cobra.Command{
+		Use:   "mongo",
+		Short: "Manages settings of the MongoDB deployment used by the connectors",
+	}
+
+	var topologyCmd = &cobra.Command{
+		Use:   "topology",
+		Short: "Shows the replica set name, members, primary, version and change stream support",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := report_mongo_topology(resolve_mongo_target()); err != nil {
+				fmt.Println("Error reading MongoDB topology:", err)
+			}
+		},
+	}
+
+	mongoCmd.AddCommand(topologyCmd)
+
+	var changesCmd = &cobra.Command{
+		Use:   "changes <db.coll>",
+		Short: "Tails a change stream with the fullDocument options of a connector config",
+		Long: `Print every change event of a collection with its cluster time and resume token, as MongoDB
+produces it before the connector pipeline. --config applies the change.stream.full.document and
+change.stream.full.document.before.change settings (and connection.uri) of a source config.
+--resume-after takes a resume token such as {"_data": "8265..."}; --start-at takes an RFC 3339 time,
+a duration before now (15m) or unix seconds.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var opts ChangesOptions
+			opts.ConfigPath, _ = cmd.Flags().GetString("config")
+			opts.EnvName, _ = cmd.Flags().GetString("env")
+			opts.ResumeAfter, _ = cmd.Flags().GetString("resume-after")
+			opts.StartAt, _ = cmd.Flags().GetString("start-at")
+			opts.Limit, _ = cmd.Flags().GetInt("limit")
+			if err := watch_changes(args[0], opts); err != nil {
+				fmt.Println("Error watching changes:", err)
+			}
+		},
+	}
+
+	changesCmd.Flags().String("config", "", "Source connector config whose change stream options are used")
+	changesCmd.Flags().String("env", "", "Environment used to render the config (loads .klaunch.<env>.env and sets KLAUNCH_ENV)")
+	changesCmd.Flags().String("resume-after", "", "Resume token to start after")
+	changesCmd.Flags().String("start-at", "", "Operation time to start at: RFC 3339, a duration before now, or unix seconds")
+	changesCmd.Flags().Int("limit", 0, "Stop after this many events (default: until Ctrl-C)")
+	mongoCmd.AddCommand(changesCmd)
+
+	var oplogCmd = &cobra.Command{
+		Use:   "oplog",
+		Short: "Shows the oplog window and whether a resume token is still in it",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			resumeToken, _ := cmd.Flags().GetString("resume-token")
+			if err := show_oplog(resumeToken); err != nil {
+				fmt.Println("Error reading the oplog:", err)
+			}
+		},
+	}
+
+	oplogCmd.Flags().String("resume-token", "", "Resume token to compare with the oplog window, e.g. a stored connector offset")
+	mongoCmd.AddCommand(oplogCmd)
+
+	var preimagesCmd = &cobra.Command{
+		Use:   "preimages <enable|disable|status> <db.coll>",
+		Short: "Enables, disables or shows change stream pre- and post-images of a collection",
+		Long: `Manage changeStreamPreAndPostImages on a collection with collMod, as needed by
+change.stream.full.document.before.change. enable creates the collection when it does not exist.
+--expire-after sets the cluster-wide changeStreamOptions.preAndPostImages.expireAfterSeconds
+(a duration such as 1h, a number of seconds, or off).`,
+		Args:      cobra.ExactArgs(2),
+		ValidArgs: []string{"enable", "disable", "status"},
+		Run: func(cmd *cobra.Command, args []string) {
+			expireAfter, _ := cmd.Flags().GetString("expire-after")
+			if err := manage_pre_images(args[0], args[1], resolve_mongo_target(), expireAfter); err != nil {
+				fmt.Println("Error managing pre-images:", err)
+			}
+		},
+	}
+
+	preimagesCmd.Flags().String("expire-after", "", "Cluster-wide pre-image expiration: a duration (1h), seconds, or off")
+	mongoCmd.AddCommand(preimagesCmd)
+
+	var scenarioCmd = &cobra.Command{
+		Use:   "scenario",
+		Short: "Reproduces failure scenarios against running connectors",
+	}
+
+	var resumeExpiryCmd = &cobra.Command{
+		Use:   "resume-expiry <connector>",
+		Short: "Makes the resume token of a source connector fall off the oplog and captures how it recovers",
+		Long: `Pause a MongoSourceConnector, shrink the oplog of the local replica set to its 990 MB minimum with
+replSetResizeOplog, and write padding documents until the oplog no longer holds the point where the
+connector stopped. The connector is then resumed and restarted, and the resulting task state and trace
+are shown next to what errors.tolerance and startup.mode should do. The original oplog size is
+restored and the report is saved under logs/.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var opts ResumeExpiryOptions
+			opts.Wait, _ = cmd.Flags().GetDuration("wait")
+			opts.MaxWriteMB, _ = cmd.Flags().GetInt64("max-write-mb")
+			if err := run_resume_expiry_scenario(args[0], opts); err != nil {
+				fmt.Println("Error running the resume expiry scenario:", err)
+			}
+		},
+	}
+
+	resumeExpiryCmd.Flags().Duration("wait", time.Minute, "How long to wait for the tasks after resuming")
+	resumeExpiryCmd.Flags().Int64("max-write-mb", 4096, "Give up after writing this many MB of padding")
+	scenarioCmd.AddCommand(resumeExpiryCmd)
+
+	var chaosCmd = &cobra.Command{
+		Use:   "chaos",
+		Short: "Breaks parts of the stack and records how the connectors react",
+		Long: `Chaos actions against the klaunch stack. Every action takes a connector status snapshot before
+and --settle after it, and appends both with the state transitions between them to
+logs/chaos_timeline.log.`,
+	}
+
+	chaosCmd.PersistentFlags().Duration("settle", 15*time.Second, "How long to wait before the after snapshot")
+
+	var chaosBrokerCmd = &cobra.Command{
+		Use:       "broker <kill|pause|unpause|restart|start> <kafka1|kafka2|kafka3>",
+		Short:     "Kills, pauses, unpauses, restarts or starts a broker",
+		Args:      cobra.ExactArgs(2),
+		ValidArgs: []string{"kill", "pause", "unpause", "restart", "start"},
+		Run: func(cmd *cobra.Command, args []string) {
+			settle, _ := cmd.Flags().GetDuration("settle")
+			if err := chaos_broker(args[0], args[1], settle); err != nil {
+				fmt.Println("Error running chaos action:", err)
+			}
+		},
+	}
+
+	var chaosConnectCmd = &cobra.Command{
+		Use:   "connect restart [worker]",
+		Short: "Restarts a Connect worker container (default kafka-connect)",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if args[0] != "restart" {
+				fmt.Println("Error running chaos action: unknown connect action", args[0])
+				return
+			}
+			worker := "kafka-connect"
+			if len(args) == 2 {
+				worker = args[1]
+			}
+			settle, _ := cmd.Flags().GetDuration("settle")
+			if err := chaos_connect_restart(worker, settle); err != nil {
+				fmt.Println("Error running chaos action:", err)
+			}
+		},
+	}
+
+	var chaosMongoCmd = &cobra.Command{
+		Use:   "mongo stepdown",
+		Short: "Steps down the primary of the MongoDB target",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if args[0] != "stepdown" {
+				fmt.Println("Error running chaos action: unknown mongo action", args[0])
+				return
+			}
+			seconds, _ := cmd.Flags().GetInt("seconds")
+			settle, _ := cmd.Flags().GetDuration("settle")
+			if err := chaos_mongo_stepdown(seconds, settle); err != nil {
+				fmt.Println("Error running chaos action:", err)
+			}
+		},
+	}
+
+	chaosMongoCmd.Flags().Int("seconds", 60, "How long the old primary stays ineligible")
+
+	var chaosNetworkCmd = &cobra.Command{
+		Use:   "network <latency|loss|partition|heal>",
+		Short: "Injects latency, packet loss or a partition with tc, or removes it",
+		Long: `Apply a tc netem rule in the network namespace of --from (default kafka-connect) to the traffic
+towards --to: mongodb (the host running the replica set), kafka (all brokers) or a container name.
+The rule is run from the nicolaka/netshoot image, so the containers need neither tc nor NET_ADMIN.
+heal removes the rule.`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"latency", "loss", "partition", "heal"},
+		Run: func(cmd *cobra.Command, args []string) {
+			fault := NetworkFault{Mode: args[0]}
+			fault.Delay, _ = cmd.Flags().GetDuration("delay")
+			fault.Jitter, _ = cmd.Flags().GetDuration("jitter")
+			fault.Loss, _ = cmd.Flags().GetInt("loss")
+			from, _ := cmd.Flags().GetString("from")
+			to, _ := cmd.Flags().GetString("to")
+			settle, _ := cmd.Flags().GetDuration("settle")
+			if err := chaos_network(fault, from, to, settle); err != nil {
+				fmt.Println("Error running chaos action:", err)
+			}
+		},
+	}
+
+	chaosNetworkCmd.Flags().String("from", "kafka-connect", "Container whose outgoing traffic is affected")
+	chaosNetworkCmd.Flags().String("to", "mongodb", "Destination: mongodb, kafka or a container name")
+	chaosNetworkCmd.Flags().Duration("delay", 500*time.Millisecond, "Added latency")
+	chaosNetworkCmd.Flags().Duration("jitter", 0, "Latency variation")
+	chaosNetworkCmd.Flags().Int("loss", 30, "Packet loss percentage for the loss fault")
+	chaosCmd.AddCommand(chaosBrokerCmd, chaosConnectCmd, chaosMongoCmd, chaosNetworkCmd)
+
+	var connectorVersionsCmd = &cobra.Command{
+		Use:   "connector-versions",
+		Short: "Lists, caches, verifies and switches MongoDB Kafka connector jars",
+		Long: `Manages the mongo-kafka-connect-*-all.jar files cached in volumes/. Jars are verified
+against the .sha1 published next to them, and a verified cached jar is never downloaded again.
+Without network access the cached jars and their saved .sha1 files are used.`,
+	}
+
+	connectorVersionsCmd.PersistentFlags().String("repository", "", "Maven directory, mirror or file:// path of mongo-kafka-connect (default: MONGO_KAFKA_CONNECT_REPOSITORY, then Maven Central)")
+
+	var connectorVersionsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists published and cached versions",
+		Run: func(cmd *cobra.Command, args []string) {
+			repository, _ := cmd.Flags().GetString("repository")
+			cachedOnly, _ := cmd.Flags().GetBool("cached")
+			if err := list_connector_versions(connector_repository_url(repository), cachedOnly); err != nil {
+				fmt.Println("Error listing connector versions:", err)
+			}
+		},
+	}
+
+	connectorVersionsListCmd.Flags().Bool("cached", false, "Only list cached versions, without contacting the repository")
+
+	var connectorVersionsPullCmd = &cobra.Command{
+		Use:   "pull [version...]",
+		Short: "Downloads and verifies versions into the cache (default: the latest)",
+		Run: func(cmd *cobra.Command, args []string) {
+			flag, _ := cmd.Flags().GetString("repository")
+			repository := connector_repository_url(flag)
+			versions := args
+			if len(versions) == 0 {
+				remote, err := remote_connector_versions(repository)
+				if err != nil {
+					fmt.Println("Error pulling connector version:", err)
+					return
+				}
+				versions = remote[len(remote)-1:]
+			}
+			for _, version := range versions {
+				if _, err := pull_connector_version(version, repository, connectorCacheDir); err != nil {
+					fmt.Println("Error pulling connector version:", err)
+				}
+			}
+		},
+	}
+
+	var connectorVersionsUseCmd = &cobra.Command{
+		Use:   "use <version>",
+		Short: "Caches a version and sets MONGO_KAFKA_CONNECT_VERSION in .env",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			repository, _ := cmd.Flags().GetString("repository")
+			if err := use_connector_version(args[0], connector_repository_url(repository)); err != nil {
+				fmt.Println("Error switching connector version:", err)
+			}
+		},
+	}
+
+	var connectorVersionsPruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Removes cached jars except the version in use and --keep",
+		Run: func(cmd *cobra.Command, args []string) {
+			keep, _ := cmd.Flags().GetStringSlice("keep")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			removed, err := prune_connector_versions(connectorCacheDir, keep, dryRun)
+			for _, version := range removed {
+				if dryRun {
+					fmt.Printf("Would remove %s\n", connector_jar_name(version))
+				} else {
+					fmt.Printf("Removed %s\n", connector_jar_name(version))
+				}
+			}
+			if err != nil {
+				fmt.Println("Error pruning connector versions:", err)
+			} else if len(removed) == 0 {
+				fmt.Println("Nothing to prune")
+			}
+		},
+	}
+
+	connectorVersionsPruneCmd.Flags().StringSlice("keep", nil, "Versions to keep besides the one in use")
+	connectorVersionsPruneCmd.Flags().Bool("dry-run", false, "Only show what would be removed")
+	connectorVersionsCmd.AddCommand(connectorVersionsListCmd, connectorVersionsPullCmd, connectorVersionsUseCmd, connectorVersionsPruneCmd)
+
+	var connectorJarCmd = &cobra.Command{
+		Use:   "connector-jar",
+		Short: "Deploys locally built MongoDB Kafka connector jars",
+	}
+
+	var connectorJarSwapCmd = &cobra.Command{
+		Use:   "swap <path>",
+		Short: "Installs a jar into the running stack and restarts only the Connect workers",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			if err := swap_connector_jar(args[0], timeout); err != nil {
+				fmt.Println("Error swapping the connector jar:", err)
+			}
+		},
+	}
+
+	connectorJarSwapCmd.Flags().Duration("timeout", 3*time.Minute, "How long to wait for the workers to serve /connector-plugins")
+	connectorJarCmd.AddCommand(connectorJarSwapCmd)
+
+	var pluginCmd = &cobra.Command{
+		Use:   "plugin",
+		Short: "Manages extra Connect plugins (connectors, converters, SMTs) in plugins/",
+		Long: `Every plugin is a directory of plugins/, mounted into CONNECT_PLUGIN_PATH of each Connect
+worker. Adding or removing one recreates the running workers so they scan the plugin path again.`,
+	}
+
+	var pluginAddCmd = &cobra.Command{
+		Use:   "add <jar|zip|dir>",
+		Short: "Installs a jar, a zip (e.g. from Confluent Hub) or a directory of jars",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name, _ := cmd.Flags().GetString("name")
+			force, _ := cmd.Flags().GetBool("force")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			if err := ensure_plugins_dir(); err != nil {
+				fmt.Println("Error preparing the plugins directory:", err)
+				return
+			}
+			name, err := add_plugin(args[0], name, force)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Printf("Installed %s as plugin %s\n", args[0], name)
+			if err := reload_plugins(name, timeout); err != nil {
+				fmt.Println("Error reloading plugins:", err)
+			}
+		},
+	}
+
+	pluginAddCmd.Flags().String("name", "", "Plugin directory name (default: the file or directory name)")
+	pluginAddCmd.Flags().Bool("force", false, "Replace an installed plugin with the same name")
+	pluginAddCmd.Flags().Duration("timeout", 3*time.Minute, "How long to wait for Kafka Connect after the restart")
+
+	var pluginListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists installed plugins and the classes Kafka Connect loaded from them",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := list_plugins(); err != nil {
+				fmt.Println("Error listing plugins:", err)
+			}
+		},
+	}
+
+	var pluginRemoveCmd = &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Removes an installed plugin",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			if err := remove_plugin(args[0]); err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			fmt.Printf("Removed plugin %s\n", args[0])
+			if err := reload_plugins(args[0], timeout); err != nil {
+				fmt.Println("Error reloading plugins:", err)
+			}
+		},
+	}
+
+	pluginRemoveCmd.Flags().Duration("timeout", 3*time.Minute, "How long to wait for Kafka Connect after the restart")
+	pluginCmd.AddCommand(pluginAddCmd, pluginListCmd, pluginRemoveCmd)
+
+	var matrixCmd = &cobra.Command{
+		Use:   "matrix --versions v1,v2 --scenario <file> [-- start flags]",
+		Short: "Replays a scenario against several connector (and CP) versions and compares the results",
+		Long: `For every connector version, and every --cp-versions release when given, matrix stops klaunch,
+starts a clean stack with that version, creates the scenario connectors, runs its steps and evaluates
+its checks. Flags after -- are passed to every start, e.g. -- --kraft --connect-workers 2.
+Logs, results.json and summary.txt are written to matrix/<timestamp>/.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			versions, _ := cmd.Flags().GetStringSlice("versions")
+			cpVersions, _ := cmd.Flags().GetStringSlice("cp-versions")
+			scenario, _ := cmd.Flags().GetString("scenario")
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			keep, _ := cmd.Flags().GetBool("keep")
+			var startArgs []string
+			if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+				startArgs = args[dash:]
+			}
+			entries, err := matrix_entries(versions, cpVersions)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			if err := run_matrix(scenario, entries, MatrixOptions{StartArgs: startArgs, Timeout: timeout, Keep: keep}); err != nil {
+				fmt.Println("Error running the matrix:", err)
+			}
+		},
+	}
+
+	matrixCmd.Flags().StringSlice("versions", nil, "MongoDB connector versions, oldest first, e.g. 1.10.0,1.11.0,1.13.1")
+	matrixCmd.Flags().StringSlice("cp-versions", nil, "Confluent Platform releases to combine with every connector version (default: the one start picks)")
+	matrixCmd.Flags().String("scenario", "", "Scenario file (JSON) with the connectors, steps and checks to run")
+	matrixCmd.Flags().Duration("timeout", 5*time.Minute, "How long to wait for Kafka Connect after each start")
+	matrixCmd.Flags().Bool("keep", false, "Leave the stack of the last version running")
+	matrixCmd.MarkFlagRequired("versions")
+	matrixCmd.MarkFlagRequired("scenario")
+
+	var connectWorkersCmd = &cobra.Command{
+		Use:   "connect-workers",
+		Short: "Inspects and stops the Connect workers started with start --connect-workers",
+	}
+
+	var connectWorkersListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists connectors and tasks grouped by worker",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := list_worker_assignments(true); err != nil {
+				fmt.Println("Error listing Connect workers:", err)
+			}
+		},
+	}
+
+	var connectWorkersStopCmd = &cobra.Command{
+		Use:   "stop <worker>",
+		Short: "Stops one worker and reports how its connectors and tasks were reassigned",
+		Long: `Stops one Connect worker (a number or a name such as kafka-connect-2) and polls
+a surviving worker until the group has moved its connectors and tasks elsewhere.
+Incremental cooperative rebalancing waits scheduled.rebalance.max.delay.ms (5 minutes by
+default, CONNECT_SCHEDULED_REBALANCE_MAX_DELAY_MS in .env) before reassigning them.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			worker, err := parse_connect_worker(args[0])
+			if err != nil {
+				fmt.Println("Error stopping Connect worker:", err)
+				return
+			}
+			timeout, _ := cmd.Flags().GetDuration("timeout")
+			if err := stop_connect_worker(worker, timeout); err != nil {
+				fmt.Println("Error stopping Connect worker:", err)
+			}
+		},
+	}
+
+	connectWorkersStopCmd.Flags().Duration("timeout", 6*time.Minute, "How long to wait for the tasks to be reassigned")
+	connectWorkersCmd.AddCommand(connectWorkersListCmd, connectWorkersStopCmd)
+
 	var deleteCmd = &cobra.Command{
 		Use:   "delete [all|connectors|topics]",
 		Short: "Deletes connectors and/or topics with interactive selection",
@@ -183,54 +835,127 @@ func main() {
 	}
 
 	var showCmd = &cobra.Command{
-		Use:   "show [components|messages]",
-		Short: "Shows components or messages",
+		Use:   "show [components|messages|versions]",
+		Short: "Shows components, messages or versions",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			verbose, _ := cmd.Flags().GetBool("verbose")
+			watch, _ := cmd.Flags().GetBool("watch")
 			componentOrMessage := args[0]
-			if componentOrMessage == "components" {
-				if err := list_components(verbose); err != nil {
+			if componentOrMessage == "components" && watch {
+				interval, _ := cmd.Flags().GetDuration("interval")
+				logFile, _ := cmd.Flags().GetString("log-file")
+				if err := watch_components(interval, logFile, verbose); err != nil {
+					fmt.Println("Error watching components:", err)
+				}
+			} else if componentOrMessage == "components" {
+				showConfig, _ := cmd.Flags().GetBool("config")
+				if err := list_components(verbose, showConfig); err != nil {
 					fmt.Println("Error listing components:", err)
 				}
 			} else if componentOrMessage == "messages" {
 				if err := list_messages(); err != nil {
 					fmt.Println("Error listing messages:", err)
 				}
+			} else if componentOrMessage == "versions" {
+				if err := show_versions(); err != nil {
+					fmt.Println("Error showing versions:", err)
+				}
 			} else {
-				fmt.Println("Invalid component or message type. Please choose 'components' or 'messages'.")
+				fmt.Println("Invalid component or message type. Please choose 'components', 'messages' or 'versions'.")
 			}
 		},
 	}
 	
 	showCmd.Flags().Bool("verbose", false, "Show full stack traces for failed tasks")
+	showCmd.Flags().Bool("config", false, "Show the configuration of every connector (credentials redacted)")
+	showCmd.Flags().Bool("watch", false, "Refresh components in place and highlight state transitions")
+	showCmd.Flags().Duration("interval", 2*time.Second, "Refresh interval used with --watch")
+	showCmd.Flags().String("log-file", "", "Append the timestamped transition log to this file (with --watch)")
 
 	var logsCmd = &cobra.Command{
 		Use:   "logs",
 		Short: "Extracts logs from Kafka Connect",
+		Long: `Extract Kafka Connect logs, optionally filtered by connector context, level and pattern:
+  logs                                  - Save the full log into logs/
+  logs --connector <name> --level WARN  - Save only WARN and above for one connector
+  logs --since 10m --grep <regex>       - Save recent entries matching a pattern
+  logs --follow                         - Stream matching entries to the console
+  logs --all                            - Merge every klaunch container into one timeline`,
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("Extracting logs...")
-			datePrefix := time.Now().Format("20060102_150405")
-			filename := fmt.Sprintf("logs/%s_kafka_connect.log", datePrefix)
+			connector, _ := cmd.Flags().GetString("connector")
+			level, _ := cmd.Flags().GetString("level")
+			since, _ := cmd.Flags().GetString("since")
+			follow, _ := cmd.Flags().GetBool("follow")
+			grep, _ := cmd.Flags().GetString("grep")
+			output, _ := cmd.Flags().GetString("output")
+			all, _ := cmd.Flags().GetBool("all")
 
-			dockerCmd := exec.Command("docker", "logs", "kafka-connect")
-			output, err := dockerCmd.CombinedOutput()
-			if err != nil {
-				fmt.Printf("Failed to execute command: %v\nOutput: %s\n", err, string(output))
+			opts := LogCaptureOptions{
+				Filter: LogFilter{Connector: connector, MinLevel: level},
+				Since:  since,
+				Follow: follow,
+				Output: output,
+			}
+			if grep != "" {
+				re, err := regexp.Compile(grep)
+				if err != nil {
+					fmt.Println("Invalid --grep expression:", err)
+					return
+				}
+				opts.Filter.Grep = re
+			}
+
+			if all {
+				if connector != "" || level != "" || follow {
+					fmt.Println("--all only supports --since, --grep and --output")
+					return
+				}
+				fmt.Println("Extracting logs from all klaunch containers...")
+				if err := collect_all_logs(since, opts.Filter.Grep, output); err != nil {
+					fmt.Println("Error extracting logs:", err)
+				}
 				return
 			}
 
-			err = os.WriteFile(filename, output, 0644)
+			if !follow {
+				fmt.Println("Extracting logs...")
+			}
+			if err := capture_connect_logs(opts); err != nil {
+				fmt.Println("Error extracting logs:", err)
+			}
+		},
+	}
+
+	logsCmd.Flags().String("connector", "", "Only keep entries logged in this connector's context (or mentioning it)")
+	logsCmd.Flags().String("level", "", "Minimum log level to keep (TRACE, DEBUG, INFO, WARN, ERROR)")
+	logsCmd.Flags().String("since", "", "Only read logs newer than a duration (10m) or timestamp")
+	logsCmd.Flags().Bool("follow", false, "Stream matching entries to the console instead of saving a file")
+	logsCmd.Flags().String("grep", "", "Only keep entries matching this regular expression")
+	logsCmd.Flags().String("output", "", "File to save the logs to (default logs/<timestamp>_kafka_connect.log)")
+	logsCmd.Flags().Bool("all", false, "Collect every klaunch container into one chronologically sorted timeline")
+
+	var bundleCmd = &cobra.Command{
+		Use:   "bundle",
+		Short: "Creates a diagnostic tar.gz bundle for escalations",
+		Long: `Collect connector configs (redacted), statuses and traces, topic and consumer group
+descriptions, connector jar version, .env, compose file, container logs, a Prometheus
+metrics snapshot and Docker versions into a single tar.gz with a manifest.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			output, _ := cmd.Flags().GetString("output")
+			fmt.Println("Creating diagnostic bundle...")
+			path, err := create_bundle(output)
 			if err != nil {
-				fmt.Printf("Failed to write to file: %v\n", err)
+				fmt.Println("Error creating bundle:", err)
 				return
 			}
-
-			fmt.Printf("Logs saved to %s\n", filename)
+			fmt.Printf("Bundle saved to %s\n", path)
 		},
 	}
 
-	rootCmd.AddCommand(startCmd, stopCmd, createCmd, deleteCmd, showCmd, logsCmd)
+	bundleCmd.Flags().String("output", "", "Bundle file name (default bundles/klaunch_bundle_<case>_<timestamp>.tar.gz)")
+
+	rootCmd.AddCommand(startCmd, stopCmd, createCmd, renderCmd, fixCmd, lintCmd, pipelineCmd, mongoCmd, scenarioCmd, chaosCmd, connectWorkersCmd, connectorVersionsCmd, connectorJarCmd, pluginCmd, matrixCmd, deleteCmd, showCmd, logsCmd, bundleCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -0,0 +1,734 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// every matrix run writes its logs, results.json and summary.txt under matrix/<timestamp>/
+const matrixDir = "matrix"
+
+var connectorVersionPattern = regexp.MustCompile(`^\d+(\.\d+)*$`)
+
+// Scenario is the reproduction `klaunch matrix` replays against every version: connectors are
+// created, steps run in order, and after settle the checks decide pass or fail
+type Scenario struct {
+	Description string          `json:"description"`
+	Reset       []string        `json:"reset"` // db.collection dropped before each entry, besides inserted and counted ones
+	Connectors  []string        `json:"connectors"`
+	Steps       []ScenarioStep  `json:"steps"`
+	Settle      string          `json:"settle"`
+	Checks      []ScenarioCheck `json:"checks"`
+
+	settle time.Duration
+}
+
+// ScenarioStep sets exactly one of insert, sleep or run
+type ScenarioStep struct {
+	Insert    string            `json:"insert"` // db.collection
+	Documents []json.RawMessage `json:"documents"`
+	Count     int               `json:"count"` // generated documents, after documents
+	Sleep     string            `json:"sleep"`
+	Run       string            `json:"run"` // shell command; a non-zero exit fails the run
+}
+
+// ScenarioCheck sets exactly one of connectors_running, topic, collection or run
+type ScenarioCheck struct {
+	Name              string `json:"name"`
+	ConnectorsRunning bool   `json:"connectors_running"`
+	Topic             string `json:"topic"`      // message count
+	Collection        string `json:"collection"` // document count of db.collection
+	Min               *int64 `json:"min"`
+	Max               *int64 `json:"max"`
+	Run               string `json:"run"`
+	Output            string `json:"output"` // regex the command output must match
+}
+
+// MatrixEntry is one stack brought up by the matrix; an empty CPVersion lets start pick it
+type MatrixEntry struct {
+	ConnectorVersion string
+	CPVersion        string
+}
+
+func (e MatrixEntry) label() string {
+	if e.CPVersion == "" {
+		return e.ConnectorVersion
+	}
+	return e.ConnectorVersion + "_cp" + e.CPVersion
+}
+
+// CheckResult is the outcome of one check; Value is the observed count or command output
+type CheckResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Value  string `json:"value"`
+}
+
+// MatrixResult is the outcome of the scenario against one entry
+type MatrixResult struct {
+	ConnectorVersion string        `json:"connector_version"`
+	CPVersion        string        `json:"cp_version"`
+	LoadedVersion    string        `json:"loaded_version"`
+	Passed           bool          `json:"passed"`
+	Error            string        `json:"error,omitempty"`
+	Checks           []CheckResult `json:"checks"`
+	Failures         []string      `json:"failures,omitempty"`
+	Duration         string        `json:"duration"`
+	Log              string        `json:"log"`
+}
+
+// MatrixOptions controls `klaunch matrix`
+type MatrixOptions struct {
+	StartArgs []string // extra `klaunch start` flags, such as --kraft
+	Timeout   time.Duration
+	Keep      bool // leave the last stack running
+}
+
+// load_scenario reads and validates a scenario file
+func load_scenario(path string) (*Scenario, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenario Scenario
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	if scenario.Settle != "" {
+		if scenario.settle, err = time.ParseDuration(scenario.Settle); err != nil {
+			return nil, fmt.Errorf("%s: invalid settle %q", path, scenario.Settle)
+		}
+	}
+	for _, namespace := range scenario.Reset {
+		if _, _, ok := strings.Cut(namespace, "."); !ok {
+			return nil, fmt.Errorf("%s: reset needs db.collection, got %q", path, namespace)
+		}
+	}
+	for _, connector := range scenario.Connectors {
+		if _, err := os.Stat(connector); err != nil {
+			return nil, fmt.Errorf("%s: connector config %v", path, err)
+		}
+	}
+	for i, step := range scenario.Steps {
+		kinds := 0
+		for _, set := range []bool{step.Insert != "", step.Sleep != "", step.Run != ""} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return nil, fmt.Errorf("%s: step %d must set exactly one of insert, sleep or run", path, i+1)
+		}
+		if step.Sleep != "" {
+			if _, err := time.ParseDuration(step.Sleep); err != nil {
+				return nil, fmt.Errorf("%s: step %d: invalid sleep %q", path, i+1, step.Sleep)
+			}
+		}
+		if step.Insert != "" {
+			if _, _, ok := strings.Cut(step.Insert, "."); !ok {
+				return nil, fmt.Errorf("%s: step %d: insert needs db.collection, got %q", path, i+1, step.Insert)
+			}
+			if len(step.Documents) == 0 && step.Count <= 0 {
+				return nil, fmt.Errorf("%s: step %d: insert needs documents or a count", path, i+1)
+			}
+			for _, document := range step.Documents {
+				var doc bson.D
+				if err := bson.UnmarshalExtJSON(document, false, &doc); err != nil {
+					return nil, fmt.Errorf("%s: step %d: invalid document: %v", path, i+1, err)
+				}
+			}
+		}
+	}
+	if len(scenario.Checks) == 0 {
+		return nil, fmt.Errorf("%s: a scenario needs at least one check", path)
+	}
+	for i := range scenario.Checks {
+		check := &scenario.Checks[i]
+		kinds := 0
+		for _, set := range []bool{check.ConnectorsRunning, check.Topic != "", check.Collection != "", check.Run != ""} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return nil, fmt.Errorf("%s: check %d must set exactly one of connectors_running, topic, collection or run", path, i+1)
+		}
+		if check.Output != "" {
+			if _, err := regexp.Compile(check.Output); err != nil {
+				return nil, fmt.Errorf("%s: check %d: invalid output pattern: %v", path, i+1, err)
+			}
+		}
+		if check.Name == "" {
+			check.Name = default_check_name(*check)
+		}
+	}
+	return &scenario, nil
+}
+
+func default_check_name(check ScenarioCheck) string {
+	switch {
+	case check.ConnectorsRunning:
+		return "running"
+	case check.Topic != "":
+		return "topic " + check.Topic
+	case check.Collection != "":
+		return "collection " + check.Collection
+	}
+	name := "run " + check.Run
+	if len(name) > 24 {
+		name = name[:21] + "..."
+	}
+	return name
+}
+
+// matrix_entries crosses the connector versions with the CP versions, connector version first
+func matrix_entries(versions, cpVersions []string) ([]MatrixEntry, error) {
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("--versions needs at least one connector version")
+	}
+	if len(cpVersions) == 0 {
+		cpVersions = []string{""}
+	}
+	var entries []MatrixEntry
+	for _, version := range versions {
+		if !connectorVersionPattern.MatchString(version) {
+			return nil, fmt.Errorf("invalid connector version %q", version)
+		}
+		for _, cpVersion := range cpVersions {
+			if cpVersion != "" && !cpVersionPattern.MatchString(cpVersion) {
+				return nil, fmt.Errorf("invalid Confluent Platform version %q", cpVersion)
+			}
+			entries = append(entries, MatrixEntry{ConnectorVersion: version, CPVersion: cpVersion})
+		}
+	}
+	return entries, nil
+}
+
+// run_klaunch runs this binary with args, writing its output to log
+func run_klaunch(log io.Writer, args ...string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(log, "$ klaunch %s\n", strings.Join(args, " "))
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = log
+	cmd.Stderr = log
+	return cmd.Run()
+}
+
+// matrixKlaunch runs the stop and start commands of a matrix; tests replace it
+var matrixKlaunch = run_klaunch
+
+// wait_for_connector_plugin waits until Connect lists the MongoDB plugins and returns their version
+func wait_for_connector_plugin(timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		body, err := connect_rest_get("/connector-plugins")
+		if err == nil {
+			versions, _ := mongo_plugin_versions(body)
+			if version, ok := versions["com.mongodb.kafka.connect.MongoSourceConnector"]; ok {
+				return version, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("Kafka Connect did not load the MongoDB connector within %s", timeout)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// scenario_namespaces are the collections an entry must start without: reset, and those the
+// steps insert into and the checks count
+func scenario_namespaces(scenario *Scenario) []string {
+	seen := make(map[string]bool)
+	var namespaces []string
+	add := func(namespace string) {
+		if namespace != "" && !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	for _, namespace := range scenario.Reset {
+		add(namespace)
+	}
+	for _, step := range scenario.Steps {
+		add(step.Insert)
+	}
+	for _, check := range scenario.Checks {
+		add(check.Collection)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// reset_scenario_namespaces drops the collections left by an earlier entry; MongoDB is not part of
+// what stop removes
+func reset_scenario_namespaces(namespaces []string, log io.Writer) error {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	client, err := connect_mongo(ctx, resolve_mongo_target())
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	for _, namespace := range namespaces {
+		fmt.Fprintf(log, "Dropping %s\n", namespace)
+		database, collection, _ := strings.Cut(namespace, ".")
+		if err := client.Database(database).Collection(collection).Drop(ctx); err != nil {
+			return fmt.Errorf("failed to drop %s: %v", namespace, err)
+		}
+	}
+	return nil
+}
+
+// run_scenario_steps creates the connectors and runs the steps
+func run_scenario_steps(scenario *Scenario, log io.Writer) error {
+	for _, path := range scenario.Connectors {
+		rendered, err := render_config(path, "")
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		fmt.Fprintf(log, "Creating connector from %s\n", path)
+		if err := post_connector_config(rendered); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	for i, step := range scenario.Steps {
+		switch {
+		case step.Sleep != "":
+			wait, _ := time.ParseDuration(step.Sleep)
+			fmt.Fprintf(log, "Step %d: sleep %s\n", i+1, wait)
+			time.Sleep(wait)
+		case step.Run != "":
+			fmt.Fprintf(log, "Step %d: %s\n", i+1, step.Run)
+			output, err := run_scenario_command(step.Run)
+			fmt.Fprintln(log, output)
+			if err != nil {
+				return fmt.Errorf("step %d (%s): %v", i+1, step.Run, err)
+			}
+		case step.Insert != "":
+			fmt.Fprintf(log, "Step %d: insert %d documents into %s\n", i+1, len(step.Documents)+step.Count, step.Insert)
+			if err := insert_scenario_documents(step); err != nil {
+				return fmt.Errorf("step %d: %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func run_scenario_command(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "sh", "-c", command).CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
+
+// insert_scenario_documents writes the step documents, then count generated ones, to the MongoDB target
+func insert_scenario_documents(step ScenarioStep) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	client, err := connect_mongo(ctx, resolve_mongo_target())
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	var documents []interface{}
+	for _, raw := range step.Documents {
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(raw, false, &doc); err != nil {
+			return err
+		}
+		documents = append(documents, doc)
+	}
+	for i := 0; i < step.Count; i++ {
+		documents = append(documents, bson.D{{Key: "klaunch_seq", Value: i}, {Key: "inserted_at", Value: time.Now()}})
+	}
+	database, collection, _ := strings.Cut(step.Insert, ".")
+	_, err = client.Database(database).Collection(collection).InsertMany(ctx, documents)
+	return err
+}
+
+// topic_message_count sums the high minus low watermark of every partition of topic
+func topic_message_count(topic string) (int64, error) {
+	config := kafka.ConfigMap{
+		"bootstrap.servers": "localhost:9091,localhost:9092,localhost:9093",
+		"group.id":          "klaunch-matrix",
+	}
+	for key, value := range librdkafka_client_config(kafka_security_mode()) {
+		config[key] = value
+	}
+	consumer, err := kafka.NewConsumer(&config)
+	if err != nil {
+		return 0, err
+	}
+	defer consumer.Close()
+
+	metadata, err := consumer.GetMetadata(&topic, false, 10000)
+	if err != nil {
+		return 0, err
+	}
+	info, ok := metadata.Topics[topic]
+	if !ok || info.Error.Code() == kafka.ErrUnknownTopicOrPart || len(info.Partitions) == 0 {
+		return 0, nil
+	}
+	var total int64
+	for _, partition := range info.Partitions {
+		low, high, err := consumer.QueryWatermarkOffsets(topic, partition.ID, 10000)
+		if err != nil {
+			return 0, err
+		}
+		total += high - low
+	}
+	return total, nil
+}
+
+func collection_document_count(namespace string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := connect_mongo(ctx, resolve_mongo_target())
+	if err != nil {
+		return 0, err
+	}
+	defer client.Disconnect(context.Background())
+	database, collection, _ := strings.Cut(namespace, ".")
+	return client.Database(database).Collection(collection).CountDocuments(ctx, bson.D{})
+}
+
+// count_check_result compares a count with the check bounds; without bounds any count above zero passes
+func count_check_result(check ScenarioCheck, count int64, err error) CheckResult {
+	if err != nil {
+		return CheckResult{Name: check.Name, Value: "error: " + err.Error()}
+	}
+	passed := count > 0
+	if check.Min != nil || check.Max != nil {
+		passed = (check.Min == nil || count >= *check.Min) && (check.Max == nil || count <= *check.Max)
+	}
+	return CheckResult{Name: check.Name, Passed: passed, Value: fmt.Sprint(count)}
+}
+
+// running_check_result passes when every connector and task is RUNNING
+func running_check_result(name string, statuses map[string]*ConnectorStatus) CheckResult {
+	total, running := 0, 0
+	for _, status := range statuses {
+		states := []string{connector_field(status, "state")}
+		for _, task := range status.Tasks {
+			states = append(states, task.State)
+		}
+		for _, state := range states {
+			total++
+			if strings.ToUpper(state) == "RUNNING" {
+				running++
+			}
+		}
+	}
+	return CheckResult{Name: name, Passed: total > 0 && running == total, Value: fmt.Sprintf("%d/%d running", running, total)}
+}
+
+// command_check_result passes when the command succeeded and its output matches the pattern
+func command_check_result(check ScenarioCheck, output string, err error) CheckResult {
+	passed := err == nil
+	if passed && check.Output != "" {
+		passed = regexp.MustCompile(check.Output).MatchString(output)
+	}
+	value := ""
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		value = last
+	}
+	if err != nil {
+		value = strings.TrimSpace(err.Error() + " " + value)
+	}
+	if len(value) > 40 {
+		value = value[:37] + "..."
+	}
+	return CheckResult{Name: check.Name, Passed: passed, Value: value}
+}
+
+// evaluate_checks runs every check against the running stack
+func evaluate_checks(checks []ScenarioCheck, statuses map[string]*ConnectorStatus, statusErr error) []CheckResult {
+	var results []CheckResult
+	for _, check := range checks {
+		switch {
+		case check.ConnectorsRunning:
+			if statusErr != nil {
+				results = append(results, CheckResult{Name: check.Name, Value: "error: " + statusErr.Error()})
+			} else {
+				results = append(results, running_check_result(check.Name, statuses))
+			}
+		case check.Topic != "":
+			count, err := topic_message_count(check.Topic)
+			results = append(results, count_check_result(check, count, err))
+		case check.Collection != "":
+			count, err := collection_document_count(check.Collection)
+			results = append(results, count_check_result(check, count, err))
+		case check.Run != "":
+			output, err := run_scenario_command(check.Run)
+			results = append(results, command_check_result(check, output, err))
+		}
+	}
+	return results
+}
+
+// status_failures lists failed connectors and tasks with their likely cause or first trace line
+func status_failures(statuses map[string]*ConnectorStatus) []string {
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	describe := func(trace string) string {
+		if rule := classify_failure_trace(trace, failure_rules()); rule != nil {
+			return rule.Title
+		}
+		return strings.TrimSpace(strings.SplitN(trace, "\n", 2)[0])
+	}
+	var failures []string
+	for _, name := range names {
+		status := statuses[name]
+		if strings.ToUpper(connector_field(status, "state")) == "FAILED" {
+			failures = append(failures, fmt.Sprintf("%s: %s", name, describe(connector_field(status, "trace"))))
+		}
+		for _, task := range status.Tasks {
+			if strings.ToUpper(task.State) == "FAILED" {
+				failures = append(failures, fmt.Sprintf("%s task %d: %s", name, task.ID, describe(task.Trace)))
+			}
+		}
+	}
+	return failures
+}
+
+// run_matrix_entry brings up a clean stack for entry, replays the scenario and evaluates the checks
+func run_matrix_entry(scenario *Scenario, entry MatrixEntry, opts MatrixOptions, log io.Writer) (result MatrixResult) {
+	start := time.Now()
+	result = MatrixResult{ConnectorVersion: entry.ConnectorVersion, CPVersion: entry.CPVersion}
+	defer func() { result.Duration = time.Since(start).Round(time.Second).String() }()
+
+	// stop removes the containers, so Kafka topics and connector configs start empty
+	if err := matrixKlaunch(log, "stop"); err != nil {
+		fmt.Fprintf(log, "stop: %v\n", err)
+	}
+	args := []string{"start", entry.ConnectorVersion}
+	if entry.CPVersion != "" {
+		args = append(args, "--cp-version", entry.CPVersion)
+	}
+	if err := matrixKlaunch(log, append(args, opts.StartArgs...)...); err != nil {
+		result.Error = fmt.Sprintf("start failed: %v", err)
+		return result
+	}
+	if env, err := read_env_file(".env"); err == nil {
+		if env["MONGO_KAFKA_CONNECT_VERSION"] != entry.ConnectorVersion {
+			result.Error = fmt.Sprintf("start did not deploy %s; see the log", entry.ConnectorVersion)
+			return result
+		}
+		if result.CPVersion == "" {
+			result.CPVersion = env["CP_VERSION"]
+		}
+	}
+	loaded, err := wait_for_connector_plugin(opts.Timeout)
+	result.LoadedVersion = loaded
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	// start reports its errors without an exit status, so a stack left from a failed start is caught here
+	if loaded != entry.ConnectorVersion {
+		result.Error = fmt.Sprintf("Kafka Connect loaded connector %s instead of %s; see the log", loaded, entry.ConnectorVersion)
+		return result
+	}
+
+	if err := reset_scenario_namespaces(scenario_namespaces(scenario), log); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := run_scenario_steps(scenario, log); err != nil {
+		result.Error = err.Error()
+	}
+	if scenario.settle > 0 {
+		fmt.Fprintf(log, "Waiting %s for the connectors to settle\n", scenario.settle)
+		time.Sleep(scenario.settle)
+	}
+
+	statuses, statusErr := fetch_connector_statuses()
+	result.Checks = evaluate_checks(scenario.Checks, statuses, statusErr)
+	result.Failures = status_failures(statuses)
+	result.Passed = result.Error == ""
+	for _, check := range result.Checks {
+		result.Passed = result.Passed && check.Passed
+		fmt.Fprintf(log, "Check %s: %s (passed: %t)\n", check.Name, check.Value, check.Passed)
+	}
+	for _, failure := range result.Failures {
+		fmt.Fprintf(log, "Failed: %s\n", failure)
+	}
+	return result
+}
+
+// format_matrix_table lays the results out as one row per entry and one column per check
+func format_matrix_table(results []MatrixResult, checks []ScenarioCheck) string {
+	header := []string{"CONNECTOR", "CP", "LOADED", "RESULT"}
+	for _, check := range checks {
+		header = append(header, strings.ToUpper(check.Name))
+	}
+	header = append(header, "NOTES")
+
+	rows := [][]string{header}
+	for _, result := range results {
+		outcome := "PASS"
+		if !result.Passed {
+			outcome = "FAIL"
+		}
+		row := []string{result.ConnectorVersion, result.CPVersion, result.LoadedVersion, outcome}
+		for i := range checks {
+			cell := "-"
+			if i < len(result.Checks) {
+				mark := "✓"
+				if !result.Checks[i].Passed {
+					mark = "✗"
+				}
+				cell = strings.TrimSpace(mark + " " + result.Checks[i].Value)
+			}
+			row = append(row, cell)
+		}
+		notes := result.Error
+		if notes == "" && len(result.Failures) > 0 {
+			notes = result.Failures[0]
+			if len(result.Failures) > 1 {
+				notes += fmt.Sprintf(" (+%d more)", len(result.Failures)-1)
+			}
+		}
+		rows = append(rows, append(row, notes))
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	var b strings.Builder
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", widths[i]-len([]rune(cell))+2))
+			}
+		}
+		b.WriteString(strings.TrimRight(line.String(), " ") + "\n")
+	}
+	return b.String()
+}
+
+// matrix_regressions names every entry that fails right after a passing one with the same CP version
+func matrix_regressions(results []MatrixResult) []string {
+	var notes []string
+	last := make(map[string]MatrixResult)
+	for _, result := range results {
+		if previous, ok := last[result.CPVersion]; ok {
+			if previous.Passed && !result.Passed {
+				notes = append(notes, fmt.Sprintf("Regression between %s and %s (CP %s)", previous.ConnectorVersion, result.ConnectorVersion, result.CPVersion))
+			}
+			if !previous.Passed && result.Passed {
+				notes = append(notes, fmt.Sprintf("Fixed between %s and %s (CP %s)", previous.ConnectorVersion, result.ConnectorVersion, result.CPVersion))
+			}
+		}
+		last[result.CPVersion] = result
+	}
+	return notes
+}
+
+// run_matrix replays the scenario against every entry and writes the comparison under matrix/
+func run_matrix(scenarioPath string, entries []MatrixEntry, opts MatrixOptions) error {
+	scenario, err := load_scenario(scenarioPath)
+	if err != nil {
+		return err
+	}
+	outDir := filepath.Join(matrixDir, time.Now().Format("20060102_150405"))
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+
+	// start records the versions it deploys; put back the ones in use before the matrix
+	env, _ := read_env_file(".env")
+	defer func() {
+		for _, key := range []string{"MONGO_KAFKA_CONNECT_VERSION", "CP_VERSION"} {
+			if env[key] != "" {
+				set_env_value(".env", key, env[key])
+			}
+		}
+	}()
+
+	var results []MatrixResult
+	for i, entry := range entries {
+		fmt.Printf("[%d/%d] MongoDB connector %s", i+1, len(entries), entry.ConnectorVersion)
+		if entry.CPVersion != "" {
+			fmt.Printf(", Confluent Platform %s", entry.CPVersion)
+		}
+		fmt.Println()
+
+		logPath := filepath.Join(outDir, entry.label()+".log")
+		logFile, err := os.Create(logPath)
+		if err != nil {
+			return err
+		}
+		result := run_matrix_entry(scenario, entry, opts, logFile)
+		logFile.Close()
+		result.Log = logPath
+		results = append(results, result)
+
+		outcome := "PASS"
+		if !result.Passed {
+			outcome = "FAIL"
+		}
+		fmt.Printf("  %s in %s (log: %s)\n", outcome, result.Duration, logPath)
+		if result.Error != "" {
+			fmt.Printf("  %s\n", result.Error)
+		}
+	}
+	if !opts.Keep {
+		matrixKlaunch(io.Discard, "stop")
+	}
+
+	summary := format_matrix_table(results, scenario.Checks)
+	for _, note := range matrix_regressions(results) {
+		summary += "\n" + note
+	}
+	fmt.Printf("\n%s\n", summary)
+
+	content, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "results.json"), content, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "summary.txt"), []byte(summary+"\n"), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Results saved to %s\n", outDir)
+	return nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadScenario(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			content: `{"connectors": ["case_configs/default_source_task.json"],
+				"steps": [{"sleep": "5s"}, {"insert": "db.coll", "documents": [{"a": {"$numberLong": "1"}}]}, {"run": "true"}],
+				"settle": "10s",
+				"checks": [{"connectors_running": true}, {"topic": "db.coll", "min": 1}, {"run": "echo ok", "output": "^ok$"}]}`,
+		},
+		{name: "unknown field", content: `{"check": [], "checks": [{"connectors_running": true}]}`, wantErr: "unknown field"},
+		{name: "no checks", content: `{"steps": [{"sleep": "1s"}]}`, wantErr: "at least one check"},
+		{name: "two step kinds", content: `{"steps": [{"sleep": "1s", "run": "true"}], "checks": [{"connectors_running": true}]}`, wantErr: "exactly one of insert"},
+		{name: "bad sleep", content: `{"steps": [{"sleep": "soon"}], "checks": [{"connectors_running": true}]}`, wantErr: "invalid sleep"},
+		{name: "insert without namespace", content: `{"steps": [{"insert": "coll", "count": 1}], "checks": [{"connectors_running": true}]}`, wantErr: "db.collection"},
+		{name: "insert without documents", content: `{"steps": [{"insert": "db.coll"}], "checks": [{"connectors_running": true}]}`, wantErr: "documents or a count"},
+		{name: "reset without namespace", content: `{"reset": ["coll"], "checks": [{"connectors_running": true}]}`, wantErr: "reset needs db.collection"},
+		{name: "check without kind", content: `{"checks": [{"min": 1}]}`, wantErr: "exactly one of connectors_running"},
+		{name: "bad pattern", content: `{"checks": [{"run": "true", "output": "("}]}`, wantErr: "invalid output pattern"},
+		{name: "missing connector", content: `{"connectors": ["case_configs/missing.json"], "checks": [{"connectors_running": true}]}`, wantErr: "connector config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "scenario.json")
+			os.WriteFile(path, []byte(tt.content), 0644)
+			scenario, err := load_scenario(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			names := []string{}
+			for _, check := range scenario.Checks {
+				names = append(names, check.Name)
+			}
+			if strings.Join(names, ",") != "running,topic db.coll,run echo ok" || scenario.settle.String() != "10s" {
+				t.Errorf("Unexpected scenario %+v", scenario)
+			}
+		})
+	}
+}
+
+func TestScenarioNamespaces(t *testing.T) {
+	scenario := &Scenario{
+		Reset: []string{"sink.target", "db.coll"},
+		Steps: []ScenarioStep{{Sleep: "1s"}, {Insert: "db.coll", Count: 1}, {Insert: "db.other", Count: 1}},
+		Checks: []ScenarioCheck{
+			{ConnectorsRunning: true},
+			{Topic: "db.coll"},
+			{Collection: "sink.target"},
+			{Collection: "sink.copy"},
+		},
+	}
+	expected := "db.coll,db.other,sink.copy,sink.target"
+	if namespaces := strings.Join(scenario_namespaces(scenario), ","); namespaces != expected {
+		t.Errorf("Expected %s, got %s", expected, namespaces)
+	}
+	if namespaces := scenario_namespaces(&Scenario{Checks: []ScenarioCheck{{ConnectorsRunning: true}}}); len(namespaces) != 0 {
+		t.Errorf("Expected no namespaces, got %v", namespaces)
+	}
+}
+
+func TestExampleScenario(t *testing.T) {
+	if _, err := load_scenario("scenarios/default_source_inserts.json"); err != nil {
+		t.Errorf("Example scenario does not load: %v", err)
+	}
+}
+
+func TestMatrixEntries(t *testing.T) {
+	entries, err := matrix_entries([]string{"1.10.0", "1.11.0"}, []string{"7.6.1", "7.7.0"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var labels []string
+	for _, entry := range entries {
+		labels = append(labels, entry.label())
+	}
+	if strings.Join(labels, ",") != "1.10.0_cp7.6.1,1.10.0_cp7.7.0,1.11.0_cp7.6.1,1.11.0_cp7.7.0" {
+		t.Errorf("Unexpected entries %v", labels)
+	}
+
+	entries, err = matrix_entries([]string{"1.13.1"}, nil)
+	if err != nil || len(entries) != 1 || entries[0].label() != "1.13.1" {
+		t.Errorf("Unexpected entries %v, %v", entries, err)
+	}
+	for _, versions := range [][]string{nil, {"latest"}} {
+		if _, err := matrix_entries(versions, nil); err == nil {
+			t.Errorf("Expected an error for %v", versions)
+		}
+	}
+	if _, err := matrix_entries([]string{"1.13.1"}, []string{"7.7"}); err == nil {
+		t.Error("Expected an error for an invalid CP version")
+	}
+}
+
+func TestCheckResults(t *testing.T) {
+	min, max := int64(100), int64(150)
+	tests := []struct {
+		name     string
+		result   CheckResult
+		passed   bool
+		expected string
+	}{
+		{"count above zero", count_check_result(ScenarioCheck{Name: "topic"}, 3, nil), true, "3"},
+		{"empty topic", count_check_result(ScenarioCheck{Name: "topic"}, 0, nil), false, "0"},
+		{"below min", count_check_result(ScenarioCheck{Name: "topic", Min: &min}, 99, nil), false, "99"},
+		{"within bounds", count_check_result(ScenarioCheck{Name: "topic", Min: &min, Max: &max}, 120, nil), true, "120"},
+		{"above max", count_check_result(ScenarioCheck{Name: "topic", Max: &max}, 151, nil), false, "151"},
+		{"max zero", count_check_result(ScenarioCheck{Name: "dlq", Max: new(int64)}, 0, nil), true, "0"},
+		{"count error", count_check_result(ScenarioCheck{Name: "topic"}, 0, errors.New("no brokers")), false, "error: no brokers"},
+		{"command output", command_check_result(ScenarioCheck{Output: "count: 1\\d\\d"}, "connecting\ncount: 100", nil), true, "count: 100"},
+		{"command mismatch", command_check_result(ScenarioCheck{Output: "count: 1\\d\\d"}, "count: 7", nil), false, "count: 7"},
+		{"command failure", command_check_result(ScenarioCheck{}, "", errors.New("exit status 1")), false, "exit status 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.result.Passed != tt.passed || tt.result.Value != tt.expected {
+				t.Errorf("Expected passed=%t value %q, got %+v", tt.passed, tt.expected, tt.result)
+			}
+		})
+	}
+}
+
+func TestRunningCheckAndFailures(t *testing.T) {
+	statuses := map[string]*ConnectorStatus{
+		"source": {Connector: map[string]interface{}{"state": "RUNNING"}, Tasks: []TaskStatus{{ID: 0, State: "RUNNING"}}},
+		"sink": {Connector: map[string]interface{}{"state": "RUNNING"}, Tasks: []TaskStatus{
+			{ID: 0, State: "FAILED", Trace: "org.apache.kafka.connect.errors.ConnectException: something broke\n\tat Worker.java"},
+		}},
+	}
+	result := running_check_result("running", statuses)
+	if result.Passed || result.Value != "3/4 running" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if result := running_check_result("running", nil); result.Passed {
+		t.Error("Expected no connectors to fail the check")
+	}
+
+	failures := status_failures(statuses)
+	if len(failures) != 1 || !strings.HasPrefix(failures[0], "sink task 0: ") {
+		t.Errorf("Unexpected failures %v", failures)
+	}
+}
+
+func TestMatrixEntryDuration(t *testing.T) {
+	defer func(original func(io.Writer, ...string) error) { matrixKlaunch = original }(matrixKlaunch)
+	var commands []string
+	matrixKlaunch = func(log io.Writer, args ...string) error {
+		commands = append(commands, args[0])
+		if args[0] == "start" {
+			return errors.New("exit status 1")
+		}
+		return nil
+	}
+
+	result := run_matrix_entry(&Scenario{}, MatrixEntry{ConnectorVersion: "1.13.0"}, MatrixOptions{}, io.Discard)
+	if strings.Join(commands, ",") != "stop,start" {
+		t.Errorf("Expected stop then start, got %v", commands)
+	}
+	if !strings.Contains(result.Error, "start failed") {
+		t.Errorf("Expected a start error, got %q", result.Error)
+	}
+	if result.Duration == "" {
+		t.Error("Expected the duration to be recorded")
+	}
+}
+
+func TestFormatMatrixTable(t *testing.T) {
+	checks := []ScenarioCheck{{Name: "running"}, {Name: "messages"}}
+	results := []MatrixResult{
+		{ConnectorVersion: "1.10.0", CPVersion: "7.7.0", LoadedVersion: "1.10.0", Passed: true, Checks: []CheckResult{{"running", true, "2/2 running"}, {"messages", true, "100"}}},
+		{ConnectorVersion: "1.11.0", CPVersion: "7.7.0", LoadedVersion: "1.11.0", Checks: []CheckResult{{"running", false, "1/2 running"}, {"messages", false, "0"}},
+			Failures: []string{"mdb task 0: Resume token was not found", "other"}},
+		{ConnectorVersion: "1.13.1", CPVersion: "7.7.0", Error: "Kafka Connect did not load the MongoDB connector within 5m0s"},
+	}
+	expected := strings.Join([]string{
+		"CONNECTOR  CP     LOADED  RESULT  RUNNING        MESSAGES  NOTES",
+		"1.10.0     7.7.0  1.10.0  PASS    ✓ 2/2 running  ✓ 100",
+		"1.11.0     7.7.0  1.11.0  FAIL    ✗ 1/2 running  ✗ 0       mdb task 0: Resume token was not found (+1 more)",
+		"1.13.1     7.7.0          FAIL    -              -         Kafka Connect did not load the MongoDB connector within 5m0s",
+	}, "\n") + "\n"
+	if output := format_matrix_table(results, checks); output != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	regressions := matrix_regressions(append(results, MatrixResult{ConnectorVersion: "1.14.0", CPVersion: "7.7.0", Passed: true}))
+	if strings.Join(regressions, "|") != "Regression between 1.10.0 and 1.11.0 (CP 7.7.0)|Fixed between 1.13.1 and 1.14.0 (CP 7.7.0)" {
+		t.Errorf("Unexpected regressions %v", regressions)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TimelineLine is a single log line placed on the merged multi-container timeline
+type TimelineLine struct {
+	Time      time.Time
+	Container string
+	Text      string
+}
+
+// application timestamp formats found in the klaunch services, tried in order
+var logTimestampFormats = []struct {
+	regex  *regexp.Regexp
+	layout string
+}{
+	// log4j in Kafka, ZooKeeper, Connect and Schema Registry: [2024-05-01 10:00:00,001]
+	// and Play/logback in CMAK: 2024-05-01 10:00:00,001
+	{regexp.MustCompile(`^\[?(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}),(\d{3})\]?`), "2006-01-02 15:04:05.000"},
+	// mongod structured logs: {"t":{"$date":"2024-05-01T10:00:00.001+00:00"}
+	{regexp.MustCompile(`"\$date":"(\d{4}-\d{2}-\d{2}T[^"]+)"`), time.RFC3339Nano},
+	// logfmt in Prometheus and Grafana: ts=2024-05-01T10:00:00.001Z / t=2024-05-01T10:00:00+0000
+	{regexp.MustCompile(`\b(?:ts|t|time)="?(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2}))`), time.RFC3339Nano},
+	// plain RFC 3339 at the start of the line
+	{regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2}))`), time.RFC3339Nano},
+}
+
+// colon-less offsets such as +0000 are normalized before parsing
+var compactOffsetRegex = regexp.MustCompile(`([+-]\d{2})(\d{2})$`)
+
+// parse_log_timestamp extracts the application timestamp of a log line.
+// Timestamps without a zone are read as UTC, which is what the containers run in.
+func parse_log_timestamp(line string) (time.Time, bool) {
+	for _, format := range logTimestampFormats {
+		match := format.regex.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		value := match[1]
+		if len(match) > 2 {
+			value = match[1] + "." + match[2]
+		}
+		value = compactOffsetRegex.ReplaceAllString(value, "$1:$2")
+		if parsed, err := time.ParseInLocation(format.layout, value, time.UTC); err == nil {
+			return parsed.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// split_docker_timestamp separates the prefix added by `docker logs --timestamps`
+func split_docker_timestamp(line string) (time.Time, string) {
+	prefix, rest, found := strings.Cut(line, " ")
+	if !found {
+		prefix = line
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Time{}, line
+	}
+	return parsed.UTC(), rest
+}
+
+// build_container_timeline converts `docker logs --timestamps` output into timeline lines.
+// The application timestamp wins when it can be parsed. Lines without one (stack traces,
+// wrapped messages) inherit the previous application timestamp so they stay attached to
+// their entry; containers that never print one fall back to the docker receive time.
+func build_container_timeline(container string, output []byte) []TimelineLine {
+	var lines []TimelineLine
+	var last time.Time
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		received, text := split_docker_timestamp(scanner.Text())
+
+		stamp, ok := parse_log_timestamp(text)
+		if ok {
+			last = stamp
+		} else if !last.IsZero() {
+			stamp = last
+		} else {
+			stamp = received
+		}
+
+		lines = append(lines, TimelineLine{Time: stamp, Container: container, Text: text})
+	}
+	return lines
+}
+
+// merge_timelines interleaves per-container lines in chronological order, keeping
+// the original order of lines that share a timestamp
+func merge_timelines(timelines ...[]TimelineLine) []TimelineLine {
+	var merged []TimelineLine
+	for _, timeline := range timelines {
+		merged = append(merged, timeline...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Time.Before(merged[j].Time)
+	})
+	return merged
+}
+
+func format_timeline_line(line TimelineLine, width int) string {
+	return fmt.Sprintf("%s [%-*s] %s", line.Time.Format("2006-01-02T15:04:05.000Z07:00"), width, line.Container, line.Text)
+}
+
+// list_project_containers returns the names of every container in the klaunch compose project
+func list_project_containers() ([]string, error) {
+	listCmd := exec.Command("docker", "ps", "-a",
+		"--filter", "label=com.docker.compose.project=klaunch",
+		"--format", "{{.Names}}")
+	output, err := listCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list klaunch containers: %v", err)
+	}
+
+	var containers []string
+	for _, name := range strings.Split(string(output), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			containers = append(containers, name)
+		}
+	}
+	sort.Strings(containers)
+	return containers, nil
+}
+
+func collect_all_logs(since string, grep *regexp.Regexp, output string) error {
+	containers, err := list_project_containers()
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("no containers found for the klaunch compose project")
+	}
+
+	var timelines [][]TimelineLine
+	width := 0
+	for _, container := range containers {
+		args := []string{"logs", "--timestamps"}
+		if since != "" {
+			args = append(args, "--since", since)
+		}
+		args = append(args, container)
+
+		logOutput, err := exec.Command("docker", args...).CombinedOutput()
+		if err != nil {
+			fmt.Printf("Warning: could not read logs from %s: %v\n", container, err)
+			continue
+		}
+		timelines = append(timelines, build_container_timeline(container, logOutput))
+		if len(container) > width {
+			width = len(container)
+		}
+		fmt.Printf("✓ Collected logs from %s\n", container)
+	}
+
+	if output == "" {
+		output = fmt.Sprintf("logs/%s_klaunch_timeline.log", time.Now().Format("20060102_150405"))
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %v", err)
+	}
+
+	var buf bytes.Buffer
+	written := 0
+	for _, line := range merge_timelines(timelines...) {
+		if grep != nil && !grep.MatchString(line.Text) {
+			continue
+		}
+		buf.WriteString(redact_text(format_timeline_line(line, width)))
+		buf.WriteByte('\n')
+		written++
+	}
+
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write timeline: %v", err)
+	}
+
+	fmt.Printf("%d lines from %d containers saved to %s\n", written, len(timelines), output)
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLogTimestamp(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected time.Time
+		ok       bool
+	}{
+		{
+			name:     "log4j bracketed",
+			line:     "[2024-05-01 10:00:00,001] INFO Kafka Server started (kafka.server.KafkaServer)",
+			expected: time.Date(2024, 5, 1, 10, 0, 0, 1000000, time.UTC),
+			ok:       true,
+		},
+		{
+			name:     "logback without brackets",
+			line:     "2024-05-01 10:00:00,250 - [INFO] - from play.api.Play in main",
+			expected: time.Date(2024, 5, 1, 10, 0, 0, 250000000, time.UTC),
+			ok:       true,
+		},
+		{
+			name:     "prometheus logfmt",
+			line:     `ts=2024-05-01T10:00:01.500Z caller=main.go:1 level=info msg="Server is ready"`,
+			expected: time.Date(2024, 5, 1, 10, 0, 1, 500000000, time.UTC),
+			ok:       true,
+		},
+		{
+			name:     "grafana logfmt with compact offset",
+			line:     `logger=server t=2024-05-01T12:00:02+0200 level=info msg="HTTP Server Listen"`,
+			expected: time.Date(2024, 5, 1, 10, 0, 2, 0, time.UTC),
+			ok:       true,
+		},
+		{
+			name:     "mongod structured log",
+			line:     `{"t":{"$date":"2024-05-01T10:00:03.000+00:00"},"s":"I","c":"REPL"}`,
+			expected: time.Date(2024, 5, 1, 10, 0, 3, 0, time.UTC),
+			ok:       true,
+		},
+		{
+			name: "stack trace line",
+			line: "\tat org.apache.kafka.connect.runtime.WorkerTask.run(WorkerTask.java:200)",
+			ok:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, ok := parse_log_timestamp(tt.line)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok=%v, got %v", tt.ok, ok)
+			}
+			if ok && !parsed.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestSplitDockerTimestamp(t *testing.T) {
+	received, text := split_docker_timestamp("2024-05-01T10:00:00.123456789Z [2024-05-01 10:00:00,001] INFO started")
+	if received.IsZero() {
+		t.Error("Expected docker timestamp to be parsed")
+	}
+	if text != "[2024-05-01 10:00:00,001] INFO started" {
+		t.Errorf("Unexpected remaining text: %q", text)
+	}
+
+	received, text = split_docker_timestamp("no timestamp here")
+	if !received.IsZero() || text != "no timestamp here" {
+		t.Errorf("Expected line to be returned unchanged, got %v %q", received, text)
+	}
+}
+
+func TestMergeContainerTimelines(t *testing.T) {
+	connect := build_container_timeline("kafka-connect", []byte(
+		"2024-05-01T10:00:05.000Z [2024-05-01 10:00:02,000] ERROR Task failed (WorkerTask:1)\n"+
+			"2024-05-01T10:00:05.000Z org.apache.kafka.connect.errors.ConnectException: boom\n"+
+			"2024-05-01T10:00:05.000Z \tat WorkerTask.run(WorkerTask.java:1)\n"+
+			"2024-05-01T10:00:06.000Z [2024-05-01 10:00:04,000] INFO Task restarted (WorkerTask:2)\n"))
+	broker := build_container_timeline("kafka1", []byte(
+		"2024-05-01T10:00:01.000Z [2024-05-01 10:00:01,000] INFO Broker started (KafkaServer)\n"+
+			"2024-05-01T10:00:03.000Z [2024-05-01 10:00:03,000] WARN Leader moved (Partition)\n"))
+	prometheus := build_container_timeline("prometheus", []byte(
+		"2024-05-01T10:00:00.500Z plain line without application timestamp\n"))
+
+	merged := merge_timelines(connect, broker, prometheus)
+
+	expectedOrder := []string{
+		"plain line without application timestamp",
+		"Broker started",
+		"Task failed",
+		"ConnectException: boom",
+		"WorkerTask.run",
+		"Leader moved",
+		"Task restarted",
+	}
+	if len(merged) != len(expectedOrder) {
+		t.Fatalf("Expected %d lines, got %d", len(expectedOrder), len(merged))
+	}
+	for i, expected := range expectedOrder {
+		if !strings.Contains(merged[i].Text, expected) {
+			t.Errorf("Line %d: expected %q, got %q", i, expected, merged[i].Text)
+		}
+	}
+
+	formatted := format_timeline_line(merged[1], len("kafka-connect"))
+	if !strings.HasPrefix(formatted, "2024-05-01T10:00:01.000Z [kafka1       ] ") {
+		t.Errorf("Unexpected formatted line: %q", formatted)
+	}
+}
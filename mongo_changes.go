@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChangesOptions controls `klaunch mongo changes`
+type ChangesOptions struct {
+	ConfigPath  string
+	EnvName     string
+	ResumeAfter string
+	StartAt     string
+	Limit       int
+}
+
+// OplogWindow is the range of operations still held by the oplog
+type OplogWindow struct {
+	First   primitive.Timestamp
+	Last    primitive.Timestamp
+	Count   int64
+	Size    int64
+	MaxSize int64
+}
+
+// parse_resume_token accepts a resume token as printed by the connector or `mongo changes`
+// ({"_data": "8265..."}) or the bare _data hex string
+func parse_resume_token(value string) (bson.Raw, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "{") {
+		var token bson.Raw
+		if err := bson.UnmarshalExtJSON([]byte(value), false, &token); err != nil {
+			return nil, fmt.Errorf("invalid resume token: %v", err)
+		}
+		if _, err := token.LookupErr("_data"); err != nil {
+			return nil, fmt.Errorf("invalid resume token: no _data field")
+		}
+		return token, nil
+	}
+	if _, err := hex.DecodeString(value); err != nil || value == "" {
+		return nil, fmt.Errorf("invalid resume token %q: expected {\"_data\": \"...\"} or its hex string", value)
+	}
+	return bson.Marshal(bson.D{{Key: "_data", Value: value}})
+}
+
+// resume_token_timestamp decodes the cluster time at the start of a resume token's _data
+// (a 0x82 type byte followed by the big-endian seconds and increment)
+func resume_token_timestamp(token bson.Raw) (primitive.Timestamp, bool) {
+	data, ok := token.Lookup("_data").StringValueOK()
+	if !ok || len(data) < 18 || !strings.HasPrefix(data, "82") {
+		return primitive.Timestamp{}, false
+	}
+	seconds, err := strconv.ParseUint(data[2:10], 16, 32)
+	if err != nil {
+		return primitive.Timestamp{}, false
+	}
+	increment, err := strconv.ParseUint(data[10:18], 16, 32)
+	if err != nil {
+		return primitive.Timestamp{}, false
+	}
+	return primitive.Timestamp{T: uint32(seconds), I: uint32(increment)}, true
+}
+
+// parse_start_at accepts an RFC 3339 time, a duration before now such as 15m, or unix seconds
+func parse_start_at(value string, now time.Time) (primitive.Timestamp, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return primitive.Timestamp{T: uint32(t.Unix())}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return primitive.Timestamp{T: uint32(now.Add(-d).Unix())}, nil
+	}
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return primitive.Timestamp{T: uint32(seconds)}, nil
+	}
+	return primitive.Timestamp{}, fmt.Errorf("invalid --start-at %q: use an RFC 3339 time, a duration like 15m, or unix seconds", value)
+}
+
+func format_timestamp(ts primitive.Timestamp) string {
+	return fmt.Sprintf("%s (%d, %d)", time.Unix(int64(ts.T), 0).UTC().Format(time.RFC3339), ts.T, ts.I)
+}
+
+// format_change_event is the one-line summary and the indented event printed by `mongo changes`
+func format_change_event(event bson.Raw) string {
+	operation, _ := event.Lookup("operationType").StringValueOK()
+	line := fmt.Sprintf("%-8s", operation)
+	if t, i, ok := event.Lookup("clusterTime").TimestampOK(); ok {
+		line = format_timestamp(primitive.Timestamp{T: t, I: i}) + " " + line
+	}
+	if ns, ok := event.Lookup("ns").DocumentOK(); ok {
+		db, _ := ns.Lookup("db").StringValueOK()
+		coll, _ := ns.Lookup("coll").StringValueOK()
+		line += " " + namespace_label(db, coll)
+	}
+	if key, err := event.LookupErr("documentKey", "_id"); err == nil {
+		line += " _id=" + key.String()
+	}
+
+	pretty, err := bson.MarshalExtJSONIndent(event, false, false, "    ", "  ")
+	if err != nil {
+		return line
+	}
+	return line + "\n    " + redact_text(string(pretty))
+}
+
+// describe_change_stream_error explains the errors seen when resuming an old change stream
+func describe_change_stream_error(err error) error {
+	// 286: ChangeStreamHistoryLost, 280: ChangeStreamFatalError
+	if is_command_error(err, 286, 280) {
+		return fmt.Errorf("%v\nThe resume point is no longer in the oplog; compare it with `klaunch mongo oplog --resume-token`", err)
+	}
+	return err
+}
+
+// watch_changes implements `klaunch mongo changes <db.coll>`: it tails a change stream with the
+// fullDocument options of a connector config and prints every event with its resume token
+func watch_changes(namespace string, opts ChangesOptions) error {
+	database, collection, err := split_namespace(namespace)
+	if err != nil {
+		return err
+	}
+	if opts.ResumeAfter != "" && opts.StartAt != "" {
+		return fmt.Errorf("use either --resume-after or --start-at")
+	}
+
+	config := map[string]string{}
+	target := resolve_mongo_target()
+	if opts.ConfigPath != "" {
+		lintTarget, err := load_lint_target(opts.ConfigPath, opts.EnvName)
+		if err != nil {
+			return err
+		}
+		config = lintTarget.Config
+		target = target_for_config(config)
+	}
+
+	streamOpts := change_stream_options(config)
+	switch {
+	case opts.ResumeAfter != "":
+		token, err := parse_resume_token(opts.ResumeAfter)
+		if err != nil {
+			return err
+		}
+		streamOpts.SetResumeAfter(token)
+	case opts.StartAt != "":
+		ts, err := parse_start_at(opts.StartAt, time.Now())
+		if err != nil {
+			return err
+		}
+		streamOpts.SetStartAtOperationTime(&ts)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	connectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	client, err := connect_mongo(connectCtx, target)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	stream, err := watch_target(ctx, client, database, collection, mongo.Pipeline{}, streamOpts)
+	if err != nil {
+		return describe_change_stream_error(fmt.Errorf("failed to open change stream: %v", err))
+	}
+	defer stream.Close(context.Background())
+
+	fmt.Printf("Watching %s (fullDocument=%s, fullDocumentBeforeChange=%s), Ctrl-C to stop\n\n",
+		namespace, option_or_default(config["change.stream.full.document"]), option_or_default(config["change.stream.full.document.before.change"]))
+	count := 0
+	for stream.Next(ctx) {
+		fmt.Println(format_change_event(stream.Current))
+		fmt.Printf("    resume token: %s\n\n", stream.ResumeToken())
+		count++
+		if opts.Limit > 0 && count >= opts.Limit {
+			break
+		}
+	}
+	if err := stream.Err(); err != nil && ctx.Err() == nil {
+		return describe_change_stream_error(err)
+	}
+	fmt.Printf("%d events\n", count)
+	return nil
+}
+
+func option_or_default(value string) string {
+	if value == "" {
+		return "default"
+	}
+	return value
+}
+
+// get_oplog_window reads the first and last oplog entries and the oplog size of a replica set member
+func get_oplog_window(ctx context.Context, client *mongo.Client) (*OplogWindow, error) {
+	oplog := client.Database("local").Collection("oplog.rs")
+	window := &OplogWindow{}
+
+	for _, bound := range []struct {
+		order int
+		ts    *primitive.Timestamp
+	}{{1, &window.First}, {-1, &window.Last}} {
+		var entry struct {
+			TS primitive.Timestamp `bson:"ts"`
+		}
+		findOpts := options.FindOne().SetSort(bson.D{{Key: "$natural", Value: bound.order}}).SetProjection(bson.D{{Key: "ts", Value: 1}})
+		if err := oplog.FindOne(ctx, bson.D{}, findOpts).Decode(&entry); err != nil {
+			return nil, fmt.Errorf("failed to read local.oplog.rs (connect to a replica set member, not mongos): %v", err)
+		}
+		*bound.ts = entry.TS
+	}
+
+	var stats bson.Raw
+	if err := client.Database("local").RunCommand(ctx, bson.D{{Key: "collStats", Value: "oplog.rs"}}).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("collStats failed on local.oplog.rs: %v", err)
+	}
+	window.Count, _ = stats.Lookup("count").AsInt64OK()
+	window.Size, _ = stats.Lookup("size").AsInt64OK()
+	window.MaxSize, _ = stats.Lookup("maxSize").AsInt64OK()
+	return window, nil
+}
+
+// format_oplog_window renders the window and, with a token, whether it can still be resumed
+func format_oplog_window(window *OplogWindow, token bson.Raw) string {
+	var b strings.Builder
+	span := time.Duration(int64(window.Last.T)-int64(window.First.T)) * time.Second
+	fmt.Fprintf(&b, "Oplog window\n")
+	fmt.Fprintf(&b, "├── First: %s\n", format_timestamp(window.First))
+	fmt.Fprintf(&b, "├── Last:  %s\n", format_timestamp(window.Last))
+	fmt.Fprintf(&b, "├── Span:  %s\n", span)
+	if window.MaxSize > 0 {
+		fmt.Fprintf(&b, "├── Size:  %s of %s (%.0f%%)\n", format_bytes(window.Size), format_bytes(window.MaxSize), 100*float64(window.Size)/float64(window.MaxSize))
+	} else {
+		fmt.Fprintf(&b, "├── Size:  %s\n", format_bytes(window.Size))
+	}
+
+	if token == nil {
+		fmt.Fprintf(&b, "└── Entries: %d", window.Count)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "├── Entries: %d\n", window.Count)
+	ts, ok := resume_token_timestamp(token)
+	switch {
+	case !ok:
+		fmt.Fprintf(&b, "└── Resume token: cluster time could not be decoded")
+	case ts.Before(window.First):
+		fmt.Fprintf(&b, "└── Resume token: %s ❌ has fallen off the oplog (%s before the first entry)", format_timestamp(ts), time.Duration(int64(window.First.T)-int64(ts.T))*time.Second)
+	default:
+		fmt.Fprintf(&b, "└── Resume token: %s ✅ within the window", format_timestamp(ts))
+	}
+	return b.String()
+}
+
+func format_bytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// show_oplog implements `klaunch mongo oplog`
+func show_oplog(resumeToken string) error {
+	var token bson.Raw
+	if resumeToken != "" {
+		var err error
+		if token, err = parse_resume_token(resumeToken); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := connect_mongo(ctx, resolve_mongo_target())
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	window, err := get_oplog_window(ctx, client)
+	if err != nil {
+		return err
+	}
+	fmt.Println(format_oplog_window(window, token))
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// a resume token at cluster time (1710335667, 3)
+const sampleResumeData = "8265F1A6B3000000032B022C0100296E5A1004"
+
+func TestParseResumeToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "connector offset", value: `{"_data": "` + sampleResumeData + `"}`},
+		{name: "hex string", value: sampleResumeData},
+		{name: "missing _data", value: `{"token": "x"}`, wantErr: true},
+		{name: "not hex", value: "resume-me", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := parse_resume_token(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error state: %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			ts, ok := resume_token_timestamp(token)
+			if !ok || ts.T != 1710335667 || ts.I != 3 {
+				t.Errorf("Expected (1710335667, 3), got %v %v", ts, ok)
+			}
+		})
+	}
+}
+
+func TestParseStartAt(t *testing.T) {
+	now := time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected uint32
+		wantErr  bool
+	}{
+		{value: "2024-03-13T11:00:00Z", expected: uint32(now.Add(-time.Hour).Unix())},
+		{value: "15m", expected: uint32(now.Add(-15 * time.Minute).Unix())},
+		{value: "1710335667", expected: 1710335667},
+		{value: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			ts, err := parse_start_at(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error state: %v", err)
+			}
+			if !tt.wantErr && ts.T != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, ts.T)
+			}
+		})
+	}
+}
+
+func TestFormatOplogWindow(t *testing.T) {
+	window := &OplogWindow{
+		First:   primitive.Timestamp{T: 1710335000, I: 1},
+		Last:    primitive.Timestamp{T: 1710338600, I: 7},
+		Count:   1200,
+		Size:    512 * 1024 * 1024,
+		MaxSize: 1024 * 1024 * 1024,
+	}
+
+	report := format_oplog_window(window, nil)
+	for _, expected := range []string{"Span:  1h0m0s", "512.0 MiB of 1.0 GiB (50%)", "└── Entries: 1200"} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, report)
+		}
+	}
+
+	token, _ := parse_resume_token(sampleResumeData)
+	if report := format_oplog_window(window, token); !strings.Contains(report, "✅ within the window") {
+		t.Errorf("Expected the token to be within the window:\n%s", report)
+	}
+	window.First = primitive.Timestamp{T: 1710336000}
+	if report := format_oplog_window(window, token); !strings.Contains(report, "❌ has fallen off the oplog (5m33s before the first entry)") {
+		t.Errorf("Expected the token to have fallen off:\n%s", report)
+	}
+}
+
+func TestGetOplogWindow(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("replica set member", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "local.oplog.rs", mtest.FirstBatch, bson.D{{Key: "ts", Value: primitive.Timestamp{T: 1710335000, I: 1}}}),
+			mtest.CreateCursorResponse(0, "local.oplog.rs", mtest.FirstBatch, bson.D{{Key: "ts", Value: primitive.Timestamp{T: 1710338600, I: 7}}}),
+			bson.D{{Key: "ok", Value: 1}, {Key: "count", Value: int32(1200)}, {Key: "size", Value: int64(2048)}, {Key: "maxSize", Value: int64(4096)}},
+		)
+
+		window, err := get_oplog_window(context.Background(), mt.Client)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if window.First.T != 1710335000 || window.Last.I != 7 || window.Count != 1200 || window.MaxSize != 4096 {
+			t.Errorf("Unexpected window %+v", window)
+		}
+	})
+
+	mt.Run("mongos", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "not allowed", Name: "Unauthorized"}))
+		if _, err := get_oplog_window(context.Background(), mt.Client); err == nil || !strings.Contains(err.Error(), "not mongos") {
+			t.Errorf("Expected a replica set member hint, got %v", err)
+		}
+	})
+}
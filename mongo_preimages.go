@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// split_namespace splits db.collection; collection names may contain dots
+func split_namespace(namespace string) (string, string, error) {
+	database, collection, found := strings.Cut(namespace, ".")
+	if !found || database == "" || collection == "" {
+		return "", "", fmt.Errorf("expected <database>.<collection>, got %q", namespace)
+	}
+	return database, collection, nil
+}
+
+// pre_images_status reports whether changeStreamPreAndPostImages is enabled, per collection.
+// An empty collection checks every collection of the database.
+func pre_images_status(ctx context.Context, client *mongo.Client, database, collection string) (map[string]bool, error) {
+	filter := bson.D{{Key: "type", Value: "collection"}}
+	if collection != "" {
+		filter = append(filter, bson.E{Key: "name", Value: collection})
+	}
+	specs, err := client.Database(database).ListCollectionSpecifications(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("could not list collections: %v", err)
+	}
+
+	status := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		enabled, ok := spec.Options.Lookup("changeStreamPreAndPostImages", "enabled").BooleanOK()
+		status[spec.Name] = ok && enabled
+	}
+	return status, nil
+}
+
+// set_pre_images runs collMod on an existing collection, or creates it with pre-images enabled
+func set_pre_images(ctx context.Context, client *mongo.Client, database, collection string, enabled bool) error {
+	status, err := pre_images_status(ctx, client, database, collection)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := status[collection]; !exists {
+		if !enabled {
+			return fmt.Errorf("collection %s.%s does not exist", database, collection)
+		}
+		opts := options.CreateCollection().SetChangeStreamPreAndPostImages(bson.D{{Key: "enabled", Value: true}})
+		if err := client.Database(database).CreateCollection(ctx, collection, opts); err != nil {
+			return fmt.Errorf("failed to create %s.%s: %v", database, collection, err)
+		}
+		return nil
+	}
+
+	command := bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "changeStreamPreAndPostImages", Value: bson.D{{Key: "enabled", Value: enabled}}},
+	}
+	if err := client.Database(database).RunCommand(ctx, command).Err(); err != nil {
+		return fmt.Errorf("collMod failed on %s.%s: %v", database, collection, err)
+	}
+	return nil
+}
+
+// parse_expire_after accepts "off" or a duration such as 1h and returns the setClusterParameter value
+func parse_expire_after(value string) (interface{}, error) {
+	if strings.EqualFold(value, "off") {
+		return "off", nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.ParseInt(value, 10, 64)
+		if convErr != nil {
+			return nil, fmt.Errorf("invalid expiration %q: use off, a number of seconds or a duration like 1h", value)
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+	if duration < time.Second {
+		return nil, fmt.Errorf("expiration must be at least 1s")
+	}
+	return int64(duration / time.Second), nil
+}
+
+// pre_images_expiration reads changeStreamOptions.preAndPostImages.expireAfterSeconds
+func pre_images_expiration(ctx context.Context, client *mongo.Client) (string, error) {
+	var result bson.Raw
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "getClusterParameter", Value: "changeStreamOptions"}}).Decode(&result)
+	if err != nil {
+		return "", err
+	}
+	value, err := result.LookupErr("clusterParameters", "0", "preAndPostImages", "expireAfterSeconds")
+	if err != nil {
+		return "off", nil
+	}
+	if value.Type == bson.TypeString {
+		return value.StringValue(), nil
+	}
+	if seconds, ok := value.AsInt64OK(); ok {
+		return (time.Duration(seconds) * time.Second).String(), nil
+	}
+	return value.String(), nil
+}
+
+func set_pre_images_expiration(ctx context.Context, client *mongo.Client, expireAfter interface{}) error {
+	command := bson.D{{Key: "setClusterParameter", Value: bson.D{
+		{Key: "changeStreamOptions", Value: bson.D{
+			{Key: "preAndPostImages", Value: bson.D{{Key: "expireAfterSeconds", Value: expireAfter}}},
+		}},
+	}}}
+	if err := client.Database("admin").RunCommand(ctx, command).Err(); err != nil {
+		return fmt.Errorf("setClusterParameter failed: %v", err)
+	}
+	return nil
+}
+
+// manage_pre_images implements `klaunch mongo preimages enable|disable|status <db.coll>`
+func manage_pre_images(action, namespace string, target MongoTarget, expireAfter string) error {
+	database, collection, err := split_namespace(namespace)
+	if err != nil {
+		return err
+	}
+
+	var expiration interface{}
+	if expireAfter != "" {
+		if action == "status" {
+			return fmt.Errorf("--expire-after is only used with enable and disable")
+		}
+		if expiration, err = parse_expire_after(expireAfter); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := connect_mongo(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	switch action {
+	case "enable", "disable":
+		if err := set_pre_images(ctx, client, database, collection, action == "enable"); err != nil {
+			return err
+		}
+		fmt.Printf("Pre- and post-images %sd on %s\n", action, namespace)
+		if expiration != nil {
+			if err := set_pre_images_expiration(ctx, client, expiration); err != nil {
+				return err
+			}
+			fmt.Printf("Cluster-wide expireAfterSeconds set to %v\n", expiration)
+		}
+	case "status":
+	default:
+		return fmt.Errorf("unknown action %q (use enable, disable or status)", action)
+	}
+
+	status, err := pre_images_status(ctx, client, database, collection)
+	if err != nil {
+		return err
+	}
+	enabled, exists := status[collection]
+	switch {
+	case !exists:
+		fmt.Printf("%s: collection does not exist\n", namespace)
+	case enabled:
+		fmt.Printf("%s: pre- and post-images ✅ enabled\n", namespace)
+	default:
+		fmt.Printf("%s: pre- and post-images ❌ disabled\n", namespace)
+	}
+
+	if expires, err := pre_images_expiration(ctx, client); err == nil {
+		fmt.Printf("expireAfterSeconds (cluster-wide): %s\n", expires)
+	} else {
+		fmt.Printf("expireAfterSeconds (cluster-wide): unavailable (%v)\n", err)
+	}
+	return nil
+}
+
+// offer_pre_images checks a source config that reads fullDocumentBeforeChange and offers to
+// enable pre-images on the collections missing them. Problems are reported, never fatal.
+func offer_pre_images(config map[string]string) {
+	mode := config["change.stream.full.document.before.change"]
+	if connector_kind(config) != "source" || (mode != "whenAvailable" && mode != "required") || config["database"] == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := connect_mongo(ctx, target_for_config(config))
+	if err != nil {
+		fmt.Println("Could not verify pre-images on MongoDB:", err)
+		return
+	}
+	defer client.Disconnect(context.Background())
+
+	database, collection := config["database"], config["collection"]
+	status, err := pre_images_status(ctx, client, database, collection)
+	if err != nil {
+		fmt.Println("Could not verify pre-images on MongoDB:", err)
+		return
+	}
+	if collection != "" {
+		if _, exists := status[collection]; !exists {
+			status[collection] = false
+		}
+	}
+
+	var missing []string
+	for name, enabled := range status {
+		if !enabled {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	sort.Strings(missing)
+
+	fmt.Printf("change.stream.full.document.before.change=%s but pre-images are not enabled on %s.{%s}\n", mode, database, strings.Join(missing, ","))
+	fmt.Print("Enable them now? [y/N]: ")
+	var answer string
+	fmt.Scanln(&answer)
+	if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+		fmt.Printf("Skipped; run `klaunch mongo preimages enable %s.<collection>` later\n", database)
+		return
+	}
+
+	// the answer may take longer than the check's timeout
+	writeCtx, writeCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer writeCancel()
+	for _, name := range missing {
+		if err := set_pre_images(writeCtx, client, database, name, true); err != nil {
+			fmt.Println("Error enabling pre-images:", err)
+			continue
+		}
+		fmt.Printf("Pre- and post-images enabled on %s.%s\n", database, name)
+	}
+}
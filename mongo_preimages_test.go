@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSplitNamespace(t *testing.T) {
+	database, collection, err := split_namespace("source_db_test.events.v2")
+	if err != nil || database != "source_db_test" || collection != "events.v2" {
+		t.Errorf("Unexpected split: %s, %s, %v", database, collection, err)
+	}
+	for _, invalid := range []string{"source_db_test", ".coll", "db."} {
+		if _, _, err := split_namespace(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestParseExpireAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected interface{}
+		wantErr  bool
+	}{
+		{value: "off", expected: "off"},
+		{value: "1h", expected: int64(3600)},
+		{value: "90", expected: int64(90)},
+		{value: "500ms", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			result, err := parse_expire_after(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error state: %v", err)
+			}
+			if !tt.wantErr && result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestPreImagesStatus(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("per collection", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "source_db_test.$cmd.listCollections", mtest.FirstBatch,
+			bson.D{
+				{Key: "name", Value: "orders"},
+				{Key: "type", Value: "collection"},
+				{Key: "options", Value: bson.D{{Key: "changeStreamPreAndPostImages", Value: bson.D{{Key: "enabled", Value: true}}}}},
+			},
+			bson.D{
+				{Key: "name", Value: "customers"},
+				{Key: "type", Value: "collection"},
+				{Key: "options", Value: bson.D{}},
+			},
+		))
+
+		status, err := pre_images_status(context.Background(), mt.Client, "source_db_test", "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !status["orders"] || status["customers"] {
+			t.Errorf("Unexpected status: %v", status)
+		}
+	})
+
+	mt.Run("collMod on existing collection", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "source_db_test.$cmd.listCollections", mtest.FirstBatch, bson.D{
+				{Key: "name", Value: "orders"},
+				{Key: "type", Value: "collection"},
+			}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		if err := set_pre_images(context.Background(), mt.Client, "source_db_test", "orders", true); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		command := mt.GetStartedEvent()
+		for command != nil && command.CommandName != "collMod" {
+			command = mt.GetStartedEvent()
+		}
+		if command == nil {
+			t.Fatal("Expected a collMod command")
+		}
+		enabled, ok := command.Command.Lookup("changeStreamPreAndPostImages", "enabled").BooleanOK()
+		if !ok || !enabled {
+			t.Errorf("Expected changeStreamPreAndPostImages.enabled=true, got %s", command.Command)
+		}
+	})
+
+	mt.Run("disable missing collection", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "source_db_test.$cmd.listCollections", mtest.FirstBatch))
+
+		if err := set_pre_images(context.Background(), mt.Client, "source_db_test", "missing", false); err == nil {
+			t.Error("Expected an error disabling pre-images on a missing collection")
+		}
+	})
+
+	mt.Run("expiration", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{
+			{Key: "ok", Value: 1},
+			{Key: "clusterParameters", Value: bson.A{bson.D{
+				{Key: "_id", Value: "changeStreamOptions"},
+				{Key: "preAndPostImages", Value: bson.D{{Key: "expireAfterSeconds", Value: int64(7200)}}},
+			}}},
+		})
+
+		expires, err := pre_images_expiration(context.Background(), mt.Client)
+		if err != nil || expires != "2h0m0s" {
+			t.Errorf("Expected 2h0m0s, got %q (%v)", expires, err)
+		}
+	})
+}
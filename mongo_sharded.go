@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// compose overlay with the config server, the shards and mongos
+const shardedComposeFile = "docker-compose.mongo-sharded.yaml"
+
+// mongos as seen from the host and from the Connect containers
+const shardedMongosURI = "mongodb://localhost:27217"
+const shardedConnectorURI = "mongodb://mongos:27017"
+
+const defaultShardCollection = "source_db_test.source_collection_test"
+
+// shardedReplicaSet is a single-member replica set of the sharded cluster
+type shardedReplicaSet struct {
+	Name      string
+	Host      string // member host inside the compose network
+	Addr      string // address published on the host
+	ConfigSvr bool
+}
+
+var shardedReplicaSets = []shardedReplicaSet{
+	{Name: "configrs", Host: "mongo-config:27017", Addr: "127.0.0.1:27200", ConfigSvr: true},
+	{Name: "shard1", Host: "mongo-shard1:27017", Addr: "127.0.0.1:27201"},
+	{Name: "shard2", Host: "mongo-shard2:27017", Addr: "127.0.0.1:27202"},
+}
+
+// is_command_error reports whether err is a server error with one of the codes
+func is_command_error(err error, codes ...int32) bool {
+	var commandErr mongo.CommandError
+	if !errors.As(err, &commandErr) {
+		return false
+	}
+	for _, code := range codes {
+		if commandErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// initiate_sharded_replica_set runs replSetInitiate; a set that is already initiated is left as is
+func initiate_sharded_replica_set(ctx context.Context, client *mongo.Client, rs shardedReplicaSet) error {
+	config := bson.D{
+		{Key: "_id", Value: rs.Name},
+		{Key: "configsvr", Value: rs.ConfigSvr},
+		{Key: "members", Value: bson.A{bson.D{{Key: "_id", Value: 0}, {Key: "host", Value: rs.Host}}}},
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetInitiate", Value: config}}).Err()
+	// 23: AlreadyInitialized
+	if err != nil && !is_command_error(err, 23) {
+		return fmt.Errorf("replSetInitiate failed on %s: %v", rs.Name, err)
+	}
+	return nil
+}
+
+// wait_for_primary polls hello until the member is writable
+func wait_for_primary(ctx context.Context, client *mongo.Client) error {
+	for {
+		var hello bson.M
+		err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+		if err == nil && hello["isWritablePrimary"] == true {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("no primary elected: %v", ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// connect_with_retry waits for a container that is still starting
+func connect_with_retry(ctx context.Context, connect func() (*mongo.Client, error)) (*mongo.Client, error) {
+	for {
+		client, err := connect()
+		if err == nil {
+			return client, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// shard_collection adds the shards and shards namespace on a hashed _id through mongos
+func shard_collection(ctx context.Context, client *mongo.Client, namespace string) error {
+	database, _, err := split_namespace(namespace)
+	if err != nil {
+		return err
+	}
+	admin := client.Database("admin")
+
+	for _, rs := range shardedReplicaSets {
+		if rs.ConfigSvr {
+			continue
+		}
+		// addShard is idempotent for the same replica set
+		if err := admin.RunCommand(ctx, bson.D{{Key: "addShard", Value: rs.Name + "/" + rs.Host}}).Err(); err != nil {
+			return fmt.Errorf("addShard %s failed: %v", rs.Name, err)
+		}
+	}
+
+	// enableSharding is implicit from 6.0 but still accepted
+	if err := admin.RunCommand(ctx, bson.D{{Key: "enableSharding", Value: database}}).Err(); err != nil {
+		return fmt.Errorf("enableSharding %s failed: %v", database, err)
+	}
+	command := bson.D{
+		{Key: "shardCollection", Value: namespace},
+		{Key: "key", Value: bson.D{{Key: "_id", Value: "hashed"}}},
+	}
+	if err := admin.RunCommand(ctx, command).Err(); err != nil {
+		return fmt.Errorf("shardCollection %s failed: %v", namespace, err)
+	}
+	return nil
+}
+
+// setup_sharded_cluster initiates the replica sets of the compose overlay, registers the shards
+// with mongos and shards the test collection
+func setup_sharded_cluster(namespace string) error {
+	if _, _, err := split_namespace(namespace); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	target := MongoTarget{URI: "mongodb://127.0.0.1"}
+	for _, rs := range shardedReplicaSets {
+		client, err := connect_with_retry(ctx, func() (*mongo.Client, error) { return connect_direct(ctx, target, rs.Addr) })
+		if err != nil {
+			return fmt.Errorf("%s is not reachable at %s: %v", rs.Name, rs.Addr, err)
+		}
+		err = initiate_sharded_replica_set(ctx, client, rs)
+		if err == nil {
+			err = wait_for_primary(ctx, client)
+		}
+		client.Disconnect(context.Background())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Replica set %s ready (%s)\n", rs.Name, rs.Host)
+	}
+
+	mongos := MongoTarget{URI: shardedMongosURI}
+	client, err := connect_with_retry(ctx, func() (*mongo.Client, error) { return connect_mongo(ctx, mongos) })
+	if err != nil {
+		return fmt.Errorf("mongos is not reachable at %s: %v", shardedMongosURI, err)
+	}
+	defer client.Disconnect(context.Background())
+	if err := shard_collection(ctx, client, namespace); err != nil {
+		return err
+	}
+	fmt.Printf("Collection %s sharded on { _id: \"hashed\" }\n", namespace)
+
+	topology, err := get_mongo_topology(ctx, client)
+	if err != nil {
+		return err
+	}
+	fmt.Println(format_mongo_topology(topology, shardedMongosURI))
+	fmt.Printf("Point source connectors at \"connection.uri\": %q\n", shardedConnectorURI)
+	fmt.Printf("Use --mongo-uri %s (or MONGO_URI in .klaunch.env) for the other mongo commands\n", shardedMongosURI)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestShardedComposeServices(t *testing.T) {
+	content, err := os.ReadFile(shardedComposeFile)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", shardedComposeFile, err)
+	}
+	for _, rs := range shardedReplicaSets {
+		service := strings.Split(rs.Host, ":")[0]
+		if !strings.Contains(string(content), service+":") || !strings.Contains(string(content), "--replSet "+rs.Name) {
+			t.Errorf("Expected service %s with replica set %s in %s", service, rs.Name, shardedComposeFile)
+		}
+	}
+	if !strings.Contains(string(content), "--configdb configrs/mongo-config:27017") {
+		t.Errorf("Expected mongos to use the config server replica set")
+	}
+}
+
+func TestShardedClusterSetup(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("already initiated", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 23, Message: "already initialized", Name: "AlreadyInitialized"}))
+		if err := initiate_sharded_replica_set(context.Background(), mt.Client, shardedReplicaSets[0]); err != nil {
+			t.Errorf("Expected an initiated set to be accepted, got %v", err)
+		}
+	})
+
+	mt.Run("initiate failure", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 93, Message: "bad config", Name: "InvalidReplicaSetConfig"}))
+		if err := initiate_sharded_replica_set(context.Background(), mt.Client, shardedReplicaSets[1]); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+
+	mt.Run("shard collection", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+		if err := shard_collection(context.Background(), mt.Client, "source_db_test.orders"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var commands []string
+		for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+			commands = append(commands, event.CommandName+" "+event.Command.Lookup(event.CommandName).StringValue())
+			if event.CommandName == "shardCollection" {
+				if key := event.Command.Lookup("key", "_id").StringValue(); key != "hashed" {
+					t.Errorf("Expected a hashed _id key, got %s", event.Command)
+				}
+			}
+		}
+		expected := "addShard shard1/mongo-shard1:27017,addShard shard2/mongo-shard2:27017,enableSharding source_db_test,shardCollection source_db_test.orders"
+		if strings.Join(commands, ",") != expected {
+			t.Errorf("Expected %s, got %s", expected, strings.Join(commands, ","))
+		}
+	})
+}
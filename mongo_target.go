@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"golang.org/x/mod/semver"
+)
+
+// defaultMongoURI is the local replica set klaunch reconfigures on start
+const defaultMongoURI = "mongodb://host.docker.internal:27017,host.docker.internal:27018,host.docker.internal:27019/?replicaSet=replset"
+
+// hostnames that reach a deployment running on this machine
+var localMongoHosts = map[string]bool{"localhost": true, "127.0.0.1": true, "::1": true, replicaSetHostname: true}
+
+// MongoTarget is the MongoDB deployment klaunch connects to, with the credentials and TLS files to use.
+// SCRAM credentials may also be part of the URI; a certificate key file without credentials selects X.509.
+type MongoTarget struct {
+	URI            string
+	Username       string
+	Password       string
+	AuthMechanism  string
+	AuthSource     string
+	TLSCAFile      string
+	TLSCertKeyFile string
+}
+
+// mongoTargetFlags holds the --mongo-* flags shared by every command
+var mongoTargetFlags MongoTarget
+
+// resolve_mongo_target takes each setting from the --mongo-* flags, then the MONGO_* entries of the
+// environment or .klaunch.env, and falls back to the local replica set
+func resolve_mongo_target() MongoTarget {
+	vars, err := load_template_vars("")
+	if err != nil {
+		vars = map[string]string{}
+	}
+	pick := func(flagValue, key string) string {
+		if flagValue != "" {
+			return flagValue
+		}
+		return vars[key]
+	}
+
+	target := MongoTarget{
+		URI:            pick(mongoTargetFlags.URI, "MONGO_URI"),
+		Username:       pick(mongoTargetFlags.Username, "MONGO_USERNAME"),
+		Password:       pick(mongoTargetFlags.Password, "MONGO_PASSWORD"),
+		AuthMechanism:  pick(mongoTargetFlags.AuthMechanism, "MONGO_AUTH_MECHANISM"),
+		AuthSource:     pick(mongoTargetFlags.AuthSource, "MONGO_AUTH_SOURCE"),
+		TLSCAFile:      pick(mongoTargetFlags.TLSCAFile, "MONGO_TLS_CA_FILE"),
+		TLSCertKeyFile: pick(mongoTargetFlags.TLSCertKeyFile, "MONGO_TLS_CERT_KEY_FILE"),
+	}
+	if target.URI == "" {
+		target.URI = defaultMongoURI
+	}
+	return target
+}
+
+// target_for_config is the deployment a connector config points to. --mongo-uri wins over connection.uri;
+// credentials and TLS files from the flags or .klaunch.env are kept either way.
+func target_for_config(config map[string]string) MongoTarget {
+	target := resolve_mongo_target()
+	if mongoTargetFlags.URI == "" && config["connection.uri"] != "" {
+		target.URI = config["connection.uri"]
+	}
+	return target
+}
+
+// client_options builds the driver options for the target
+func (t MongoTarget) client_options() (*options.ClientOptions, error) {
+	opts := options.Client().ApplyURI(t.URI).SetServerSelectionTimeout(5 * time.Second)
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MongoDB URI: %s", redact_text(err.Error()))
+	}
+
+	if t.Username != "" || t.AuthMechanism != "" || t.AuthSource != "" {
+		credential := options.Credential{}
+		if opts.Auth != nil {
+			credential = *opts.Auth
+		}
+		if t.Username != "" {
+			credential.Username = t.Username
+			credential.Password = t.Password
+			credential.PasswordSet = t.Password != ""
+		}
+		if t.AuthMechanism != "" {
+			credential.AuthMechanism = strings.ToUpper(t.AuthMechanism)
+		}
+		if t.AuthSource != "" {
+			credential.AuthSource = t.AuthSource
+		}
+		opts.SetAuth(credential)
+	}
+
+	if t.TLSCAFile != "" || t.TLSCertKeyFile != "" {
+		tlsOpts := make(map[string]interface{})
+		if t.TLSCAFile != "" {
+			tlsOpts["tlsCAFile"] = t.TLSCAFile
+		}
+		if t.TLSCertKeyFile != "" {
+			tlsOpts["tlsCertificateKeyFile"] = t.TLSCertKeyFile
+		}
+		tlsConfig, err := options.BuildTLSConfig(tlsOpts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS files: %v", err)
+		}
+		opts.SetTLSConfig(tlsConfig)
+
+		// a client certificate without other credentials authenticates with X.509
+		if t.TLSCertKeyFile != "" && opts.Auth == nil {
+			opts.SetAuth(options.Credential{AuthMechanism: "MONGODB-X509"})
+		}
+	}
+
+	if opts.Auth != nil && opts.Auth.AuthMechanism == "MONGODB-X509" && (opts.TLSConfig == nil || len(opts.TLSConfig.Certificates) == 0) {
+		return nil, fmt.Errorf("MONGODB-X509 needs a client certificate: pass --mongo-tls-cert-key-file or set MONGO_TLS_CERT_KEY_FILE")
+	}
+	return opts, nil
+}
+
+// is_local_target reports whether every host of the URI runs on this machine, so klaunch may
+// reconfigure the replica set. SRV URIs always point at remote deployments such as Atlas.
+func is_local_target(uri string) bool {
+	if strings.HasPrefix(uri, "mongodb+srv://") {
+		return false
+	}
+	cs, err := connstring.Parse(uri)
+	if err != nil || len(cs.Hosts) == 0 {
+		return false
+	}
+	for _, host := range cs.Hosts {
+		hostname, _, err := net.SplitHostPort(host)
+		if err != nil {
+			hostname = host
+		}
+		if !localMongoHosts[strings.ToLower(hostname)] {
+			return false
+		}
+	}
+	return true
+}
+
+// TopologyMember is a replica set member with its state, when replSetGetStatus is allowed
+type TopologyMember struct {
+	Host  string
+	State string
+}
+
+// MongoTopology describes a deployment for the topology report
+type MongoTopology struct {
+	Kind                 string
+	SetName              string
+	Members              []TopologyMember
+	Primary              string
+	Version              string
+	ChangeStreams        bool
+	ChangeStreamsMessage string
+}
+
+// get_mongo_topology gathers the topology with hello, buildInfo and, when permitted, replSetGetStatus
+func get_mongo_topology(ctx context.Context, client *mongo.Client) (*MongoTopology, error) {
+	admin := client.Database("admin")
+
+	var hello bson.M
+	if err := admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return nil, fmt.Errorf("failed to run hello: %v", err)
+	}
+
+	topology := &MongoTopology{Kind: "standalone"}
+	if setName, ok := hello["setName"].(string); ok {
+		topology.Kind = "replica set"
+		topology.SetName = setName
+		topology.Primary, _ = hello["primary"].(string)
+	} else if hello["msg"] == "isdbgrid" {
+		topology.Kind = "sharded cluster"
+	}
+
+	var buildInfo bson.M
+	if err := admin.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo); err == nil {
+		topology.Version, _ = buildInfo["version"].(string)
+	}
+
+	if topology.Kind == "replica set" {
+		topology.Members = replica_set_status_members(ctx, client)
+		if topology.Members == nil {
+			// replSetGetStatus needs clusterMonitor; hello still lists the members
+			for _, key := range []string{"hosts", "passives", "arbiters"} {
+				hosts, _ := hello[key].(bson.A)
+				for _, host := range hosts {
+					state := ""
+					if host == topology.Primary {
+						state = "PRIMARY"
+					}
+					topology.Members = append(topology.Members, TopologyMember{Host: fmt.Sprint(host), State: state})
+				}
+			}
+		}
+	}
+
+	topology.ChangeStreams, topology.ChangeStreamsMessage = change_streams_usable(topology)
+	return topology, nil
+}
+
+func replica_set_status_members(ctx context.Context, client *mongo.Client) []TopologyMember {
+	var status struct {
+		Members []struct {
+			Name     string `bson:"name"`
+			StateStr string `bson:"stateStr"`
+		} `bson:"members"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&status); err != nil {
+		return nil
+	}
+	members := make([]TopologyMember, 0, len(status.Members))
+	for _, member := range status.Members {
+		members = append(members, TopologyMember{Host: member.Name, State: member.StateStr})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Host < members[j].Host })
+	return members
+}
+
+// change_streams_usable checks what the source connector needs from the deployment
+func change_streams_usable(topology *MongoTopology) (bool, string) {
+	if topology.Kind == "standalone" {
+		return false, "change streams need a replica set or a sharded cluster"
+	}
+	if topology.Kind == "replica set" && topology.Primary == "" {
+		return false, "the replica set has no primary"
+	}
+	if topology.Version == "" {
+		return true, "server version unknown"
+	}
+	version := "v" + topology.Version
+	switch {
+	case semver.Compare(version, "v3.6.0") < 0:
+		return false, fmt.Sprintf("MongoDB %s does not support change streams (3.6 or later)", topology.Version)
+	case semver.Compare(version, "v6.0.0") < 0:
+		return true, "pre-images (change.stream.full.document.before.change) need MongoDB 6.0"
+	}
+	return true, "pre-images supported"
+}
+
+// format_mongo_topology renders the topology report as a tree
+func format_mongo_topology(topology *MongoTopology, uri string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "MongoDB %s\n", redact_text(uri))
+
+	kind := topology.Kind
+	if topology.SetName != "" {
+		kind = fmt.Sprintf("%s %q", kind, topology.SetName)
+	}
+	fmt.Fprintf(&b, "├── Topology: %s\n", kind)
+	version := topology.Version
+	if version == "" {
+		version = "unknown"
+	}
+	fmt.Fprintf(&b, "├── Version: %s\n", version)
+
+	if topology.Kind == "replica set" {
+		primary := topology.Primary
+		if primary == "" {
+			primary = "none"
+		}
+		fmt.Fprintf(&b, "├── Primary: %s\n", primary)
+		fmt.Fprintf(&b, "├── Members:\n")
+		for i, member := range topology.Members {
+			branch := "├──"
+			if i == len(topology.Members)-1 {
+				branch = "└──"
+			}
+			line := member.Host
+			if member.State != "" {
+				line += " " + member.State
+			}
+			fmt.Fprintf(&b, "│   %s %s\n", branch, line)
+		}
+	}
+
+	status := "❌ not usable"
+	if topology.ChangeStreams {
+		status = "✅ usable"
+	}
+	fmt.Fprintf(&b, "└── Change streams: %s (%s)", status, topology.ChangeStreamsMessage)
+	return b.String()
+}
+
+// report_mongo_topology connects to the target and prints its topology
+func report_mongo_topology(target MongoTarget) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := connect_mongo(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	topology, err := get_mongo_topology(ctx, client)
+	if err != nil {
+		return err
+	}
+	fmt.Println(format_mongo_topology(topology, target.URI))
+	return nil
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// stages MongoDB accepts in a change stream pipeline
+var changeStreamStages = map[string]bool{
+	"$addFields":                   true,
+	"$match":                       true,
+	"$project":                     true,
+	"$replaceRoot":                 true,
+	"$replaceWith":                 true,
+	"$redact":                      true,
+	"$set":                         true,
+	"$unset":                       true,
+	"$changeStreamSplitLargeEvent": true,
+}
+
+// PipelineIssue is a problem with one stage of a source pipeline; Stage is 0-based, -1 for the whole pipeline
+type PipelineIssue struct {
+	Stage    int
+	Operator string
+	Message  string
+}
+
+func (i PipelineIssue) String() string {
+	if i.Stage < 0 {
+		return i.Message
+	}
+	return fmt.Sprintf("stage %d (%s): %s", i.Stage+1, i.Operator, i.Message)
+}
+
+// parse_pipeline_stages splits the pipeline property into its stages, keeping the raw JSON of each
+func parse_pipeline_stages(pipeline string) ([]map[string]json.RawMessage, error) {
+	var stages []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(pipeline), &stages); err != nil {
+		return nil, fmt.Errorf("pipeline is not a JSON array of stages: %v", err)
+	}
+	return stages, nil
+}
+
+// validate_pipeline reports stages change streams reject and stages that drop the resume token
+func validate_pipeline(pipeline string) []PipelineIssue {
+	stages, err := parse_pipeline_stages(pipeline)
+	if err != nil {
+		return []PipelineIssue{{Stage: -1, Message: err.Error()}}
+	}
+
+	var issues []PipelineIssue
+	for i, stage := range stages {
+		if len(stage) != 1 {
+			issues = append(issues, PipelineIssue{Stage: i, Operator: "?", Message: fmt.Sprintf("a stage must have exactly one operator, found %d", len(stage))})
+			continue
+		}
+		for operator, body := range stage {
+			if !changeStreamStages[operator] {
+				issues = append(issues, PipelineIssue{Stage: i, Operator: operator, Message: "not allowed in a change stream pipeline"})
+				continue
+			}
+			if operator == "$changeStreamSplitLargeEvent" && i != len(stages)-1 {
+				issues = append(issues, PipelineIssue{Stage: i, Operator: operator, Message: "must be the last stage"})
+			}
+			if stage_removes_resume_token(operator, body) {
+				issues = append(issues, PipelineIssue{Stage: i, Operator: operator, Message: "modifies _id, the resume token; the connector fails to resume"})
+			}
+		}
+	}
+	return issues
+}
+
+// stage_removes_resume_token detects stages that exclude, overwrite or may replace the event _id
+func stage_removes_resume_token(operator string, body json.RawMessage) bool {
+	switch operator {
+	case "$replaceRoot", "$replaceWith":
+		return !bytes.Contains(body, []byte(`"_id"`))
+	case "$unset":
+		var fields interface{}
+		json.Unmarshal(body, &fields)
+		switch value := fields.(type) {
+		case string:
+			return value == "_id"
+		case []interface{}:
+			for _, field := range value {
+				if field == "_id" {
+					return true
+				}
+			}
+		}
+	case "$project", "$addFields", "$set":
+		var fields map[string]interface{}
+		if json.Unmarshal(body, &fields) != nil {
+			return false
+		}
+		value, ok := fields["_id"]
+		if !ok {
+			return false
+		}
+		if operator == "$project" {
+			return value == false || value == float64(0)
+		}
+		return true
+	}
+	return false
+}
+
+// format_pipeline indents the pipeline JSON, keeping the original key order
+func format_pipeline(pipeline, indent string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(strings.TrimSpace(pipeline)), indent, "  "); err != nil {
+		return "", err
+	}
+	return indent + buf.String(), nil
+}
+
+// format_pipeline_property prints the pipeline and its issues below the property, for `show components --config`
+func format_pipeline_property(pipeline, prefix string) {
+	formatted, err := format_pipeline(pipeline, prefix+"    ")
+	if err != nil {
+		fmt.Printf("%spipeline = %s\n", prefix, pipeline)
+	} else {
+		fmt.Printf("%spipeline =\n%s\n", prefix, formatted)
+	}
+	for _, issue := range validate_pipeline(pipeline) {
+		fmt.Printf("%s    ⚠️  %s\n", prefix, issue)
+	}
+}
+
+// PipelineTestOptions controls `klaunch pipeline test`
+type PipelineTestOptions struct {
+	EnvName    string
+	Collection string
+	Sample     string
+	Timeout    time.Duration
+}
+
+// change_stream_options mirrors the change stream settings of a source connector, which forces
+// updateLookup when publish.full.document.only is set
+func change_stream_options(config map[string]string) *options.ChangeStreamOptions {
+	opts := options.ChangeStream()
+	if config_is_true(config, "publish.full.document.only") {
+		opts.SetFullDocument(options.UpdateLookup)
+	} else if mode := config["change.stream.full.document"]; mode != "" {
+		opts.SetFullDocument(options.FullDocument(mode))
+	}
+	if mode := config["change.stream.full.document.before.change"]; mode != "" {
+		opts.SetFullDocumentBeforeChange(options.FullDocument(mode))
+	}
+	return opts
+}
+
+// pipeline_sample_document parses the --sample document, or builds a default one
+func pipeline_sample_document(sample string) (bson.D, error) {
+	if sample == "" {
+		return bson.D{
+			{Key: "name", Value: "klaunch sample"},
+			{Key: "email", Value: "sample@example.com"},
+			{Key: "klaunchPipelineTest", Value: true},
+			{Key: "createdAt", Value: time.Now().UTC()},
+		}, nil
+	}
+	var doc bson.D
+	if err := bson.UnmarshalExtJSON([]byte(sample), false, &doc); err != nil {
+		return nil, fmt.Errorf("invalid --sample document: %v", err)
+	}
+	return doc, nil
+}
+
+// watch_target opens a change stream at the same level as the connector: collection, database or cluster
+func watch_target(ctx context.Context, client *mongo.Client, database, collection string, pipeline interface{}, opts *options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	switch {
+	case database == "":
+		return client.Watch(ctx, pipeline, opts)
+	case collection == "":
+		return client.Database(database).Watch(ctx, pipeline, opts)
+	default:
+		return client.Database(database).Collection(collection).Watch(ctx, pipeline, opts)
+	}
+}
+
+// collect_change_events reads events until the context expires or limit events were read
+func collect_change_events(ctx context.Context, stream *mongo.ChangeStream, limit int) []bson.Raw {
+	var events []bson.Raw
+	for len(events) < limit && stream.Next(ctx) {
+		events = append(events, append(bson.Raw(nil), stream.Current...))
+	}
+	return events
+}
+
+func resume_token(event bson.Raw) string {
+	return event.Lookup("_id").String()
+}
+
+// connector_output applies what the connector does after the change stream, e.g. publish.full.document.only
+func connector_output(config map[string]string, event bson.Raw) (bson.Raw, bool) {
+	if !config_is_true(config, "publish.full.document.only") {
+		return event, true
+	}
+	fullDocument, ok := event.Lookup("fullDocument").DocumentOK()
+	return fullDocument, ok
+}
+
+// test_pipeline runs the connector pipeline as a change stream, writes a sample document, updates
+// and deletes it, and shows which events the connector would publish
+func test_pipeline(path string, opts PipelineTestOptions) error {
+	target, err := load_lint_target(path, opts.EnvName)
+	if err != nil {
+		return err
+	}
+	config := target.Config
+	if connector_kind(config) != "source" {
+		return fmt.Errorf("%s is not a MongoSourceConnector config", path)
+	}
+
+	pipeline := bson.A{}
+	if raw := strings.TrimSpace(config["pipeline"]); raw != "" {
+		for _, issue := range validate_pipeline(raw) {
+			fmt.Println("⚠️ ", issue)
+		}
+		var wrapper struct {
+			Pipeline bson.A `bson:"pipeline"`
+		}
+		if err := bson.UnmarshalExtJSON([]byte(`{"pipeline": `+raw+`}`), false, &wrapper); err != nil {
+			return fmt.Errorf("failed to parse pipeline: %v", err)
+		}
+		pipeline = wrapper.Pipeline
+	}
+
+	database := config["database"]
+	collection := opts.Collection
+	if collection == "" {
+		collection = config["collection"]
+	} else if config["collection"] != "" && config["collection"] != collection {
+		return fmt.Errorf("the connector only watches %s.%s; --collection is for connectors watching a whole database", database, config["collection"])
+	}
+	if database == "" || collection == "" {
+		return fmt.Errorf("the sample document needs a namespace: set database and collection in the config or pass --collection")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second+opts.Timeout)
+	defer cancel()
+	client, err := connect_mongo(ctx, target_for_config(config))
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+
+	sample, err := pipeline_sample_document(opts.Sample)
+	if err != nil {
+		return err
+	}
+
+	watchCollection := config["collection"]
+	streamOpts := change_stream_options(config)
+	raw, err := watch_target(ctx, client, database, watchCollection, mongo.Pipeline{}, streamOpts)
+	if err != nil {
+		return fmt.Errorf("failed to open change stream: %v", err)
+	}
+	defer raw.Close(context.Background())
+	filtered, err := watch_target(ctx, client, database, watchCollection, pipeline, streamOpts)
+	if err != nil {
+		return fmt.Errorf("the pipeline was rejected by MongoDB: %v", err)
+	}
+	defer filtered.Close(context.Background())
+
+	fmt.Printf("Watching %s with the pipeline of %s\n", namespace_label(database, watchCollection), path)
+	fmt.Printf("Writing a sample document to %s.%s (insert, update, delete)\n\n", database, collection)
+
+	coll := client.Database(database).Collection(collection)
+	result, err := coll.InsertOne(ctx, sample)
+	if err != nil {
+		return fmt.Errorf("failed to insert the sample document: %v", err)
+	}
+	filter := bson.D{{Key: "_id", Value: result.InsertedID}}
+	if _, err := coll.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "klaunchUpdatedAt", Value: time.Now().UTC()}}}}); err != nil {
+		return fmt.Errorf("failed to update the sample document: %v", err)
+	}
+	if _, err := coll.DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("failed to delete the sample document: %v", err)
+	}
+
+	readCtx, readCancel := context.WithTimeout(ctx, opts.Timeout)
+	rawEvents := collect_change_events(readCtx, raw, 3)
+	readCancel()
+	readCtx, readCancel = context.WithTimeout(ctx, opts.Timeout)
+	emitted := collect_change_events(readCtx, filtered, len(rawEvents))
+	readCancel()
+	for _, stream := range []*mongo.ChangeStream{raw, filtered} {
+		if err := stream.Err(); err != nil && ctx.Err() == nil {
+			return fmt.Errorf("the change stream failed: %v", err)
+		}
+	}
+
+	byToken := make(map[string]bson.Raw, len(emitted))
+	for _, event := range emitted {
+		byToken[resume_token(event)] = event
+	}
+
+	for _, event := range rawEvents {
+		operation := event.Lookup("operationType").StringValue()
+		output, ok := byToken[resume_token(event)]
+		if !ok {
+			fmt.Printf("%-7s → filtered out by the pipeline\n", operation)
+			continue
+		}
+		published, ok := connector_output(config, output)
+		if !ok {
+			fmt.Printf("%-7s → passes the pipeline but has no fullDocument; not published with publish.full.document.only\n", operation)
+			continue
+		}
+		pretty, err := bson.MarshalExtJSONIndent(published, false, false, "    ", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-7s → emitted\n    %s\n", operation, redact_text(string(pretty)))
+	}
+	if len(rawEvents) == 0 {
+		fmt.Println("No change events were received; check that the deployment is a replica set")
+	}
+	return nil
+}
+
+func namespace_label(database, collection string) string {
+	switch {
+	case database == "":
+		return "the whole cluster"
+	case collection == "":
+		return database + ".*"
+	default:
+		return database + "." + collection
+	}
+}
+
+// print_rendered_pipeline shows the pipeline of a rendered config in readable form on stderr
+func print_rendered_pipeline(rendered []byte) {
+	var doc struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	if json.Unmarshal(rendered, &doc) != nil {
+		return
+	}
+	pipeline, ok := doc.Config["pipeline"].(string)
+	if !ok || strings.TrimSpace(pipeline) == "" {
+		return
+	}
+
+	formatted, err := format_pipeline(pipeline, "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\npipeline: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\npipeline:\n%s\n", formatted)
+	for _, issue := range validate_pipeline(pipeline) {
+		fmt.Fprintf(os.Stderr, "  ⚠️  %s\n", issue)
+	}
+}
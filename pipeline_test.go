@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidatePipeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline string
+		expected []string
+	}{
+		{
+			name:     "match on namespace",
+			pipeline: `[{"$match": {"ns.db": {"$regex": "^database.*$"}}}]`,
+		},
+		{
+			name:     "allowed stages",
+			pipeline: `[{"$match": {"operationType": "insert"}}, {"$addFields": {"clusterTimestamp": {"$toDate": "$clusterTime"}}}, {"$project": {"fullDocument.password": 0}}]`,
+		},
+		{
+			name:     "stages not allowed in change streams",
+			pipeline: `[{"$match": {}}, {"$lookup": {"from": "users"}}, {"$group": {"_id": "$ns"}}]`,
+			expected: []string{"stage 2 ($lookup): not allowed", "stage 3 ($group): not allowed"},
+		},
+		{
+			name:     "resume token removed",
+			pipeline: `[{"$project": {"_id": 0, "fullDocument": 1}}]`,
+			expected: []string{"stage 1 ($project): modifies _id"},
+		},
+		{
+			name:     "unset resume token",
+			pipeline: `[{"$unset": ["_id", "updateDescription"]}]`,
+			expected: []string{"stage 1 ($unset): modifies _id"},
+		},
+		{
+			name:     "replace root without _id",
+			pipeline: `[{"$replaceRoot": {"newRoot": "$fullDocument"}}]`,
+			expected: []string{"stage 1 ($replaceRoot): modifies _id"},
+		},
+		{
+			name:     "split large event not last",
+			pipeline: `[{"$changeStreamSplitLargeEvent": {}}, {"$match": {}}]`,
+			expected: []string{"must be the last stage"},
+		},
+		{
+			name:     "not a pipeline",
+			pipeline: `{"$match": {}}`,
+			expected: []string{"not a JSON array of stages"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := validate_pipeline(tt.pipeline)
+			if len(issues) != len(tt.expected) {
+				t.Fatalf("Expected %d issues, got %v", len(tt.expected), issues)
+			}
+			for i, expected := range tt.expected {
+				if !strings.Contains(issues[i].String(), expected) {
+					t.Errorf("Expected %q, got %q", expected, issues[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFormatPipelineKeepsKeyOrder(t *testing.T) {
+	formatted, err := format_pipeline(`[{"$project": {"z": 1, "a": 1}}]`, "  ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Index(formatted, `"z"`) > strings.Index(formatted, `"a"`) {
+		t.Errorf("Expected the original key order:\n%s", formatted)
+	}
+	if !strings.HasPrefix(formatted, "  [\n    {") {
+		t.Errorf("Expected every line to be indented:\n%s", formatted)
+	}
+
+	if _, err := format_pipeline(`[{"$match": `, ""); err == nil {
+		t.Error("Expected an error for a truncated pipeline")
+	}
+}
+
+func TestConnectorOutput(t *testing.T) {
+	withDocument, _ := bson.Marshal(bson.D{
+		{Key: "operationType", Value: "insert"},
+		{Key: "fullDocument", Value: bson.D{{Key: "name", Value: "sample"}}},
+	})
+	withoutDocument, _ := bson.Marshal(bson.D{{Key: "operationType", Value: "delete"}})
+
+	if output, ok := connector_output(map[string]string{}, withDocument); !ok || output.Lookup("operationType").StringValue() != "insert" {
+		t.Errorf("Expected the full change event, got %v", output)
+	}
+
+	fullOnly := map[string]string{"publish.full.document.only": "true"}
+	output, ok := connector_output(fullOnly, withDocument)
+	if !ok || output.Lookup("name").StringValue() != "sample" {
+		t.Errorf("Expected only the full document, got %v", output)
+	}
+	if _, ok := connector_output(fullOnly, withoutDocument); ok {
+		t.Error("Events without fullDocument are not published with publish.full.document.only")
+	}
+}
+
+func TestChangeStreamOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected string
+	}{
+		{name: "unset", config: map[string]string{}},
+		{name: "configured", config: map[string]string{"change.stream.full.document": "whenAvailable"}, expected: "whenAvailable"},
+		{
+			name:     "full document only forces updateLookup",
+			config:   map[string]string{"publish.full.document.only": "true", "change.stream.full.document": "default"},
+			expected: "updateLookup",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := change_stream_options(tt.config)
+			fullDocument := ""
+			if opts.FullDocument != nil {
+				fullDocument = string(*opts.FullDocument)
+			}
+			if fullDocument != tt.expected {
+				t.Errorf("Expected fullDocument %q, got %q", tt.expected, fullDocument)
+			}
+		})
+	}
+}
+
+func TestPipelineSampleDocument(t *testing.T) {
+	doc, err := pipeline_sample_document(`{"_id": {"$oid": "65f1a2b3c4d5e6f708192a3b"}, "sku": "A-1", "qty": 3}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(doc) != 3 || doc[1].Key != "sku" {
+		t.Errorf("Expected the sample fields in order, got %v", doc)
+	}
+
+	if _, err := pipeline_sample_document(`{"sku": `); err == nil {
+		t.Error("Expected an error for an invalid sample")
+	}
+	if doc, _ := pipeline_sample_document(""); len(doc) == 0 {
+		t.Error("Expected a generated sample document")
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// every subdirectory of plugins/ is one Connect plugin, loaded with its own class loader
+const pluginsDir = "plugins"
+
+// where the Connect workers mount plugins/; it is part of CONNECT_PLUGIN_PATH
+const pluginsContainerDir = "/usr/share/klaunch-plugins"
+
+// ConnectPlugin is an entry of GET /connector-plugins
+type ConnectPlugin struct {
+	Class   string `json:"class"`
+	Type    string `json:"type"`
+	Version string `json:"version"`
+}
+
+// InstalledPlugin is a directory of plugins/ and the classes its jars contain
+type InstalledPlugin struct {
+	Name    string
+	Jars    []string
+	Size    int64
+	Classes map[string]bool
+}
+
+// ensure_plugins_dir creates plugins/ before compose mounts it and adds its mount to
+// CONNECT_PLUGIN_PATH in .env
+func ensure_plugins_dir() error {
+	if err := os.MkdirAll(pluginsDir, 0755); err != nil {
+		return err
+	}
+	env, _ := read_env_file(".env")
+	pluginPath := strings.Trim(env["CONNECT_PLUGIN_PATH"], `"'`)
+	for _, dir := range strings.Split(pluginPath, ",") {
+		if strings.TrimSpace(dir) == pluginsContainerDir {
+			return nil
+		}
+	}
+	if pluginPath == "" {
+		pluginPath = "/usr/share/java,/usr/share/confluent-hub-components"
+	}
+	_, err := set_env_value(".env", "CONNECT_PLUGIN_PATH", `"`+pluginPath+","+pluginsContainerDir+`"`)
+	return err
+}
+
+// plugin_name is the directory a source is installed into: --name, else the file or directory
+// name without its .jar or .zip extension
+func plugin_name(src, name string) (string, error) {
+	if name == "" {
+		name = filepath.Base(filepath.Clean(src))
+		for _, ext := range []string{".jar", ".zip"} {
+			name = strings.TrimSuffix(name, ext)
+		}
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid plugin name %q", name)
+	}
+	return name, nil
+}
+
+// add_plugin installs a jar, a zip (such as a Confluent Hub archive) or a directory of jars
+// into plugins/<name> and returns the name
+func add_plugin(src, name string, force bool) (string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+	name, err = plugin_name(src, name)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(pluginsDir, name)
+	if _, err := os.Stat(dest); err == nil {
+		if !force {
+			return "", fmt.Errorf("plugin %s is already installed; remove it or pass --force", name)
+		}
+		if err := os.RemoveAll(dest); err != nil {
+			return "", err
+		}
+	}
+
+	switch {
+	case info.IsDir():
+		err = copy_plugin_dir(src, dest)
+	case strings.HasSuffix(strings.ToLower(src), ".zip"):
+		err = extract_plugin_zip(src, dest)
+	case strings.HasSuffix(strings.ToLower(src), ".jar"):
+		err = copy_plugin_file(src, filepath.Join(dest, filepath.Base(src)), info.Mode())
+	default:
+		return "", fmt.Errorf("%s is not a jar, a zip or a directory", src)
+	}
+	if err == nil {
+		var jars []string
+		if jars, err = plugin_jars(dest); err == nil && len(jars) == 0 {
+			err = fmt.Errorf("%s contains no jar", src)
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dest)
+		return "", fmt.Errorf("failed to add plugin %s: %v", name, err)
+	}
+	return name, nil
+}
+
+func copy_plugin_file(src, dest string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func copy_plugin_dir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return os.MkdirAll(filepath.Join(dest, rel), 0755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return copy_plugin_file(path, filepath.Join(dest, rel), info.Mode())
+	})
+}
+
+// extract_plugin_zip unpacks an archive into dest, dropping the top-level directory that
+// Confluent Hub archives wrap their content in
+func extract_plugin_zip(src, dest string) error {
+	reader, err := zip.OpenReader(src)
+	if err != nil {
+		return fmt.Errorf("%s is not a zip: %v", src, err)
+	}
+	defer reader.Close()
+
+	prefix := ""
+	for i, file := range reader.File {
+		top, _, nested := strings.Cut(file.Name, "/")
+		if i == 0 && nested {
+			prefix = top + "/"
+		}
+		if !strings.HasPrefix(file.Name, prefix) {
+			prefix = ""
+			break
+		}
+	}
+
+	for _, file := range reader.File {
+		name := strings.TrimPrefix(file.Name, prefix)
+		if name == "" || file.FileInfo().IsDir() {
+			continue
+		}
+		target := filepath.Join(dest, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("%s has an entry outside the archive: %s", src, file.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		in, err := file.Open()
+		if err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			in.Close()
+			return err
+		}
+		_, err = io.Copy(out, in)
+		in.Close()
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plugin_jars lists the jars of an installed plugin, relative to its directory
+func plugin_jars(dir string) ([]string, error) {
+	var jars []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".jar") {
+			rel, _ := filepath.Rel(dir, path)
+			jars = append(jars, rel)
+		}
+		return nil
+	})
+	sort.Strings(jars)
+	return jars, err
+}
+
+// installed_plugins reads plugins/ and the class names of every jar
+func installed_plugins(dir string) ([]InstalledPlugin, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var plugins []InstalledPlugin
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		plugin := InstalledPlugin{Name: entry.Name(), Classes: make(map[string]bool)}
+		jars, err := plugin_jars(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		plugin.Jars = jars
+		for _, jar := range jars {
+			path := filepath.Join(dir, entry.Name(), jar)
+			if info, err := os.Stat(path); err == nil {
+				plugin.Size += info.Size()
+			}
+			reader, err := zip.OpenReader(path)
+			if err != nil {
+				continue
+			}
+			for _, file := range reader.File {
+				if class, ok := strings.CutSuffix(file.Name, ".class"); ok {
+					plugin.Classes[strings.ReplaceAll(class, "/", ".")] = true
+				}
+			}
+			reader.Close()
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+// fetch_connector_plugins lists connectors, converters and transformations a worker loaded
+func fetch_connector_plugins(port int) ([]ConnectPlugin, error) {
+	body, err := connect_worker_rest_get(port, "/connector-plugins?connectorsOnly=false")
+	if err != nil {
+		return nil, err
+	}
+	var plugins []ConnectPlugin
+	if err := json.Unmarshal(body, &plugins); err != nil {
+		return nil, fmt.Errorf("failed to parse connector plugins: %v", err)
+	}
+	return plugins, nil
+}
+
+// loaded_plugin_classes are the loaded plugins whose class comes from an installed plugin
+func loaded_plugin_classes(installed InstalledPlugin, loaded []ConnectPlugin) []ConnectPlugin {
+	var result []ConnectPlugin
+	for _, plugin := range loaded {
+		if installed.Classes[plugin.Class] {
+			result = append(result, plugin)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Class < result[j].Class })
+	return result
+}
+
+// format_plugins lists the installed plugins with their jars and, when Connect answered, the
+// classes the worker loaded from each
+func format_plugins(installed []InstalledPlugin, loaded []ConnectPlugin) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plugins in %s/ (mounted at %s):\n", pluginsDir, pluginsContainerDir)
+	if len(installed) == 0 {
+		b.WriteString("  none; add one with `klaunch plugin add <jar|zip|dir>`\n")
+	}
+	for _, plugin := range installed {
+		fmt.Fprintf(&b, "  %s (%d jars, %.1f MB)\n", plugin.Name, len(plugin.Jars), float64(plugin.Size)/(1<<20))
+		if loaded == nil {
+			continue
+		}
+		classes := loaded_plugin_classes(plugin, loaded)
+		if len(classes) == 0 {
+			b.WriteString("    not loaded by Kafka Connect\n")
+		}
+		for _, class := range classes {
+			fmt.Fprintf(&b, "    %-11s %s %s\n", class.Type, class.Class, class.Version)
+		}
+	}
+	return b.String()
+}
+
+func list_plugins() error {
+	installed, err := installed_plugins(pluginsDir)
+	if err != nil {
+		return err
+	}
+	loaded, err := fetch_connector_plugins(firstConnectRestPort)
+	if err != nil {
+		fmt.Printf("Kafka Connect unavailable (%v); showing installed plugins only\n", err)
+	}
+	fmt.Print(format_plugins(installed, loaded))
+	return nil
+}
+
+func remove_plugin(name string) error {
+	if _, err := plugin_name(name, name); err != nil {
+		return err
+	}
+	dest := filepath.Join(pluginsDir, name)
+	if _, err := os.Stat(dest); err != nil {
+		return fmt.Errorf("plugin %s is not installed", name)
+	}
+	return os.RemoveAll(dest)
+}
+
+// reload_plugins recreates the running Connect workers so they scan plugins/ again, then shows
+// what the first one loaded from the named plugin
+func reload_plugins(name string, timeout time.Duration) error {
+	if workers, err := running_connect_workers(); err != nil || len(workers) == 0 {
+		fmt.Println("Kafka Connect is not running; the change applies at the next `klaunch start`")
+		return err
+	}
+	workers, err := recreate_connect_workers()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	port := connect_worker_port(workers[0])
+	var loaded []ConnectPlugin
+	for {
+		if loaded, err = fetch_connector_plugins(port); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not answer within %s: %v", connect_worker_container(workers[0]), timeout, err)
+		}
+		time.Sleep(3 * time.Second)
+	}
+
+	installed, err := installed_plugins(pluginsDir)
+	if err != nil {
+		return err
+	}
+	for _, plugin := range installed {
+		if plugin.Name != name {
+			continue
+		}
+		classes := loaded_plugin_classes(plugin, loaded)
+		if len(classes) == 0 {
+			return fmt.Errorf("Kafka Connect loaded no connector, converter or transformation from %s; check the worker log", name)
+		}
+		fmt.Printf("Loaded from %s:\n", name)
+		for _, class := range classes {
+			fmt.Printf("  %-11s %s %s\n", class.Type, class.Class, class.Version)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPluginName(t *testing.T) {
+	tests := []struct {
+		src      string
+		name     string
+		expected string
+		wantErr  bool
+	}{
+		{src: "/tmp/kafka-connect-transform-common-0.1.0.jar", expected: "kafka-connect-transform-common-0.1.0"},
+		{src: "confluentinc-kafka-connect-avro-converter-7.7.0.zip", expected: "confluentinc-kafka-connect-avro-converter-7.7.0"},
+		{src: "build/libs/", expected: "libs"},
+		{src: "smt.jar", name: "my-smt", expected: "my-smt"},
+		{src: "smt.jar", name: "../escape", wantErr: true},
+		{src: "/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			name, err := plugin_name(tt.src, tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if name != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestAddPlugin(t *testing.T) {
+	tu := NewTestUtils(t)
+	tempDir := tu.CreateTempDirStructure(TempDirStructure{
+		Dirs:  []string{"src/transforms/lib"},
+		Files: map[string]string{"src/transforms/lib/README": "docs", "src/notes.txt": "text"},
+	})
+	originalWd, _ := os.Getwd()
+	os.Chdir(tempDir)
+	defer os.Chdir(originalWd)
+
+	writeTestJar(t, "src/smt.jar", map[string]string{"com/example/MaskField.class": ""})
+	writeTestJar(t, "src/transforms/lib/transforms.jar", map[string]string{"com/example/Flatten.class": ""})
+	writeTestJar(t, "src/avro-converter.zip", map[string]string{
+		"avro-converter/manifest.json":          "{}",
+		"avro-converter/lib/avro-converter.jar": "jar",
+		"avro-converter/lib/avro.jar":           "jar",
+	})
+	writeTestJar(t, "src/slip.zip", map[string]string{"../../outside.jar": "jar"})
+	writeTestJar(t, "src/empty.zip", map[string]string{"README": "no jars"})
+
+	tests := []struct {
+		src     string
+		name    string
+		force   bool
+		jars    string
+		wantErr string
+	}{
+		{src: "src/smt.jar", jars: "smt.jar"},
+		{src: "src/avro-converter.zip", jars: "lib/avro-converter.jar,lib/avro.jar"},
+		{src: "src/transforms", jars: "lib/transforms.jar"},
+		{src: "src/smt.jar", wantErr: "already installed"},
+		{src: "src/transforms/lib/transforms.jar", name: "smt", force: true, jars: "transforms.jar"},
+		{src: "src/slip.zip", wantErr: "outside the archive"},
+		{src: "src/empty.zip", wantErr: "contains no jar"},
+		{src: "src/notes.txt", wantErr: "not a jar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			name, err := add_plugin(tt.src, tt.name, tt.force)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			jars, _ := plugin_jars(filepath.Join(pluginsDir, name))
+			if strings.Join(jars, ",") != filepath.FromSlash(tt.jars) {
+				t.Errorf("Expected jars %s, got %v", tt.jars, jars)
+			}
+		})
+	}
+
+	if tu.FileExists("plugins/slip") || tu.FileExists("plugins/empty") || tu.FileExists("outside.jar") {
+		t.Error("Expected failed plugins to be cleaned up")
+	}
+	if err := remove_plugin("avro-converter"); err != nil || tu.FileExists("plugins/avro-converter") {
+		t.Errorf("Expected avro-converter to be removed: %v", err)
+	}
+	if err := remove_plugin("avro-converter"); err == nil {
+		t.Error("Expected an error removing a plugin that is not installed")
+	}
+}
+
+func TestFormatPlugins(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "transforms", "lib"), 0755)
+	os.MkdirAll(filepath.Join(dir, "unused"), 0755)
+	writeTestJar(t, filepath.Join(dir, "transforms", "lib", "transforms.jar"), map[string]string{
+		"com/example/MaskField.class":   "",
+		"com/example/MaskField$1.class": "",
+	})
+	writeTestJar(t, filepath.Join(dir, "unused", "unused.jar"), map[string]string{"com/example/Unused.class": ""})
+
+	installed, err := installed_plugins(dir)
+	if err != nil || len(installed) != 2 || !installed[0].Classes["com.example.MaskField"] {
+		t.Fatalf("Unexpected plugins %v, %v", installed, err)
+	}
+
+	loaded := []ConnectPlugin{
+		{Class: "com.example.MaskField", Type: "transformation", Version: "1.0"},
+		{Class: "com.mongodb.kafka.connect.MongoSinkConnector", Type: "sink", Version: "2.0.1"},
+	}
+	output := format_plugins(installed, loaded)
+	for _, expected := range []string{"  transforms (1 jars,", "    transformation com.example.MaskField 1.0", "  unused (1 jars,", "    not loaded by Kafka Connect"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(format_plugins(installed, nil), "not loaded") {
+		t.Error("Expected no load status without a Connect response")
+	}
+	if !strings.Contains(format_plugins(nil, nil), "none;") {
+		t.Error("Expected a hint when no plugin is installed")
+	}
+}
+
+func TestEnsurePluginsDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		expected string
+	}{
+		{
+			name:     "adds the mount",
+			env:      "CONNECT_PLUGIN_PATH=\"/usr/share/java,/usr/share/confluent-hub-components\"\nCP_VERSION=7.7.0\n",
+			expected: `"/usr/share/java,/usr/share/confluent-hub-components,/usr/share/klaunch-plugins"`,
+		},
+		{
+			name:     "already present",
+			env:      "CONNECT_PLUGIN_PATH=\"/usr/share/java,/usr/share/klaunch-plugins\"\n",
+			expected: `"/usr/share/java,/usr/share/klaunch-plugins"`,
+		},
+		{
+			name:     "missing",
+			env:      "CP_VERSION=7.7.0\n",
+			expected: `"/usr/share/java,/usr/share/confluent-hub-components,/usr/share/klaunch-plugins"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tu := NewTestUtils(t)
+			tempDir := tu.CreateTempDirStructure(TempDirStructure{Files: map[string]string{".env": tt.env}})
+			originalWd, _ := os.Getwd()
+			os.Chdir(tempDir)
+			defer os.Chdir(originalWd)
+
+			if err := ensure_plugins_dir(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			content, _ := os.ReadFile(".env")
+			if !strings.Contains(string(content), "CONNECT_PLUGIN_PATH="+tt.expected+"\n") {
+				t.Errorf("Expected CONNECT_PLUGIN_PATH=%s in:\n%s", tt.expected, content)
+			}
+			if !tu.FileExists(pluginsDir) {
+				t.Error("Expected plugins/ to be created")
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// shared template variables for case configs; .klaunch.<env>.env overrides it per environment
+const templateEnvFile = ".klaunch.env"
+
+// ${VAR} or ${VAR:-default}; Connect config provider references such as ${file:...} do not match
+var templateVarRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// load_template_vars builds the substitution variables: .klaunch.env, then .klaunch.<env>.env,
+// then the process environment, and finally KLAUNCH_ENV from --env
+func load_template_vars(envName string) (map[string]string, error) {
+	vars := make(map[string]string)
+
+	files := []string{templateEnvFile}
+	if envName != "" {
+		files = append(files, fmt.Sprintf(".klaunch.%s.env", envName))
+	}
+	for _, file := range files {
+		values, err := read_env_file(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		for key, value := range values {
+			vars[key] = value
+		}
+	}
+
+	for _, entry := range os.Environ() {
+		if key, value, found := strings.Cut(entry, "="); found {
+			vars[key] = value
+		}
+	}
+
+	if envName != "" {
+		vars["KLAUNCH_ENV"] = envName
+	}
+	return vars, nil
+}
+
+// substitute_template_vars replaces ${VAR} references and reports the undefined ones
+func substitute_template_vars(content string, vars map[string]string) (string, []string) {
+	missing := make(map[string]bool)
+	result := templateVarRegex.ReplaceAllStringFunc(content, func(ref string) string {
+		match := templateVarRegex.FindStringSubmatch(ref)
+		if value, ok := vars[match[1]]; ok {
+			return json_escape_string(value)
+		}
+		if strings.Contains(ref, ":-") {
+			return match[2]
+		}
+		missing[match[1]] = true
+		return ref
+	})
+
+	var names []string
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return result, names
+}
+
+// json_escape_string escapes a value so it can be placed inside a JSON string literal
+func json_escape_string(value string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	encoded := strings.TrimRight(buf.String(), "\n")
+	return encoded[1 : len(encoded)-1]
+}
+
+// render_config_file resolves variables and the "extends" chain of a case config
+func render_config_file(path string, vars map[string]string) (map[string]interface{}, error) {
+	return render_config_chain(path, vars, make(map[string]bool))
+}
+
+func render_config_chain(path string, vars map[string]string, visiting map[string]bool) (map[string]interface{}, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if visiting[absPath] {
+		return nil, fmt.Errorf("circular extends involving %s", path)
+	}
+	visiting[absPath] = true
+	defer delete(visiting, absPath)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// check the file as written so positions match what the user sees
+	if err := check_config_syntax(content); err != nil {
+		return nil, describe_config_defects(path, content, err)
+	}
+
+	rendered, missing := substitute_template_vars(string(content), vars)
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s: undefined variables %s (set them in the environment or %s)", path, strings.Join(missing, ", "), templateEnvFile)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(rendered), &doc); err != nil {
+		return nil, fmt.Errorf("%s: invalid JSON: %v", path, err)
+	}
+
+	base, hasBase := doc["extends"].(string)
+	delete(doc, "extends")
+	if !hasBase {
+		return doc, nil
+	}
+
+	parent, err := render_config_chain(filepath.Join(filepath.Dir(path), base), vars, visiting)
+	if err != nil {
+		return nil, err
+	}
+	return merge_connector_configs(parent, doc), nil
+}
+
+// merge_connector_configs overlays child on base; the "config" objects are merged key by key
+func merge_connector_configs(base, child map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(child))
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range child {
+		childConfig, childIsMap := value.(map[string]interface{})
+		baseConfig, baseIsMap := merged[key].(map[string]interface{})
+		if key == "config" && childIsMap && baseIsMap {
+			config := make(map[string]interface{}, len(baseConfig)+len(childConfig))
+			for k, v := range baseConfig {
+				config[k] = v
+			}
+			for k, v := range childConfig {
+				// null removes a property inherited from the base
+				if v == nil {
+					delete(config, k)
+					continue
+				}
+				config[k] = v
+			}
+			merged[key] = config
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// marshal_rendered_config prints name before config, as in the case_configs files
+func marshal_rendered_config(doc map[string]interface{}) ([]byte, error) {
+	var value interface{} = doc
+	name, hasName := doc["name"]
+	config, hasConfig := doc["config"]
+	if hasName && hasConfig && len(doc) == 2 {
+		value = struct {
+			Name   interface{} `json:"name"`
+			Config interface{} `json:"config"`
+		}{name, config}
+	}
+
+	// keep & < > readable in connection strings and pipelines
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func render_config(path string, envName string) ([]byte, error) {
+	vars, err := load_template_vars(envName)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := render_config_file(path, vars)
+	if err != nil {
+		return nil, err
+	}
+	if _, hasConfig := doc["config"]; !hasConfig {
+		content, _ := os.ReadFile(path)
+		return nil, describe_config_defects(path, content, fmt.Errorf("missing \"config\" object"))
+	}
+	return marshal_rendered_config(doc)
+}
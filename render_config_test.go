@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubstituteTemplateVars(t *testing.T) {
+	vars := map[string]string{
+		"MONGO_URI":   "mongodb://host.docker.internal:27017/?replicaSet=replset&w=majority",
+		"KLAUNCH_ENV": "uat",
+		"QUOTED":      `say "hi"`,
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		missing  []string
+	}{
+		{
+			name:     "plain variable",
+			content:  `"connection.uri": "${MONGO_URI}"`,
+			expected: `"connection.uri": "mongodb://host.docker.internal:27017/?replicaSet=replset&w=majority"`,
+		},
+		{
+			name:     "default used when unset",
+			content:  `"before": "${BEFORE_CHANGE:-whenAvailable}"`,
+			expected: `"before": "whenAvailable"`,
+		},
+		{
+			name:     "set variable wins over default",
+			content:  `"name": "SAMPLE.${KLAUNCH_ENV:-dev}"`,
+			expected: `"name": "SAMPLE.uat"`,
+		},
+		{
+			name:     "value is json escaped",
+			content:  `"comment": "${QUOTED}"`,
+			expected: `"comment": "say \"hi\""`,
+		},
+		{
+			name:     "config provider reference untouched",
+			content:  `"connection.password": "${file:/opt/secrets.properties:password}"`,
+			expected: `"connection.password": "${file:/opt/secrets.properties:password}"`,
+		},
+		{
+			name:     "undefined variables reported once",
+			content:  `"a": "${NOPE}", "b": "${ALSO_NOPE}", "c": "${NOPE}"`,
+			expected: `"a": "${NOPE}", "b": "${ALSO_NOPE}", "c": "${NOPE}"`,
+			missing:  []string{"ALSO_NOPE", "NOPE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, missing := substitute_template_vars(tt.content, vars)
+			if result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+			if !reflect.DeepEqual(missing, tt.missing) {
+				t.Errorf("Expected missing %v, got %v", tt.missing, missing)
+			}
+		})
+	}
+}
+
+func TestRenderConfigExtends(t *testing.T) {
+	tu := NewTestUtils(t)
+	dir := t.TempDir()
+	tu.CreateJSONFile(dir, "base.json", `{
+    "name": "base",
+    "config": {
+        "connector.class": "com.mongodb.kafka.connect.MongoSourceConnector",
+        "connection.uri": "${MONGO_URI}",
+        "tasks.max": "1",
+        "startup.mode": "copy_existing"
+    }
+}`)
+	path := tu.CreateJSONFile(dir, "child.json", `{
+    "extends": "base.json",
+    "name": "SAMPLE_TOPIC.${KLAUNCH_ENV}-v1",
+    "config": {
+        "tasks.max": "2",
+        "startup.mode": null
+    }
+}`)
+
+	doc, err := render_config_file(path, map[string]string{"MONGO_URI": "mongodb://localhost:27017", "KLAUNCH_ENV": "uat"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if doc["name"] != "SAMPLE_TOPIC.uat-v1" {
+		t.Errorf("Expected child name, got %v", doc["name"])
+	}
+	if _, ok := doc["extends"]; ok {
+		t.Error("extends should not be part of the rendered config")
+	}
+	config := doc["config"].(map[string]interface{})
+	expected := map[string]interface{}{
+		"connector.class": "com.mongodb.kafka.connect.MongoSourceConnector",
+		"connection.uri":  "mongodb://localhost:27017",
+		"tasks.max":       "2",
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Expected config %v, got %v", expected, config)
+	}
+}
+
+func TestEnvironmentExampleConfigs(t *testing.T) {
+	vars := map[string]string{"CONNECTION_URI": "mongodb://host.docker.internal:27017/?replicaSet=replset"}
+	tests := []struct {
+		file     string
+		expected map[string]string
+		absent   []string
+	}{
+		{
+			file:     "example_configs/kafka-configuration-prod.json",
+			expected: map[string]string{"name": "SAMPLE_TOPIC.prod-v1", "collection": "prod-v5", "errors.tolerance": "all", "change.stream.full.document.before.change": "whenAvailable"},
+		},
+		{
+			file:     "example_configs/kafka-configuration-uat.json",
+			expected: map[string]string{"name": "SAMPLE_TOPIC.uat-v1", "collection": "uat-v5", "change.stream.full.document.before.change": "required"},
+			absent:   []string{"offset.partition.name", "mongo.errors.deadletterqueue.topic.name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			doc, err := render_config_file(tt.file, vars)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			config := doc["config"].(map[string]interface{})
+			tt.expected["connection.uri"] = vars["CONNECTION_URI"]
+			tt.expected["database"] = "DemoDB"
+			for key, value := range tt.expected {
+				if config[key] != value {
+					t.Errorf("Expected %s=%s, got %v", key, value, config[key])
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := config[key]; ok {
+					t.Errorf("Did not expect %s", key)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderConfigErrors(t *testing.T) {
+	tu := NewTestUtils(t)
+	dir := t.TempDir()
+	tu.CreateJSONFile(dir, "a.json", `{"extends": "b.json", "name": "a", "config": {}}`)
+	loop := tu.CreateJSONFile(dir, "b.json", `{"extends": "a.json", "name": "b", "config": {}}`)
+	undefined := tu.CreateJSONFile(dir, "undefined.json", `{"name": "x", "config": {"connection.uri": "${MONGO_URI}"}}`)
+
+	if _, err := render_config_file(loop, map[string]string{}); err == nil || !strings.Contains(err.Error(), "circular extends") {
+		t.Errorf("Expected circular extends error, got %v", err)
+	}
+	if _, err := render_config_file(undefined, map[string]string{}); err == nil || !strings.Contains(err.Error(), "MONGO_URI") {
+		t.Errorf("Expected undefined variable error, got %v", err)
+	}
+}
+
+func TestMarshalRenderedConfigOrder(t *testing.T) {
+	doc := map[string]interface{}{
+		"config": map[string]interface{}{"connection.uri": "mongodb://a:27017/?replicaSet=rs&w=1"},
+		"name":   "mdb-kafka-connector-default",
+	}
+	rendered, err := marshal_rendered_config(doc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	text := string(rendered)
+	if strings.Index(text, `"name"`) > strings.Index(text, `"config"`) {
+		t.Errorf("Expected name before config:\n%s", text)
+	}
+	if !strings.Contains(text, "replicaSet=rs&w=1") {
+		t.Errorf("Expected & to be kept as is:\n%s", text)
+	}
+	var roundTrip map[string]interface{}
+	if err := json.Unmarshal(rendered, &roundTrip); err != nil {
+		t.Errorf("Rendered config is not valid JSON: %v", err)
+	}
+}
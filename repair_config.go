@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ConfigIssue is a defect found in a connector config file; Line is 0 when it applies to the whole file
+type ConfigIssue struct {
+	Line    int
+	Column  int
+	Kind    string
+	Message string
+}
+
+func (i ConfigIssue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s", i.Kind, i.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", i.Line, i.Column, i.Kind, i.Message)
+}
+
+// a single `"key": "value",` line, capturing everything up to the last quote as the value
+var quotedValueLineRegex = regexp.MustCompile(`^(\s*"([^"\\]+)"\s*:\s*")(.*)("\s*,?\s*)$`)
+
+// offset_to_line_column converts a byte offset into 1-based line and column numbers
+func offset_to_line_column(content string, offset int) (int, int) {
+	offset = max(0, min(offset, len(content)))
+	before := content[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	return line, column
+}
+
+// check_config_syntax reports JSON errors with the line and column where parsing stopped
+func check_config_syntax(content []byte) error {
+	var doc interface{}
+	err := json.Unmarshal(content, &doc)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *json.SyntaxError:
+		// Offset is just past the offending character
+		offset := int(e.Offset) - 1
+		for offset > 0 && offset < len(content) && !utf8.RuneStart(content[offset]) {
+			offset--
+		}
+		line, column := offset_to_line_column(string(content), offset)
+		return fmt.Errorf("invalid JSON at line %d, column %d: %v", line, column, e)
+	default:
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+}
+
+// looks_like_properties reports whether the first meaningful line is a key=value pair
+func looks_like_properties(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		return propertyLineRegex.MatchString(line)
+	}
+	return false
+}
+
+// parse_properties reads a flat connector .properties file, joining "\" continuation lines
+func parse_properties(content string) map[string]interface{} {
+	props := make(map[string]interface{})
+	pending := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if pending == "" && (line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!")) {
+			continue
+		}
+		if strings.HasSuffix(line, `\`) {
+			pending += strings.TrimSuffix(line, `\`)
+			continue
+		}
+		line = pending + line
+		pending = ""
+
+		if match := propertyLineRegex.FindStringSubmatch(line); match != nil {
+			props[match[2]] = match[4]
+		}
+	}
+	return props
+}
+
+// replace_unicode_whitespace turns non-breaking and other Unicode spaces pasted from documents or
+// chat tools into plain spaces; JSON only allows ASCII whitespace between tokens
+func replace_unicode_whitespace(content string) (string, []ConfigIssue) {
+	var out strings.Builder
+	var issues []ConfigIssue
+	inString, escaped := false, false
+	for i, c := range content {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			out.WriteRune(c)
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+		}
+		if c > unicode.MaxASCII && (unicode.IsSpace(c) || c == '\u200b' || c == '\ufeff') {
+			line, column := offset_to_line_column(content, i)
+			if len(issues) == 0 || issues[len(issues)-1].Line != line {
+				issues = append(issues, ConfigIssue{Line: line, Column: column, Kind: "invalid-whitespace", Message: fmt.Sprintf("%U is not valid JSON whitespace", c)})
+			}
+			out.WriteByte(' ')
+			continue
+		}
+		out.WriteRune(c)
+	}
+	return out.String(), issues
+}
+
+// escape_unescaped_quotes fixes one-line string values containing raw quotes, typically a pipeline
+// pasted without escaping. Lines that are valid on their own are left alone.
+func escape_unescaped_quotes(content string) (string, []ConfigIssue) {
+	var issues []ConfigIssue
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if line_is_valid_pair(line) {
+			continue
+		}
+		match := quotedValueLineRegex.FindStringSubmatch(line)
+		if match == nil || !strings.Contains(match[3], `"`) {
+			continue
+		}
+
+		var value strings.Builder
+		escaped := false
+		for _, c := range match[3] {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				value.WriteByte('\\')
+			}
+			value.WriteRune(c)
+		}
+
+		repaired := match[1] + value.String() + match[4]
+		if !line_is_valid_pair(repaired) {
+			continue
+		}
+		lines[i] = repaired
+		issues = append(issues, ConfigIssue{
+			Line:    i + 1,
+			Column:  len(match[1]) + 1,
+			Kind:    "unescaped-quotes",
+			Message: fmt.Sprintf("the %q value contains unescaped double quotes", match[2]),
+		})
+	}
+	return strings.Join(lines, "\n"), issues
+}
+
+func line_is_valid_pair(line string) bool {
+	pair := strings.TrimSuffix(strings.TrimSpace(line), ",")
+	return json.Valid([]byte("{" + pair + "}"))
+}
+
+// remove_trailing_commas drops commas directly followed by a closing brace or bracket
+func remove_trailing_commas(content string) (string, []ConfigIssue) {
+	var out strings.Builder
+	var issues []ConfigIssue
+	inString, escaped := false, false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			out.WriteByte(c)
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			rest := strings.TrimLeft(content[i+1:], " \t\r\n")
+			if rest != "" && (rest[0] == '}' || rest[0] == ']') {
+				line, column := offset_to_line_column(content, i)
+				issues = append(issues, ConfigIssue{Line: line, Column: column, Kind: "trailing-comma", Message: "comma before a closing " + string(rest[0])})
+				continue
+			}
+		}
+		out.WriteByte(c)
+	}
+	return out.String(), issues
+}
+
+// find_duplicate_keys walks the token stream of valid JSON and reports keys repeated within an object
+func find_duplicate_keys(content []byte) ([]ConfigIssue, error) {
+	var issues []ConfigIssue
+	dec := json.NewDecoder(bytes.NewReader(content))
+	if err := walk_json_value(dec, content, "", &issues); err != nil {
+		return nil, err
+	}
+	return issues, nil
+}
+
+func walk_json_value(dec *json.Decoder, content []byte, path string, issues *[]ConfigIssue) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return nil
+	}
+
+	switch delim {
+	case '{':
+		seen := make(map[string]bool)
+		for dec.More() {
+			token, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key := token.(string)
+			if seen[key] {
+				end := int(dec.InputOffset())
+				start := bytes.LastIndex(content[:end], []byte(`"`+key+`"`))
+				if start < 0 {
+					start = end
+				}
+				line, column := offset_to_line_column(string(content), start)
+				*issues = append(*issues, ConfigIssue{
+					Line:    line,
+					Column:  column,
+					Kind:    "duplicate-key",
+					Message: fmt.Sprintf("%q is defined more than once in %s; the last value is kept", key, json_path_name(path)),
+				})
+			}
+			seen[key] = true
+			if err := walk_json_value(dec, content, path+"."+key, issues); err != nil {
+				return err
+			}
+		}
+	case '[':
+		for dec.More() {
+			if err := walk_json_value(dec, content, path+"[]", issues); err != nil {
+				return err
+			}
+		}
+	}
+	// closing delimiter
+	_, err = dec.Token()
+	return err
+}
+
+func json_path_name(path string) string {
+	if path == "" {
+		return "the top-level object"
+	}
+	return fmt.Sprintf("%q", strings.TrimPrefix(path, "."))
+}
+
+// fix_config repairs the defects commonly found in configs sent by customers and returns the
+// corrected JSON together with what was changed. name is used when the file does not set one.
+func fix_config(content []byte, name string) ([]byte, []ConfigIssue, error) {
+	var issues []ConfigIssue
+	var doc map[string]interface{}
+
+	text := string(content)
+	if looks_like_properties(text) {
+		config := parse_properties(text)
+		doc = map[string]interface{}{"config": config}
+		issues = append(issues, ConfigIssue{Kind: "properties-format", Message: "flat .properties file converted to the {\"name\", \"config\"} JSON format"})
+	} else {
+		repaired, spaceIssues := replace_unicode_whitespace(text)
+		repaired, quoteIssues := escape_unescaped_quotes(repaired)
+		repaired, commaIssues := remove_trailing_commas(repaired)
+		issues = append(issues, spaceIssues...)
+		issues = append(issues, quoteIssues...)
+		issues = append(issues, commaIssues...)
+
+		if err := check_config_syntax([]byte(repaired)); err != nil {
+			return nil, issues, err
+		}
+		duplicates, err := find_duplicate_keys([]byte(repaired))
+		if err != nil {
+			return nil, issues, err
+		}
+		issues = append(issues, duplicates...)
+
+		if err := json.Unmarshal([]byte(repaired), &doc); err != nil {
+			return nil, issues, fmt.Errorf("expected a JSON object: %v", err)
+		}
+		if _, hasConfig := doc["config"]; !hasConfig {
+			doc = map[string]interface{}{"config": doc}
+			issues = append(issues, ConfigIssue{Kind: "missing-config-wrapper", Message: "connector properties are not nested under \"config\""})
+		}
+	}
+
+	if config, ok := doc["config"].(map[string]interface{}); ok {
+		configName, hasConfigName := config["name"]
+		if _, hasName := doc["name"]; !hasName {
+			// the flat forms keep the connector name among the properties
+			if value, ok := configName.(string); ok && value != "" {
+				name = value
+			}
+			doc["name"] = name
+			delete(config, "name")
+		} else if hasConfigName {
+			if configName == doc["name"] {
+				issues = append(issues, ConfigIssue{Kind: "duplicate-name", Message: "\"name\" is repeated inside \"config\"; the copy is removed"})
+			} else {
+				issues = append(issues, ConfigIssue{Kind: "name-mismatch", Message: fmt.Sprintf("config name %q differs from connector name %q; the copy is removed", configName, doc["name"])})
+			}
+			delete(config, "name")
+		}
+	}
+
+	// positioned issues in file order, whole-file ones last
+	sort.SliceStable(issues, func(a, b int) bool {
+		if (issues[a].Line == 0) != (issues[b].Line == 0) {
+			return issues[b].Line == 0
+		}
+		return issues[a].Line < issues[b].Line
+	})
+
+	fixed, err := marshal_rendered_config(doc)
+	return fixed, issues, err
+}
+
+// describe_config_defects turns a load failure into an error listing the detected defects
+func describe_config_defects(path string, content []byte, loadErr error) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %v", path, loadErr)
+
+	_, issues, _ := fix_config(content, config_name_from_path(path))
+	if len(issues) == 0 {
+		return fmt.Errorf("%s", b.String())
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(&b, "\n  - %s", issue)
+	}
+	fmt.Fprintf(&b, "\n  run `klaunch fix %s` to write a corrected version", path)
+	return fmt.Errorf("%s", b.String())
+}
+
+func config_name_from_path(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// fixed_config_path is where `klaunch fix` writes by default: name.json -> name.fixed.json
+func fixed_config_path(path string) string {
+	return filepath.Join(filepath.Dir(path), config_name_from_path(path)+".fixed.json")
+}
+
+func fix_config_file(path, output string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	fixed, issues, err := fix_config(content, config_name_from_path(path))
+	for _, issue := range issues {
+		fmt.Println("  -", issue)
+	}
+	if err != nil {
+		return fmt.Errorf("%s could not be repaired: %v", path, err)
+	}
+	if len(issues) == 0 {
+		fmt.Printf("No defects found in %s\n", path)
+		return nil
+	}
+
+	if output == "" {
+		output = fixed_config_path(path)
+	}
+	if err := os.WriteFile(output, append(fixed, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", output, err)
+	}
+	fmt.Printf("%d defects fixed, corrected config written to %s\n", len(issues), output)
+	return nil
+}
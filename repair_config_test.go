@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func issue_kinds(issues []ConfigIssue) []string {
+	var kinds []string
+	for _, issue := range issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	return kinds
+}
+
+func TestCheckConfigSyntaxPosition(t *testing.T) {
+	content := "{\n\"name\": \"a\",\n\"config\": {\n\"tasks.max\": \"1\",\n}\n}"
+	err := check_config_syntax([]byte(content))
+	if err == nil {
+		t.Fatal("Expected a syntax error")
+	}
+	if !strings.Contains(err.Error(), "line 5, column 1") {
+		t.Errorf("Expected position of the closing brace, got %v", err)
+	}
+}
+
+func TestFixConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		expectedKinds  []string
+		expectedConfig map[string]interface{}
+	}{
+		{
+			name: "unescaped pipeline and trailing comma",
+			content: `{
+"name": "source",
+"config": {
+"pipeline": "[{"$match": {"operationType": "insert"}}]",
+"tasks.max": "1",
+}
+}`,
+			expectedKinds: []string{"unescaped-quotes", "trailing-comma"},
+			expectedConfig: map[string]interface{}{
+				"pipeline":  `[{"$match": {"operationType": "insert"}}]`,
+				"tasks.max": "1",
+			},
+		},
+		{
+			name: "duplicate keys keep the last value",
+			content: `{"name": "source", "config": {
+    "tasks.max": "1",
+    "tasks.max": "2"
+}}`,
+			expectedKinds:  []string{"duplicate-key"},
+			expectedConfig: map[string]interface{}{"tasks.max": "2"},
+		},
+		{
+			name:          "missing config wrapper",
+			content:       `{"name": "flat-source", "connector.class": "com.mongodb.kafka.connect.MongoSourceConnector"}`,
+			expectedKinds: []string{"missing-config-wrapper"},
+			expectedConfig: map[string]interface{}{
+				"connector.class": "com.mongodb.kafka.connect.MongoSourceConnector",
+			},
+		},
+		{
+			name: "properties file",
+			content: `# exported from a distributed worker
+name=props-sink
+connector.class=com.mongodb.kafka.connect.MongoSinkConnector
+topics=orders,\
+  payments
+`,
+			expectedKinds: []string{"properties-format"},
+			expectedConfig: map[string]interface{}{
+				"connector.class": "com.mongodb.kafka.connect.MongoSinkConnector",
+				"topics":          "orders,payments",
+			},
+		},
+		{
+			name:          "non-breaking space indentation",
+			content:       "{\n\"name\": \"source\",\n\"config\": {\n  \"tasks.max\": \"1\"\n}\n}",
+			expectedKinds: []string{"invalid-whitespace"},
+			expectedConfig: map[string]interface{}{
+				"tasks.max": "1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixed, issues, err := fix_config([]byte(tt.content), "fallback")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if strings.Join(issue_kinds(issues), ",") != strings.Join(tt.expectedKinds, ",") {
+				t.Errorf("Expected issues %v, got %v", tt.expectedKinds, issues)
+			}
+
+			var doc struct {
+				Name   string                 `json:"name"`
+				Config map[string]interface{} `json:"config"`
+			}
+			if err := json.Unmarshal(fixed, &doc); err != nil {
+				t.Fatalf("Fixed config is not valid JSON: %v\n%s", err, fixed)
+			}
+			if doc.Name == "" || doc.Name == "fallback" {
+				t.Errorf("Expected the connector name from the file, got %q", doc.Name)
+			}
+			for key, value := range tt.expectedConfig {
+				if doc.Config[key] != value {
+					t.Errorf("Expected %s=%v, got %v", key, value, doc.Config[key])
+				}
+			}
+			if _, ok := doc.Config["name"]; ok {
+				t.Error("name should only be set at the top level")
+			}
+		})
+	}
+}
+
+func TestFixConfigUnrepairable(t *testing.T) {
+	_, _, err := fix_config([]byte("{\n\"name\": \"a\"\n\"config\": {}\n}"), "a")
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected positioned error for a missing comma, got %v", err)
+	}
+}
+
+func TestFixProductionSample(t *testing.T) {
+	content, err := os.ReadFile("example_configs/fix/kafka-configuration-prod.json")
+	if err != nil {
+		t.Skip("example config not available")
+	}
+	if check_config_syntax(content) == nil {
+		t.Fatal("The production sample is expected to be malformed")
+	}
+
+	fixed, issues, err := fix_config(content, "kafka-configuration-prod")
+	if err != nil {
+		t.Fatalf("Expected the sample to be repaired: %v", err)
+	}
+	if !strings.Contains(strings.Join(issue_kinds(issues), ","), "unescaped-quotes") {
+		t.Errorf("Expected the pipeline quotes to be reported, got %v", issues)
+	}
+	if check_config_syntax(fixed) != nil {
+		t.Errorf("Fixed sample is still invalid:\n%s", fixed)
+	}
+}
+
+func TestRenderConfigReportsDefects(t *testing.T) {
+	tu := NewTestUtils(t)
+	path := tu.CreateJSONFile(t.TempDir(), "broken.json", "{\n\"name\": \"a\",\n\"config\": {\"tasks.max\": \"1\",}\n}")
+
+	_, err := render_config_file(path, map[string]string{})
+	if err == nil {
+		t.Fatal("Expected an error for a trailing comma")
+	}
+	for _, expected := range []string{"line 3", "trailing-comma", "klaunch fix"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in error:\n%v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// database filled with padding documents to roll the oplog; dropped afterwards
+const scenarioDatabase = "klaunch_scenario"
+
+// replSetResizeOplog does not accept less than 990 MB
+const minOplogSizeMB = 990
+
+// ResumeExpiryOptions controls `klaunch scenario resume-expiry`
+type ResumeExpiryOptions struct {
+	Wait       time.Duration
+	MaxWriteMB int64
+}
+
+// oplogMember is a replica set member with the oplog size to restore
+type oplogMember struct {
+	Host       string
+	Addr       string
+	OriginalMB float64
+}
+
+// connect_rest_send sends a bodiless PUT or POST to the Kafka Connect REST API
+func connect_rest_send(method, path string) error {
+	req, err := http.NewRequest(method, "http://localhost:8083"+path, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s failed: %s %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func fetch_connector_config(name string) (map[string]string, error) {
+	raw, err := connect_rest_get(fmt.Sprintf("/connectors/%s/config", name))
+	if err != nil {
+		return nil, err
+	}
+	var config map[string]string
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config of %s: %v", name, err)
+	}
+	return config, nil
+}
+
+// effective_error_tolerance returns the tolerance setting the source applies: mongo.errors.tolerance
+// takes precedence over errors.tolerance, and the default is none
+func effective_error_tolerance(config map[string]string) (string, string) {
+	for _, key := range []string{"mongo.errors.tolerance", "errors.tolerance"} {
+		if value := config[key]; value != "" {
+			return key, value
+		}
+	}
+	return "errors.tolerance", "none"
+}
+
+// resume_expiry_expectations explains how the recovery settings of a source config should behave
+// once its resume token has left the oplog
+func resume_expiry_expectations(config map[string]string) []string {
+	var notes []string
+
+	toleranceKey, tolerance := effective_error_tolerance(config)
+	startupMode := config["startup.mode"]
+	if startupMode == "" {
+		startupMode = "latest"
+		if config_is_true(config, "copy.existing") {
+			startupMode = "copy_existing"
+		}
+	}
+
+	if tolerance == "all" {
+		notes = append(notes, fmt.Sprintf("%s=all: the task is expected to log the lost resume token and restart the change stream without it, following startup.mode=%s.", toleranceKey, startupMode))
+		switch startupMode {
+		case "latest":
+			notes = append(notes, "startup.mode=latest: the stream restarts at the current time; writes made while the token was lost are never published.")
+		case "timestamp":
+			at := config["startup.mode.timestamp.start.at.operation.time"]
+			if at == "" {
+				at = "(not set)"
+			}
+			notes = append(notes, fmt.Sprintf("startup.mode=timestamp: the stream restarts at %s, which must itself still be in the oplog.", at))
+		case "copy_existing":
+			notes = append(notes, "startup.mode=copy_existing: the collection is copied again, so consumers see duplicates but no gap.")
+		}
+	} else {
+		notes = append(notes, fmt.Sprintf("%s=%s: the task is expected to FAIL with ChangeStreamHistoryLost (\"resume point may no longer be in the oplog\"). Restarting it does not help because the stored offset is reused.", toleranceKey, tolerance))
+		notes = append(notes, fmt.Sprintf("Recovery needs a new offset.partition.name (or deleted offsets) so startup.mode=%s applies, or %s=all.", startupMode, toleranceKey))
+	}
+
+	if config["heartbeat.interval.ms"] == "" || config["heartbeat.interval.ms"] == "0" {
+		notes = append(notes, "heartbeat.interval.ms is not set: on quiet or filtered namespaces the stored token does not advance, which makes expiry more likely.")
+	}
+	return notes
+}
+
+// summarize_recovery compares the task states after the scenario with the expectations
+func summarize_recovery(config map[string]string, status *ConnectorStatus) string {
+	failed, running := 0, 0
+	for _, task := range status.Tasks {
+		switch strings.ToUpper(task.State) {
+		case "FAILED":
+			failed++
+		case "RUNNING":
+			running++
+		}
+	}
+	toleranceKey, tolerance := effective_error_tolerance(config)
+	tolerant := tolerance == "all"
+
+	switch {
+	case len(status.Tasks) == 0:
+		return "No tasks were reported; check the connector state."
+	case failed > 0 && tolerant:
+		return fmt.Sprintf("Tasks FAILED although %s=all; the connector version may not recover from a lost resume token.", toleranceKey)
+	case failed > 0:
+		return fmt.Sprintf("Tasks FAILED as expected with %s=%s.", toleranceKey, tolerance)
+	case running == len(status.Tasks) && tolerant:
+		return "Tasks recovered and are RUNNING; check the topic for the gap or duplicates described above."
+	case running == len(status.Tasks):
+		return "Tasks are RUNNING: the resume token may not have been read yet (no new events), or it was still in the oplog. Write to the watched namespace and check again."
+	default:
+		return "Tasks did not settle; run `klaunch show components --verbose`."
+	}
+}
+
+// oplog_members lists the members of the local replica set with their current oplog size
+func oplog_members(ctx context.Context, target MongoTarget, primary *mongo.Client) ([]oplogMember, error) {
+	config, err := get_replica_set_config(ctx, primary)
+	if err != nil {
+		return nil, err
+	}
+	members, err := replica_set_members(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []oplogMember
+	for _, member := range members {
+		// arbiters have no oplog
+		if member["arbiterOnly"] == true {
+			continue
+		}
+		host, _ := member["host"].(string)
+		_, port, err := net.SplitHostPort(host)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected member host %q: %v", host, err)
+		}
+		m := oplogMember{Host: host, Addr: net.JoinHostPort("127.0.0.1", port)}
+		client, err := connect_direct(ctx, target, m.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("member %s: %v", host, err)
+		}
+		var stats bson.Raw
+		err = client.Database("local").RunCommand(ctx, bson.D{{Key: "collStats", Value: "oplog.rs"}}).Decode(&stats)
+		client.Disconnect(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("collStats failed on %s: %v", host, err)
+		}
+		maxSize, _ := stats.Lookup("maxSize").AsInt64OK()
+		m.OriginalMB = float64(maxSize) / (1024 * 1024)
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// resize_oplogs runs replSetResizeOplog on every member; size is in MB
+func resize_oplogs(ctx context.Context, target MongoTarget, members []oplogMember, size func(oplogMember) float64) error {
+	for _, member := range members {
+		client, err := connect_direct(ctx, target, member.Addr)
+		if err != nil {
+			return fmt.Errorf("member %s: %v", member.Host, err)
+		}
+		command := bson.D{
+			{Key: "replSetResizeOplog", Value: 1},
+			{Key: "size", Value: size(member)},
+			{Key: "minRetentionHours", Value: 0},
+		}
+		err = client.Database("admin").RunCommand(ctx, command).Err()
+		client.Disconnect(context.Background())
+		if err != nil {
+			return fmt.Errorf("replSetResizeOplog failed on %s: %v", member.Host, err)
+		}
+	}
+	return nil
+}
+
+// roll_oplog writes 1 MB padding documents until the first oplog entry is newer than since
+func roll_oplog(ctx context.Context, client *mongo.Client, since primitive.Timestamp, maxWriteMB int64, out io.Writer) (int64, error) {
+	coll := client.Database(scenarioDatabase).Collection("padding")
+	padding := strings.Repeat("x", 1024*1024-128)
+	var writtenMB int64
+	for writtenMB < maxWriteMB {
+		docs := make([]interface{}, 16)
+		for i := range docs {
+			docs[i] = bson.D{{Key: "padding", Value: padding}}
+		}
+		if _, err := coll.InsertMany(ctx, docs); err != nil {
+			return writtenMB, fmt.Errorf("failed to write padding: %v", err)
+		}
+		writtenMB += int64(len(docs))
+
+		window, err := get_oplog_window(ctx, client)
+		if err != nil {
+			return writtenMB, err
+		}
+		if since.Before(window.First) {
+			return writtenMB, nil
+		}
+		if writtenMB%256 == 0 {
+			fmt.Fprintf(out, "  %d MB written, oplog starts at %s\n", writtenMB, format_timestamp(window.First))
+		}
+	}
+	return writtenMB, fmt.Errorf("the oplog did not roll after %d MB; raise --max-write-mb", writtenMB)
+}
+
+// wait_for_tasks polls the connector until a task fails or the wait expires
+func wait_for_tasks(name string, wait time.Duration) (*ConnectorStatus, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		status, err := list_connector_status(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range status.Tasks {
+			if strings.ToUpper(task.State) == "FAILED" {
+				return status, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return status, nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// run_resume_expiry_scenario pauses a source connector, shrinks and rolls the oplog of the local
+// replica set past its resume token, resumes it and reports how the tasks recover
+func run_resume_expiry_scenario(name string, opts ResumeExpiryOptions) error {
+	config, err := fetch_connector_config(name)
+	if err != nil {
+		return err
+	}
+	if connector_kind(config) != "source" {
+		return fmt.Errorf("%s is not a MongoSourceConnector", name)
+	}
+	target := target_for_config(config)
+	if !is_local_target(target.URI) {
+		return fmt.Errorf("the connector reads from %s; the scenario only resizes the oplog of the local replica set", redact_text(target.URI))
+	}
+
+	var report bytes.Buffer
+	out := io.MultiWriter(os.Stdout, &report)
+	fmt.Fprintf(out, "Resume token expiry scenario for %s (%s)\n", name, time.Now().UTC().Format(time.RFC3339))
+	for _, key := range []string{"mongo.errors.tolerance", "errors.tolerance", "startup.mode", "startup.mode.timestamp.start.at.operation.time", "heartbeat.interval.ms", "offset.partition.name"} {
+		if value, ok := config[key]; ok {
+			fmt.Fprintf(out, "  %s = %s\n", key, value)
+		}
+	}
+	fmt.Fprintln(out, "Expected:")
+	for _, note := range resume_expiry_expectations(config) {
+		fmt.Fprintf(out, "  - %s\n", note)
+	}
+	fmt.Fprintln(out)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	primary, _, err := connect_replica_set_primary(ctx, target, local_replica_set_seeds(target.URI))
+	if err != nil {
+		return err
+	}
+	defer primary.Disconnect(context.Background())
+	members, err := oplog_members(ctx, target, primary)
+	if err != nil {
+		return err
+	}
+
+	if err := connect_rest_send(http.MethodPut, fmt.Sprintf("/connectors/%s/pause", name)); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "1. Connector %s paused\n", name)
+	resumed := false
+	defer func() {
+		if !resumed {
+			if err := connect_rest_send(http.MethodPut, fmt.Sprintf("/connectors/%s/resume", name)); err != nil {
+				fmt.Println("Error resuming the connector:", err)
+			}
+		}
+	}()
+	// let the paused tasks commit their last offsets
+	time.Sleep(5 * time.Second)
+
+	window, err := get_oplog_window(ctx, primary)
+	if err != nil {
+		return err
+	}
+	pausedAt := window.Last
+
+	if err := resize_oplogs(ctx, target, members, func(oplogMember) float64 { return minOplogSizeMB }); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "2. Oplog resized to %d MB on %d members\n", minOplogSizeMB, len(members))
+	defer func() {
+		if err := resize_oplogs(context.Background(), target, members, func(m oplogMember) float64 { return m.OriginalMB }); err != nil {
+			fmt.Println("Error restoring the oplog size:", err)
+			return
+		}
+		fmt.Println("Oplog size restored")
+	}()
+	defer primary.Database(scenarioDatabase).Drop(context.Background())
+
+	writtenMB, err := roll_oplog(ctx, primary, pausedAt, opts.MaxWriteMB, out)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "3. Wrote %d MB to %s.padding; the oplog no longer holds %s\n", writtenMB, scenarioDatabase, format_timestamp(pausedAt))
+
+	if err := connect_rest_send(http.MethodPut, fmt.Sprintf("/connectors/%s/resume", name)); err != nil {
+		return err
+	}
+	resumed = true
+	// restart the tasks so they resume from the stored offset rather than an open cursor
+	if err := connect_rest_send(http.MethodPost, fmt.Sprintf("/connectors/%s/restart?includeTasks=true", name)); err != nil {
+		fmt.Fprintf(out, "   restart failed: %v\n", err)
+	}
+	fmt.Fprintf(out, "4. Connector resumed and restarted, waiting up to %s for the tasks\n\n", opts.Wait)
+
+	status, err := wait_for_tasks(name, opts.Wait)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Connector state: %v\n", status.Connector["state"])
+	for _, task := range status.Tasks {
+		fmt.Fprintf(out, "Task %d: %s (worker: %s)\n", task.ID, task.State, task.Worker)
+		if task.Trace != "" {
+			fmt.Fprintf(out, "%s\n", redact_text(task.Trace))
+			if rule := classify_failure_trace(task.Trace, failure_rules()); rule != nil {
+				fmt.Fprintf(out, "💡 Known issue: %s [%s]\n   %s\n", rule.Title, rule.ID, rule.Remediation)
+			}
+		}
+	}
+	fmt.Fprintf(out, "\nResult: %s\n", summarize_recovery(config, status))
+
+	if err := os.MkdirAll("logs", 0755); err != nil {
+		return err
+	}
+	path := fmt.Sprintf("logs/%s_resume_expiry_%s.log", time.Now().Format("20060102_150405"), name)
+	if err := os.WriteFile(path, report.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Report saved to %s\n", path)
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResumeExpiryExpectations(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected []string
+		absent   []string
+	}{
+		{
+			name:     "defaults",
+			config:   map[string]string{},
+			expected: []string{"errors.tolerance=none", "startup.mode=latest applies", "heartbeat.interval.ms is not set"},
+		},
+		{
+			name:     "tolerant with copy existing",
+			config:   map[string]string{"errors.tolerance": "all", "startup.mode": "copy_existing", "heartbeat.interval.ms": "10000"},
+			expected: []string{"following startup.mode=copy_existing", "duplicates but no gap"},
+			absent:   []string{"heartbeat"},
+		},
+		{
+			name:     "deprecated copy.existing",
+			config:   map[string]string{"errors.tolerance": "all", "copy.existing": "true"},
+			expected: []string{"startup.mode=copy_existing"},
+		},
+		{
+			name:     "mongo tolerance takes precedence",
+			config:   map[string]string{"mongo.errors.tolerance": "all", "errors.tolerance": "none", "startup.mode": "latest"},
+			expected: []string{"mongo.errors.tolerance=all: the task is expected to log", "never published"},
+			absent:   []string{"FAIL with ChangeStreamHistoryLost"},
+		},
+		{
+			name:     "mongo tolerance none",
+			config:   map[string]string{"mongo.errors.tolerance": "none", "errors.tolerance": "all"},
+			expected: []string{"mongo.errors.tolerance=none: the task is expected to FAIL", "or mongo.errors.tolerance=all"},
+		},
+		{
+			name:     "timestamp without start time",
+			config:   map[string]string{"errors.tolerance": "all", "startup.mode": "timestamp"},
+			expected: []string{"restarts at (not set)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notes := strings.Join(resume_expiry_expectations(tt.config), "\n")
+			for _, expected := range tt.expected {
+				if !strings.Contains(notes, expected) {
+					t.Errorf("Expected %q in:\n%s", expected, notes)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(notes, absent) {
+					t.Errorf("Did not expect %q in:\n%s", absent, notes)
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeRecovery(t *testing.T) {
+	failed := &ConnectorStatus{Tasks: []TaskStatus{{ID: 0, State: "FAILED"}}}
+	running := &ConnectorStatus{Tasks: []TaskStatus{{ID: 0, State: "RUNNING"}}}
+	tolerant := map[string]string{"errors.tolerance": "all"}
+
+	tests := []struct {
+		name     string
+		config   map[string]string
+		status   *ConnectorStatus
+		expected string
+	}{
+		{name: "failed as expected", config: map[string]string{}, status: failed, expected: "FAILED as expected"},
+		{name: "failed although tolerant", config: tolerant, status: failed, expected: "although errors.tolerance=all"},
+		{name: "recovered", config: tolerant, status: running, expected: "recovered"},
+		{name: "not read yet", config: map[string]string{}, status: running, expected: "may not have been read yet"},
+		{name: "no tasks", config: tolerant, status: &ConnectorStatus{}, expected: "No tasks"},
+		{name: "mongo tolerance recovered", config: map[string]string{"mongo.errors.tolerance": "all"}, status: running, expected: "recovered"},
+		{name: "mongo tolerance failed", config: map[string]string{"mongo.errors.tolerance": "all", "errors.tolerance": "none"}, status: failed, expected: "although mongo.errors.tolerance=all"},
+		{name: "mongo tolerance overrides errors.tolerance", config: map[string]string{"mongo.errors.tolerance": "none", "errors.tolerance": "all"}, status: failed, expected: "as expected with mongo.errors.tolerance=none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if summary := summarize_recovery(tt.config, tt.status); !strings.Contains(summary, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, summary)
+			}
+		})
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// compose overlay generated by `klaunch start --security <mode>`
+const securityComposeFile = "docker-compose.security.yaml"
+
+// CA, keystores and client properties; mounted at securityContainerDir in the brokers,
+// Connect workers and Schema Registry
+const securitySecretsDir = "secrets"
+
+const securityContainerDir = "/etc/kafka/secrets"
+
+// the SASL user of every klaunch client, and the mTLS client certificate CN
+const (
+	kafkaClientUser     = "klaunch"
+	kafkaClientPassword = "klaunch-secret"
+)
+
+var securityModes = []string{"plaintext", "sasl-scram", "sasl-plain", "mtls"}
+
+// validate_security_mode accepts "" as plaintext
+func validate_security_mode(mode string) error {
+	if mode == "" {
+		return nil
+	}
+	for _, known := range securityModes {
+		if mode == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown security mode %q (use %s)", mode, strings.Join(securityModes, ", "))
+}
+
+// validate_security_support checks the release: PEM keystores need Kafka 2.7 (Confluent Platform
+// 6.1) and SCRAM users can only be created over the brokers in KRaft from 7.5
+func validate_security_support(mode, cpVersion string, kraft bool) error {
+	if !is_secured(mode) {
+		return nil
+	}
+	if semver.Compare("v"+cpVersion, "v6.1.0") < 0 {
+		return fmt.Errorf("--security %s needs Confluent Platform 6.1.0 or later, got %s", mode, cpVersion)
+	}
+	if mode == "sasl-scram" && kraft && semver.Compare("v"+cpVersion, "v7.5.0") < 0 {
+		return fmt.Errorf("--security sasl-scram with --kraft needs Confluent Platform 7.5.0 or later, got %s", cpVersion)
+	}
+	return nil
+}
+
+func is_secured(mode string) bool {
+	return mode != "" && mode != "plaintext"
+}
+
+// kafka_security_mode is the mode recorded in .env by the last start
+func kafka_security_mode() string {
+	env, err := read_env_file(".env")
+	if err != nil || env["KAFKA_SECURITY"] == "" {
+		return "plaintext"
+	}
+	return env["KAFKA_SECURITY"]
+}
+
+func security_protocol(mode string) string {
+	switch mode {
+	case "sasl-scram", "sasl-plain":
+		return "SASL_SSL"
+	case "mtls":
+		return "SSL"
+	}
+	return "PLAINTEXT"
+}
+
+func sasl_mechanism(mode string) string {
+	switch mode {
+	case "sasl-scram":
+		return "SCRAM-SHA-512"
+	case "sasl-plain":
+		return "PLAIN"
+	}
+	return ""
+}
+
+// java_client_properties are the client settings of the Java clients for mode, with the
+// secrets found in dir
+func java_client_properties(mode, dir string) map[string]string {
+	props := map[string]string{"security.protocol": security_protocol(mode)}
+	if !is_secured(mode) {
+		return props
+	}
+	props["ssl.truststore.type"] = "PEM"
+	props["ssl.truststore.location"] = dir + "/ca.pem"
+	switch mode {
+	case "sasl-scram":
+		props["sasl.mechanism"] = sasl_mechanism(mode)
+		props["sasl.jaas.config"] = fmt.Sprintf(`org.apache.kafka.common.security.scram.ScramLoginModule required username="%s" password="%s";`, kafkaClientUser, kafkaClientPassword)
+	case "sasl-plain":
+		props["sasl.mechanism"] = sasl_mechanism(mode)
+		props["sasl.jaas.config"] = fmt.Sprintf(`org.apache.kafka.common.security.plain.PlainLoginModule required username="%s" password="%s";`, kafkaClientUser, kafkaClientPassword)
+	case "mtls":
+		props["ssl.keystore.type"] = "PEM"
+		props["ssl.keystore.location"] = dir + "/client.pem"
+	}
+	return props
+}
+
+// librdkafka_client_config is the matching configuration of the Go (librdkafka) clients, which
+// run on the host and read the secrets from securitySecretsDir
+func librdkafka_client_config(mode string) map[string]string {
+	config := map[string]string{"security.protocol": security_protocol(mode)}
+	if !is_secured(mode) {
+		return config
+	}
+	config["ssl.ca.location"] = filepath.Join(securitySecretsDir, "ca.pem")
+	if mode == "mtls" {
+		config["ssl.certificate.location"] = filepath.Join(securitySecretsDir, "client-cert.pem")
+		config["ssl.key.location"] = filepath.Join(securitySecretsDir, "client-key.pem")
+	} else {
+		config["sasl.mechanisms"] = sasl_mechanism(mode)
+		config["sasl.username"] = kafkaClientUser
+		config["sasl.password"] = kafkaClientPassword
+	}
+	return config
+}
+
+// kafka_cli_args runs a Kafka CLI tool in the kafka-connect container against the brokers,
+// with the client properties of the recorded security mode
+func kafka_cli_args(tool string, args ...string) []string {
+	cmd := append([]string{"exec", "kafka-connect", tool, "--bootstrap-server=kafka2:19092,kafka3:19093,kafka1:19091"}, args...)
+	if is_secured(kafka_security_mode()) {
+		cmd = append(cmd, "--command-config", securityContainerDir+"/client.properties")
+	}
+	return cmd
+}
+
+// env_properties turns client properties into the environment variables of a Confluent image,
+// e.g. CONNECT_ + sasl.jaas.config gives CONNECT_SASL_JAAS_CONFIG
+func env_properties(prefix string, props map[string]string, env map[string]string) {
+	for key, value := range props {
+		env[prefix+strings.ToUpper(strings.ReplaceAll(key, ".", "_"))] = value
+	}
+}
+
+type securityService struct {
+	Name    string
+	Restart bool
+	Env     map[string]string
+}
+
+// security_services computes the environment overrides of the brokers and clients. Brokers keep
+// a PLAINTEXT listener on 2919x for inter-broker traffic (and SCRAM user creation); the internal
+// 1909x and external 909x listeners use the secured protocol.
+func security_services(opts ComposeOptions) ([]securityService, error) {
+	if err := validate_security_mode(opts.Security); err != nil {
+		return nil, err
+	}
+	mode := opts.Security
+	protocol := security_protocol(mode)
+
+	var services []securityService
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("kafka%d", i)
+		listeners := fmt.Sprintf("BROKER://%s:%d, INTERNAL://%s:1909%d, EXTERNAL://%s:909%d", name, 29190+i, name, i, name, i)
+		if opts.Kraft == "combined" {
+			listeners += fmt.Sprintf(", CONTROLLER://%s:%d", name, 29090+i)
+		}
+		env := map[string]string{
+			"KAFKA_LISTENERS":                      listeners,
+			"KAFKA_ADVERTISED_LISTENERS":           fmt.Sprintf("BROKER://%s:%d, INTERNAL://%s:1909%d, EXTERNAL://localhost:909%d", name, 29190+i, name, i, i),
+			"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP": fmt.Sprintf("BROKER:PLAINTEXT,INTERNAL:%s,EXTERNAL:%s,CONTROLLER:PLAINTEXT", protocol, protocol),
+			"KAFKA_INTER_BROKER_LISTENER_NAME":     "BROKER",
+			"KAFKA_SSL_KEYSTORE_TYPE":              "PEM",
+			"KAFKA_SSL_KEYSTORE_LOCATION":          fmt.Sprintf("%s/%s.pem", securityContainerDir, name),
+			"KAFKA_SSL_TRUSTSTORE_TYPE":            "PEM",
+			"KAFKA_SSL_TRUSTSTORE_LOCATION":        securityContainerDir + "/ca.pem",
+			"KAFKA_SSL_CLIENT_AUTH":                "none",
+		}
+		switch mode {
+		case "mtls":
+			env["KAFKA_SSL_CLIENT_AUTH"] = "required"
+		case "sasl-plain":
+			env["KAFKA_SASL_ENABLED_MECHANISMS"] = "PLAIN"
+			jaas := fmt.Sprintf(`org.apache.kafka.common.security.plain.PlainLoginModule required user_%s="%s";`, kafkaClientUser, kafkaClientPassword)
+			env["KAFKA_LISTENER_NAME_INTERNAL_PLAIN_SASL_JAAS_CONFIG"] = jaas
+			env["KAFKA_LISTENER_NAME_EXTERNAL_PLAIN_SASL_JAAS_CONFIG"] = jaas
+		case "sasl-scram":
+			// "___" becomes "-" in the property name: listener.name.internal.scram-sha-512.sasl.jaas.config
+			env["KAFKA_SASL_ENABLED_MECHANISMS"] = "SCRAM-SHA-512"
+			jaas := "org.apache.kafka.common.security.scram.ScramLoginModule required;"
+			env["KAFKA_LISTENER_NAME_INTERNAL_SCRAM___SHA___512_SASL_JAAS_CONFIG"] = jaas
+			env["KAFKA_LISTENER_NAME_EXTERNAL_SCRAM___SHA___512_SASL_JAAS_CONFIG"] = jaas
+		}
+		services = append(services, securityService{Name: name, Env: env})
+	}
+
+	clientProps := java_client_properties(mode, securityContainerDir)
+	workers := opts.ConnectWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 1; i <= workers; i++ {
+		env := make(map[string]string)
+		for _, prefix := range []string{"CONNECT_", "CONNECT_PRODUCER_", "CONNECT_CONSUMER_", "CONNECT_ADMIN_"} {
+			env_properties(prefix, clientProps, env)
+		}
+		// workers exit while the SCRAM user does not exist yet
+		services = append(services, securityService{Name: connect_worker_container(i), Restart: true, Env: env})
+	}
+
+	registryEnv := make(map[string]string)
+	env_properties("SCHEMA_REGISTRY_KAFKASTORE_", clientProps, registryEnv)
+	services = append(services, securityService{Name: "schema-registry", Restart: true, Env: registryEnv})
+	return services, nil
+}
+
+var securityComposeTemplate = template.Must(template.New("security").Parse(`---
+# Generated by ` + "`klaunch start --security {{.Mode}}`" + `; do not edit.
+version: '3'
+services:
+{{- range .Services}}
+  {{.Name}}:
+{{- if .Restart}}
+    restart: on-failure
+{{- end}}
+    environment:
+{{- range $key, $value := .Env}}
+      {{$key}}: {{printf "%q" $value}}
+{{- end}}
+    volumes:
+      - $PWD/{{$.SecretsDir}}:{{$.ContainerDir}}
+{{end}}`))
+
+// render_security_compose generates the overlay securing the listeners and their clients
+func render_security_compose(opts ComposeOptions) (string, error) {
+	services, err := security_services(opts)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	err = securityComposeTemplate.Execute(&b, struct {
+		Mode         string
+		SecretsDir   string
+		ContainerDir string
+		Services     []securityService
+	}{opts.Security, securitySecretsDir, securityContainerDir, services})
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// write_security_material creates the local CA, a keystore per broker and the client certificate
+// in dir unless they exist, and rewrites the client properties for mode
+func write_security_material(dir, mode string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	ca, caKey, err := load_or_create_ca(dir)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("kafka%d", i)
+		path := filepath.Join(dir, name+".pem")
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		certPEM, keyPEM, err := issue_certificate(ca, caKey, name, []string{name, "localhost", "127.0.0.1"})
+		if err != nil {
+			return err
+		}
+		// PEM keystore: private key followed by the certificate chain
+		if err := write_secret(path, keyPEM, certPEM, pem_encode("CERTIFICATE", ca.Raw)); err != nil {
+			return err
+		}
+	}
+
+	clientPath := filepath.Join(dir, "client.pem")
+	if _, err := os.Stat(clientPath); err != nil {
+		certPEM, keyPEM, err := issue_certificate(ca, caKey, kafkaClientUser, nil)
+		if err != nil {
+			return err
+		}
+		for path, parts := range map[string][][]byte{
+			clientPath:                            {keyPEM, certPEM},
+			filepath.Join(dir, "client-cert.pem"): {certPEM},
+			filepath.Join(dir, "client-key.pem"):  {keyPEM},
+		} {
+			if err := write_secret(path, parts...); err != nil {
+				return err
+			}
+		}
+	}
+
+	props := java_client_properties(mode, securityContainerDir)
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", key, props[key])
+	}
+	return write_secret(filepath.Join(dir, "client.properties"), []byte(b.String()))
+}
+
+func load_or_create_ca(dir string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certPath, keyPath := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	if certErr == nil && keyErr == nil {
+		certBlock, _ := pem.Decode(certPEM)
+		keyBlock, _ := pem.Decode(keyPEM)
+		if certBlock == nil || keyBlock == nil {
+			return nil, nil, fmt.Errorf("invalid CA in %s; remove the directory to regenerate it", dir)
+		}
+		ca, err := x509.ParseCertificate(certBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected CA key type in %s", keyPath)
+		}
+		return ca, rsaKey, nil
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "klaunch local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := write_secret(certPath, pem_encode("CERTIFICATE", der)); err != nil {
+		return nil, nil, err
+	}
+	if err := write_secret(keyPath, pem_encode("PRIVATE KEY", keyDER)); err != nil {
+		return nil, nil, err
+	}
+	return ca, key, nil
+}
+
+// issue_certificate signs a server and client certificate for cn with the given SANs
+func issue_certificate(ca *x509.Certificate, caKey *rsa.PrivateKey, cn string, hosts []string) ([]byte, []byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem_encode("CERTIFICATE", der), pem_encode("PRIVATE KEY", keyDER), nil
+}
+
+func pem_encode(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+// write_secret concatenates parts into path; world-readable because the containers do not run as
+// the current user
+func write_secret(path string, parts ...[]byte) error {
+	var content []byte
+	for _, part := range parts {
+		content = append(content, part...)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// create_scram_user adds the SCRAM credentials of the klaunch user through the PLAINTEXT
+// inter-broker listener, retrying while the brokers start
+func create_scram_user(timeout time.Duration) error {
+	args := []string{"exec", "kafka1", "kafka-configs", "--bootstrap-server", "kafka1:29191",
+		"--alter", "--entity-type", "users", "--entity-name", kafkaClientUser,
+		"--add-config", fmt.Sprintf("SCRAM-SHA-512=[password=%s]", kafkaClientPassword)}
+	deadline := time.Now().Add(timeout)
+	for {
+		output, err := exec.Command("docker", args...).CombinedOutput()
+		if err == nil {
+			fmt.Printf("Created SCRAM-SHA-512 user %s\n", kafkaClientUser)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("failed to create SCRAM user %s: %v %s", kafkaClientUser, err, strings.TrimSpace(string(output)))
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// describe_security summarizes how clients reach the brokers in mode
+func describe_security(mode string) string {
+	if !is_secured(mode) {
+		return "Kafka listeners use PLAINTEXT"
+	}
+	description := fmt.Sprintf("Kafka listeners localhost:9091-9093 and kafka1-3:19091-19093 use %s", security_protocol(mode))
+	if mechanism := sasl_mechanism(mode); mechanism != "" {
+		description += fmt.Sprintf(" with %s, user %s / %s", mechanism, kafkaClientUser, kafkaClientPassword)
+	} else {
+		description += fmt.Sprintf(" with client certificates (%s/client.pem, CN=%s)", securitySecretsDir, kafkaClientUser)
+	}
+	return description + fmt.Sprintf("; CA: %s/ca.pem, client properties: %s/client.properties", securitySecretsDir, securitySecretsDir)
+}
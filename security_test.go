@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateSecuritySupport(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		cpVersion string
+		kraft     bool
+		wantErr   bool
+	}{
+		{name: "plaintext on an old release", mode: "plaintext", cpVersion: "5.5.0"},
+		{name: "mtls", mode: "mtls", cpVersion: "7.7.0"},
+		{name: "no PEM keystores", mode: "sasl-plain", cpVersion: "6.0.1", wantErr: true},
+		{name: "scram with zookeeper", mode: "sasl-scram", cpVersion: "7.4.0"},
+		{name: "scram with kraft", mode: "sasl-scram", cpVersion: "7.5.0", kraft: true},
+		{name: "scram with early kraft", mode: "sasl-scram", cpVersion: "7.4.0", kraft: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate_security_support(tt.mode, tt.cpVersion, tt.kraft)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unexpected error state: %v", err)
+			}
+		})
+	}
+}
+
+func TestRenderSecurityCompose(t *testing.T) {
+	content, err := render_security_compose(ComposeOptions{Security: "sasl-scram", Kraft: "combined", ConnectWorkers: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{
+		`KAFKA_LISTENERS: "BROKER://kafka2:29192, INTERNAL://kafka2:19092, EXTERNAL://kafka2:9092, CONTROLLER://kafka2:29092"`,
+		`KAFKA_ADVERTISED_LISTENERS: "BROKER://kafka1:29191, INTERNAL://kafka1:19091, EXTERNAL://localhost:9091"`,
+		`KAFKA_LISTENER_SECURITY_PROTOCOL_MAP: "BROKER:PLAINTEXT,INTERNAL:SASL_SSL,EXTERNAL:SASL_SSL,CONTROLLER:PLAINTEXT"`,
+		`KAFKA_LISTENER_NAME_EXTERNAL_SCRAM___SHA___512_SASL_JAAS_CONFIG: "org.apache.kafka.common.security.scram.ScramLoginModule required;"`,
+		"  kafka-connect-2:\n    restart: on-failure\n",
+		`CONNECT_PRODUCER_SASL_MECHANISM: "SCRAM-SHA-512"`,
+		`CONNECT_ADMIN_SSL_TRUSTSTORE_LOCATION: "/etc/kafka/secrets/ca.pem"`,
+		`CONNECT_SASL_JAAS_CONFIG: "org.apache.kafka.common.security.scram.ScramLoginModule required username=\"klaunch\" password=\"klaunch-secret\";"`,
+		`SCHEMA_REGISTRY_KAFKASTORE_SECURITY_PROTOCOL: "SASL_SSL"`,
+		"- $PWD/secrets:/etc/kafka/secrets",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, content)
+		}
+	}
+
+	if _, err := render_security_compose(ComposeOptions{Security: "kerberos"}); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestLibrdkafkaClientConfig(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected map[string]string
+	}{
+		{mode: "plaintext", expected: map[string]string{"security.protocol": "PLAINTEXT"}},
+		{mode: "sasl-plain", expected: map[string]string{"security.protocol": "SASL_SSL", "sasl.mechanisms": "PLAIN", "sasl.username": "klaunch", "ssl.ca.location": "secrets/ca.pem"}},
+		{mode: "mtls", expected: map[string]string{"security.protocol": "SSL", "ssl.certificate.location": "secrets/client-cert.pem", "ssl.key.location": "secrets/client-key.pem"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config := librdkafka_client_config(tt.mode)
+			for key, value := range tt.expected {
+				if config[key] != value {
+					t.Errorf("Expected %s=%s, got %q", key, value, config[key])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSecurityMaterial(t *testing.T) {
+	dir := t.TempDir()
+	if err := write_security_material(dir, "mtls"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	caPEM, _ := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatal("ca.pem holds no certificate")
+	}
+
+	// the broker keystore is the key followed by the chain, valid for the internal and external names
+	keystore, _ := os.ReadFile(filepath.Join(dir, "kafka2.pem"))
+	var blocks []*pem.Block
+	for rest := keystore; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	if len(blocks) != 3 || blocks[0].Type != "PRIVATE KEY" {
+		t.Fatalf("Unexpected keystore layout: %d blocks", len(blocks))
+	}
+	cert, err := x509.ParseCertificate(blocks[1].Bytes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, host := range []string{"kafka2", "localhost", "127.0.0.1"} {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("Broker certificate not valid for %s: %v", host, err)
+		}
+	}
+
+	properties, _ := os.ReadFile(filepath.Join(dir, "client.properties"))
+	if !strings.Contains(string(properties), "ssl.keystore.location=/etc/kafka/secrets/client.pem\n") {
+		t.Errorf("Unexpected client.properties:\n%s", properties)
+	}
+
+	// a second start keeps the CA and rewrites the client properties for the new mode
+	if err := write_security_material(dir, "sasl-plain"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if again, _ := os.ReadFile(filepath.Join(dir, "ca.pem")); string(again) != string(caPEM) {
+		t.Error("Expected the CA to be kept")
+	}
+	properties, _ = os.ReadFile(filepath.Join(dir, "client.properties"))
+	if !strings.Contains(string(properties), "sasl.mechanism=PLAIN\n") || strings.Contains(string(properties), "ssl.keystore") {
+		t.Errorf("Unexpected client.properties:\n%s", properties)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Confluent Platform release used when neither --cp-version nor CP_VERSION is set
+const defaultCPVersion = "7.7.0"
+
+// image tag of the Confluent services in the compose files; compose reads CP_VERSION from .env
+var cpVersionImageTag = "${CP_VERSION:-" + defaultCPVersion + "}"
+
+var cpVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// resolve_cp_version picks --cp-version, then CP_VERSION from the environment or .klaunch.env,
+// then the version recorded in .env by the previous start
+func resolve_cp_version(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	if vars, err := load_template_vars(""); err == nil && vars["CP_VERSION"] != "" {
+		return vars["CP_VERSION"]
+	}
+	if env, err := read_env_file(".env"); err == nil && env["CP_VERSION"] != "" {
+		return env["CP_VERSION"]
+	}
+	return defaultCPVersion
+}
+
+// validate_cp_version checks the release format and that it fits the ZooKeeper or KRaft stack:
+// Confluent Platform 8 removed ZooKeeper and KRaft is production ready from 7.4
+func validate_cp_version(version string, kraft bool) error {
+	if !cpVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid Confluent Platform version %q (use X.Y.Z, e.g. %s)", version, defaultCPVersion)
+	}
+	if !kraft && semver.Compare("v"+version, "v8.0.0") >= 0 {
+		return fmt.Errorf("Confluent Platform %s has no ZooKeeper; add --kraft", version)
+	}
+	if kraft && semver.Compare("v"+version, "v7.4.0") < 0 {
+		return fmt.Errorf("--kraft needs Confluent Platform 7.4.0 or later, got %s", version)
+	}
+	return nil
+}
+
+// set_env_value replaces KEY=... in a .env file, or appends it
+func set_env_value(path, key, value string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(content) == 0 {
+		lines = nil
+	}
+	found := false
+	for i, line := range lines {
+		name, current, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(name) != key {
+			continue
+		}
+		if strings.Trim(strings.TrimSpace(current), `"'`) == value {
+			return false, nil
+		}
+		lines[i] = key + "=" + value
+		found = true
+	}
+	if !found {
+		lines = append(lines, key+"="+value)
+	}
+	return true, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// record_cp_version stores the release in .env, where docker compose picks it up
+func record_cp_version(version string) error {
+	changed, err := set_env_value(".env", "CP_VERSION", version)
+	if err != nil {
+		return fmt.Errorf("failed to record CP_VERSION in .env: %v", err)
+	}
+	if changed {
+		fmt.Printf("Using Confluent Platform %s (CP_VERSION recorded in .env)\n", version)
+	}
+	return nil
+}
+
+// running_images maps the klaunch containers to their images
+func running_images() (map[string]string, error) {
+	output, err := exec.Command("docker", "ps", "--filter", "label=com.docker.compose.project=klaunch", "--format", "{{.Names}} {{.Image}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+	images := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if name, image, ok := strings.Cut(strings.TrimSpace(line), " "); ok {
+			images[name] = image
+		}
+	}
+	return images, nil
+}
+
+// format_image_versions lists the running images and flags Confluent images whose tag is
+// not the recorded CP_VERSION
+func format_image_versions(images map[string]string, cpVersion string) string {
+	names := make([]string, 0, len(images))
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("Running images:\n")
+	if len(names) == 0 {
+		b.WriteString("  none (klaunch is not running)\n")
+	}
+	for _, name := range names {
+		image := images[name]
+		fmt.Fprintf(&b, "  %-18s %s", name, image)
+		repository, tag, _ := strings.Cut(image, ":")
+		if strings.HasPrefix(repository, "confluentinc/cp-") || repository == "klaunch/kafka-connect" {
+			if tag != cpVersion {
+				fmt.Fprintf(&b, "  (CP_VERSION is %s)", cpVersion)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// ConnectRoot is the response of GET / on a Connect worker
+type ConnectRoot struct {
+	Version        string `json:"version"`
+	Commit         string `json:"commit"`
+	KafkaClusterID string `json:"kafka_cluster_id"`
+}
+
+func fetch_connect_root(port int) (*ConnectRoot, error) {
+	body, err := connect_worker_rest_get(port, "/")
+	if err != nil {
+		return nil, err
+	}
+	var root ConnectRoot
+	if err := json.Unmarshal(body, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse GET /: %v", err)
+	}
+	return &root, nil
+}
+
+// show_versions reports the recorded versions, the running images and what the Connect workers
+// and MongoDB plugins report
+func show_versions() error {
+	env, _ := read_env_file(".env")
+	cpVersion := env["CP_VERSION"]
+	if cpVersion == "" {
+		cpVersion = defaultCPVersion
+	}
+	fmt.Printf("CP_VERSION=%s\n\n", cpVersion)
+
+	images, err := running_images()
+	if err != nil {
+		return err
+	}
+	fmt.Println(format_image_versions(images, cpVersion))
+
+	workers, err := running_connect_workers()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Kafka Connect (GET /):")
+	if len(workers) == 0 {
+		fmt.Println("  no worker running")
+	}
+	for _, i := range workers {
+		root, err := fetch_connect_root(connect_worker_port(i))
+		if err != nil {
+			fmt.Printf("  %-18s unavailable: %v\n", connect_worker_container(i), err)
+			continue
+		}
+		fmt.Printf("  %-18s version %s (commit %s), Kafka cluster %s\n", connect_worker_container(i), root.Version, root.Commit, root.KafkaClusterID)
+	}
+	fmt.Println()
+
+	report, err := connector_jar_version_report(".env")
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(report))
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateCPVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		kraft   bool
+		wantErr string
+	}{
+		{version: "7.7.0"},
+		{version: "5.5.0"},
+		{version: "7.4.0", kraft: true},
+		{version: "8.0.0", kraft: true},
+		{version: "8.0.0", wantErr: "add --kraft"},
+		{version: "7.3.3", kraft: true, wantErr: "7.4.0 or later"},
+		{version: "latest", wantErr: "invalid"},
+		{version: "7.7", wantErr: "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			err := validate_cp_version(tt.version, tt.kraft)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSetEnvValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	os.WriteFile(path, []byte("MONGO_KAFKA_CONNECT_VERSION=2.0.1\nCASENUMBER=000001\n"), 0644)
+
+	changed, err := set_env_value(path, "CP_VERSION", "7.6.1")
+	if err != nil || !changed {
+		t.Fatalf("Expected CP_VERSION to be appended, got %v %v", changed, err)
+	}
+	changed, err = set_env_value(path, "CP_VERSION", "7.7.0")
+	if err != nil || !changed {
+		t.Fatalf("Expected CP_VERSION to be replaced, got %v %v", changed, err)
+	}
+	if changed, _ = set_env_value(path, "CP_VERSION", "7.7.0"); changed {
+		t.Error("Expected no change when the value is already recorded")
+	}
+
+	content, _ := os.ReadFile(path)
+	expected := "MONGO_KAFKA_CONNECT_VERSION=2.0.1\nCASENUMBER=000001\nCP_VERSION=7.7.0\n"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+}
+
+func TestFormatImageVersions(t *testing.T) {
+	images := map[string]string{
+		"kafka1":        "confluentinc/cp-server:7.7.0",
+		"kafka-connect": "klaunch/kafka-connect:7.6.1",
+		"grafana":       "grafana/grafana",
+	}
+
+	report := format_image_versions(images, "7.7.0")
+	lines := strings.Split(strings.TrimSpace(report), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected a header and 3 images, got:\n%s", report)
+	}
+	if !strings.Contains(lines[2], "klaunch/kafka-connect:7.6.1  (CP_VERSION is 7.7.0)") {
+		t.Errorf("Expected the Connect image to be flagged, got %q", lines[2])
+	}
+	if strings.Contains(lines[1], "CP_VERSION") || strings.Contains(lines[3], "CP_VERSION") {
+		t.Errorf("Only the mismatched image should be flagged:\n%s", report)
+	}
+}
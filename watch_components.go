@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// StateTransition records a single change observed between two status polls
+type StateTransition struct {
+	Time      time.Time
+	Connector string
+	TaskID    int // -1 when the transition concerns the connector itself
+	Kind      string
+	From      string
+	To        string
+}
+
+func (t StateTransition) String() string {
+	subject := t.Connector
+	if t.TaskID >= 0 {
+		subject = fmt.Sprintf("%s task %d", t.Connector, t.TaskID)
+	}
+	return fmt.Sprintf("%s %-10s %s: %s → %s",
+		t.Time.Format(time.RFC3339), t.Kind, subject, t.From, t.To)
+}
+
+// maximum number of transitions kept on screen
+const watchHistorySize = 15
+
+func connector_field(status *ConnectorStatus, key string) string {
+	if status == nil || status.Connector == nil {
+		return ""
+	}
+	if value, ok := status.Connector[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// diff_component_statuses compares two polls and returns the transitions between them
+func diff_component_statuses(prev, curr map[string]*ConnectorStatus, at time.Time) []StateTransition {
+	var transitions []StateTransition
+
+	names := make(map[string]bool)
+	for name := range prev {
+		names[name] = true
+	}
+	for name := range curr {
+		names[name] = true
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	for _, name := range sortedNames {
+		before, existed := prev[name]
+		after, exists := curr[name]
+
+		switch {
+		case !existed:
+			transitions = append(transitions, StateTransition{at, name, -1, "added", "-", connector_field(after, "state")})
+			continue
+		case !exists:
+			transitions = append(transitions, StateTransition{at, name, -1, "removed", connector_field(before, "state"), "-"})
+			continue
+		}
+
+		if from, to := connector_field(before, "state"), connector_field(after, "state"); from != to {
+			transitions = append(transitions, StateTransition{at, name, -1, "state", from, to})
+		}
+		if from, to := connector_field(before, "worker_id"), connector_field(after, "worker_id"); from != to {
+			transitions = append(transitions, StateTransition{at, name, -1, "worker", from, to})
+		}
+
+		// A change in the number of tasks means Connect rebalanced the connector
+		if len(before.Tasks) != len(after.Tasks) {
+			transitions = append(transitions, StateTransition{at, name, -1, "rebalance",
+				fmt.Sprintf("%d tasks", len(before.Tasks)), fmt.Sprintf("%d tasks", len(after.Tasks))})
+		}
+
+		previousTasks := make(map[int]TaskStatus, len(before.Tasks))
+		for _, task := range before.Tasks {
+			previousTasks[task.ID] = task
+		}
+		for _, task := range after.Tasks {
+			old, ok := previousTasks[task.ID]
+			if !ok {
+				transitions = append(transitions, StateTransition{at, name, task.ID, "state", "-", task.State})
+				continue
+			}
+			if old.State != task.State {
+				transitions = append(transitions, StateTransition{at, name, task.ID, "state", old.State, task.State})
+			}
+			if old.Worker != task.Worker {
+				transitions = append(transitions, StateTransition{at, name, task.ID, "worker", old.Worker, task.Worker})
+			}
+		}
+	}
+
+	return transitions
+}
+
+// render_watch_screen redraws the component tree, marking the entries that changed in the last poll
+func render_watch_screen(statuses map[string]*ConnectorStatus, changed []StateTransition, history []StateTransition, interval time.Duration, verbose bool) {
+	// Move the cursor home and clear the screen so the view refreshes in place
+	fmt.Print("\033[H\033[2J")
+	fmt.Printf("klaunch watch — every %s — %s (Ctrl+C to stop)\n\n", interval, time.Now().Format("15:04:05"))
+
+	changedConnectors := make(map[string]bool)
+	for _, t := range changed {
+		changedConnectors[t.Connector] = true
+	}
+
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("Connectors and Tasks:")
+	if len(names) == 0 {
+		fmt.Println("└── No connectors")
+	}
+	for _, name := range names {
+		marker := ""
+		if changedConnectors[name] {
+			marker = " 🔶 changed"
+		}
+		fmt.Printf("├── %s [%s]%s\n", name, connector_field(statuses[name], "state"), marker)
+		format_task_output(name, statuses[name].Tasks, verbose)
+	}
+
+	fmt.Println("\nRecent transitions:")
+	if len(history) == 0 {
+		fmt.Println("  (none yet)")
+	}
+	for _, t := range history {
+		fmt.Printf("  %s\n", t)
+	}
+}
+
+func watch_components(interval time.Duration, logFile string, verbose bool) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", interval)
+	}
+
+	var transitionLog *os.File
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open transition log: %v", err)
+		}
+		defer f.Close()
+		transitionLog = f
+	}
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigchan)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous map[string]*ConnectorStatus
+	var history []StateTransition
+
+	for {
+		current, err := fetch_connector_statuses()
+		if err != nil {
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("klaunch watch — %s\n\nError polling Kafka Connect: %v\n", time.Now().Format("15:04:05"), err)
+		} else {
+			var changed []StateTransition
+			if previous != nil {
+				changed = diff_component_statuses(previous, current, time.Now())
+			}
+			for _, t := range changed {
+				if transitionLog != nil {
+					fmt.Fprintln(transitionLog, t.String())
+				}
+			}
+			history = append(history, changed...)
+			if len(history) > watchHistorySize {
+				history = history[len(history)-watchHistorySize:]
+			}
+			render_watch_screen(current, changed, history, interval, verbose)
+			previous = current
+		}
+
+		select {
+		case sig := <-sigchan:
+			fmt.Printf("\nCaught signal %v: stopping watch\n", sig)
+			if logFile != "" {
+				fmt.Printf("Transitions saved to %s\n", logFile)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
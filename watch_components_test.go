@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStatus(state, worker string, tasks ...TaskStatus) *ConnectorStatus {
+	return &ConnectorStatus{
+		Connector: map[string]interface{}{"state": state, "worker_id": worker},
+		Tasks:     tasks,
+	}
+}
+
+func TestDiffComponentStatuses(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		prev          map[string]*ConnectorStatus
+		curr          map[string]*ConnectorStatus
+		expectedKinds []string
+	}{
+		{
+			name: "no changes",
+			prev: map[string]*ConnectorStatus{
+				"source": newTestStatus("RUNNING", "connect:8083", TaskStatus{ID: 0, State: "RUNNING", Worker: "connect:8083"}),
+			},
+			curr: map[string]*ConnectorStatus{
+				"source": newTestStatus("RUNNING", "connect:8083", TaskStatus{ID: 0, State: "RUNNING", Worker: "connect:8083"}),
+			},
+			expectedKinds: nil,
+		},
+		{
+			name: "task fails",
+			prev: map[string]*ConnectorStatus{
+				"sink": newTestStatus("RUNNING", "connect:8083", TaskStatus{ID: 0, State: "RUNNING", Worker: "connect:8083"}),
+			},
+			curr: map[string]*ConnectorStatus{
+				"sink": newTestStatus("RUNNING", "connect:8083", TaskStatus{ID: 0, State: "FAILED", Worker: "connect:8083"}),
+			},
+			expectedKinds: []string{"state"},
+		},
+		{
+			name: "task moves to another worker",
+			prev: map[string]*ConnectorStatus{
+				"sink": newTestStatus("RUNNING", "connect1:8083", TaskStatus{ID: 0, State: "RUNNING", Worker: "connect1:8083"}),
+			},
+			curr: map[string]*ConnectorStatus{
+				"sink": newTestStatus("RUNNING", "connect2:8083", TaskStatus{ID: 0, State: "RUNNING", Worker: "connect2:8083"}),
+			},
+			expectedKinds: []string{"worker", "worker"},
+		},
+		{
+			name: "rebalance adds a task",
+			prev: map[string]*ConnectorStatus{
+				"source": newTestStatus("RUNNING", "connect:8083", TaskStatus{ID: 0, State: "RUNNING"}),
+			},
+			curr: map[string]*ConnectorStatus{
+				"source": newTestStatus("RUNNING", "connect:8083", TaskStatus{ID: 0, State: "RUNNING"}, TaskStatus{ID: 1, State: "UNASSIGNED"}),
+			},
+			expectedKinds: []string{"rebalance", "state"},
+		},
+		{
+			name: "connector added and removed",
+			prev: map[string]*ConnectorStatus{
+				"old": newTestStatus("RUNNING", "connect:8083"),
+			},
+			curr: map[string]*ConnectorStatus{
+				"new": newTestStatus("RUNNING", "connect:8083"),
+			},
+			expectedKinds: []string{"added", "removed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transitions := diff_component_statuses(tt.prev, tt.curr, at)
+			if len(transitions) != len(tt.expectedKinds) {
+				t.Fatalf("Expected %d transitions, got %d: %v", len(tt.expectedKinds), len(transitions), transitions)
+			}
+			for i, kind := range tt.expectedKinds {
+				if transitions[i].Kind != kind {
+					t.Errorf("Transition %d: expected kind %s, got %s", i, kind, transitions[i].Kind)
+				}
+				if !transitions[i].Time.Equal(at) {
+					t.Errorf("Transition %d: expected time %v, got %v", i, at, transitions[i].Time)
+				}
+			}
+		})
+	}
+}
+
+func TestStateTransitionString(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	taskLine := StateTransition{at, "sink", 2, "state", "RUNNING", "FAILED"}.String()
+	for _, expected := range []string{"2024-01-02T03:04:05Z", "sink task 2", "RUNNING → FAILED"} {
+		if !strings.Contains(taskLine, expected) {
+			t.Errorf("Expected %q to contain %q", taskLine, expected)
+		}
+	}
+
+	connectorLine := StateTransition{at, "sink", -1, "state", "RUNNING", "PAUSED"}.String()
+	if strings.Contains(connectorLine, "task") {
+		t.Errorf("Connector transition should not mention a task: %q", connectorLine)
+	}
+}
+
+func TestWatchComponentsInvalidInterval(t *testing.T) {
+	if err := watch_components(0, "", false); err == nil {
+		t.Error("Expected error for non-positive interval")
+	}
+}